@@ -1,7 +1,6 @@
 package accesslist
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 
@@ -25,6 +24,9 @@ type AccessList struct {
 	// int = -1表示当前地址没有对应的slot；int >= 0表示Address对应的slot在slots数组中的序号
 	Addresses map[common.Address]int
 	Slots     []map[common.Hash]struct{}
+	// 只读标记：被标记的地址（账户本身）或slot只会被读取，未标记的项按读写处理
+	ReadOnlyAddresses map[common.Address]struct{}                 `json:",omitempty"`
+	ReadOnlySlots     map[common.Address]map[common.Hash]struct{} `json:",omitempty"`
 }
 
 // NewAccessList 新建一个AccessList类型对象
@@ -125,56 +127,30 @@ func (NewAL *AccessList) AccessListAddSlot(address common.Address, slot common.H
 // 	}
 // }
 
-// ConflictDetection 冲突检测函数，检测stateDB中的AccessList和真实的AccessList之间有没有不一样的部分，如果出现了不一样，就需要将该交易放到串行队列中
-// 返回值：是否发生冲突，发生冲突项是否有Slot，地址是多少，Slot是多少。注意，后三项返回值只需要在result为false才有意义
+// ConflictDetection 冲突检测函数，检测用户声明的AccessList是否覆盖了真实的AccessList，如果没有覆盖，就需要将该交易放到串行队列中
+// 真实访问到的每个地址和slot都必须被声明；真实写入的地址或slot不能被声明为只读
+// 返回值：是否没有冲突，发生冲突项是否有Slot，地址是多少，Slot是多少。注意，后三项返回值只需要在result为false才有意义
 func (NewAL *AccessList) ConflictDetection(UserAL *AccessList) (result bool, haveSlot bool, address common.Address, slot []common.Hash) {
 	for key, value := range NewAL.Addresses {
-		// 不存在slot，address不相同则发生冲突
+		if !UserAL.ContainsAddress(key) { // AL中不包含这个地址，超出范围
+			fmt.Printf("%sERROR MSG%s   某个运行访问到的address 不存在于 用户自定义的AccessList中\n", FRED, FRESET)
+			return false, false, key, []common.Hash{}
+		}
+		if !NewAL.IsReadOnly(key) && UserAL.IsReadOnly(key) {
+			fmt.Printf("%sERROR MSG%s   某个运行写入的address 在用户自定义的AccessList中被声明为只读\n", FRED, FRESET)
+			return false, false, key, []common.Hash{}
+		}
 		if value == -1 {
-			result := UserAL.ContainsAddress(key) // false则表示超出了范围
-			if !result {                          // AL中不包含这个地址，超出范围
-				fmt.Printf("%sERROR MSG%s   某个运行访问到的address 不存在于 用户自定义的AccessList中", FRED, FRESET)
-				return false, false, key, []common.Hash{}
-			}
-		} else {
-			// 存在slot，address和slot都不相同则发生冲突
-			// 先判断地址是否存在，不存在直接报错
-			result := UserAL.ContainsAddress(key) // false则表示超出了范围
-			var tempNew []common.Hash
-			for key := range NewAL.Slots[value] {
-				tempNew = append(tempNew, key) // ! tempTrue中存储了 真实的 对应的slot值
+			continue
+		}
+		for slotkey := range NewAL.Slots[value] {
+			if _, ok := UserAL.Contains(key, slotkey); !ok {
+				fmt.Printf("%sERROR MSG%s   某个运行访问到的slot 不存在于 用户自定义的AccessList中\n", FRED, FRESET)
+				return false, true, key, []common.Hash{slotkey}
 			}
-			if !result { // 地址不存在
-				fmt.Printf("%sERROR MSG%s   某个运行访问到的address 不存在于 用户自定义的AccessList中", FRED, FRESET)
-				return false, true, key, tempNew
-			} else {
-				// 地址存在，判断slot
-				// 拿到用户表中对应address的slot
-				var tempUser []common.Hash
-				for key := range UserAL.Slots[UserAL.Addresses[key]] { // UserAL.Addresses[key]是stateDB的AccessList保存地址对应的slot序号
-					tempUser = append(tempNew, key) // ! tempUser中存储了 用户 对应的slot值
-				}
-				// 判断slot是否一样
-				if len(tempNew) != len(tempUser) { // 长度不一样
-					fmt.Printf("%sERROR MSG%s   AccessList中的slot信息不同", FRED, FRESET)
-					return false, true, key, tempNew
-				}
-				// 长度一样，则详细检查
-				for _, a := range tempUser {
-					isSlotEqual := false
-					for i := 0; i < len(tempNew); i++ {
-						if bytes.Compare(a[:], tempNew[i][:]) == 0 {
-							// 存在相等的
-							isSlotEqual = true
-							break
-						}
-					}
-					if !isSlotEqual {
-						fmt.Printf("%sERROR MSG%s   某个运行访问到的address 不存在于 用户自定义的AccessList中", FRED, FRESET)
-						// 不存在相等的slot，访问了AccessList列表之外的地址信息
-						return false, true, key, tempNew
-					}
-				}
+			if !NewAL.IsReadOnlySlot(key, slotkey) && UserAL.IsReadOnlySlot(key, slotkey) {
+				fmt.Printf("%sERROR MSG%s   某个运行写入的slot 在用户自定义的AccessList中被声明为只读\n", FRED, FRESET)
+				return false, true, key, []common.Hash{slotkey}
 			}
 		}
 	}
@@ -182,17 +158,25 @@ func (NewAL *AccessList) ConflictDetection(UserAL *AccessList) (result bool, hav
 }
 
 // CombineTrueAccessList 构造完整的AccessList函数，将传入的部分AccessList合并到总的AccessList中
+// 新加入的项沿用部分AccessList中的只读标记，部分AccessList中写入的项清除总AccessList中的只读标记
 func (TrueAL *AccessList) CombineTrueAccessList(NewAL *AccessList) bool {
 	for key, value := range NewAL.Addresses {
 		// 添加address
-		TrueAL.AccessListAddAddress(key)
+		if TrueAL.AccessListAddAddress(key) && NewAL.IsReadOnly(key) {
+			TrueAL.markAddress(key, true)
+		} else if !NewAL.IsReadOnly(key) {
+			TrueAL.markAddress(key, false)
+		}
 		// 添加slot
-		if value != -1 {
-			for slotkey, _ := range NewAL.Slots[value] {
-				TrueAL.AccessListAddSlot(key, slotkey)
+		if value == -1 {
+			continue
+		}
+		for slotkey := range NewAL.Slots[value] {
+			if _, added := TrueAL.AccessListAddSlot(key, slotkey); added && NewAL.IsReadOnlySlot(key, slotkey) {
+				TrueAL.markSlot(key, slotkey, true)
+			} else if !NewAL.IsReadOnlySlot(key, slotkey) {
+				TrueAL.markSlot(key, slotkey, false)
 			}
-		} else {
-			// 只有address没有slot
 		}
 	}
 	return true
@@ -204,6 +188,7 @@ func (TrueAL *AccessList) CombineTrueAccessList(NewAL *AccessList) bool {
 // operations.
 func (al *AccessList) DeleteAddress(address common.Address) {
 	delete(al.Addresses, address)
+	al.markAddress(address, false)
 }
 
 // DeleteSlot removes an (address, slot)-tuple from the access list.
@@ -218,6 +203,7 @@ func (al *AccessList) DeleteSlot(address common.Address, slot common.Hash) {
 	}
 	slotmap := al.Slots[idx]
 	delete(slotmap, slot)
+	al.markSlot(address, slot, false)
 	// If that was the last (first) slot, remove it
 	// Since additions and rollbacks are always performed in order,
 	// we can delete the item without worrying about screwing up later indices
@@ -292,5 +278,13 @@ func (a *AccessList) Copy() *AccessList {
 		}
 		cp.Slots[i] = newSlotmap
 	}
+	for addr := range a.ReadOnlyAddresses {
+		cp.markAddress(addr, true)
+	}
+	for addr, slots := range a.ReadOnlySlots {
+		for slot := range slots {
+			cp.markSlot(addr, slot, true)
+		}
+	}
 	return cp
 }
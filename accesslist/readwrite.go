@@ -0,0 +1,85 @@
+package accesslist
+
+import "github.com/SipengXie/pangu/common"
+
+// IsReadOnly 地址（账户本身）是否被标记为只读，不在AccessList中的地址返回false
+func (al *AccessList) IsReadOnly(address common.Address) bool {
+	_, ok := al.ReadOnlyAddresses[address]
+	return ok
+}
+
+// IsReadOnlySlot slot是否被标记为只读，不在AccessList中的slot返回false
+func (al *AccessList) IsReadOnlySlot(address common.Address, slot common.Hash) bool {
+	_, ok := al.ReadOnlySlots[address][slot]
+	return ok
+}
+
+// AddReadAddress 添加一个只读的地址，地址已经存在时不改变它的读写属性
+func (al *AccessList) AddReadAddress(address common.Address) bool {
+	if !al.AccessListAddAddress(address) {
+		return false
+	}
+	al.markAddress(address, true)
+	return true
+}
+
+// AddWriteAddress 添加一个会被写入的地址，地址已经存在时清除它的只读标记
+func (al *AccessList) AddWriteAddress(address common.Address) bool {
+	added := al.AccessListAddAddress(address)
+	al.markAddress(address, false)
+	return added
+}
+
+// AddReadSlot 添加一个只读的slot，slot已经存在时不改变它的读写属性；因此新加入的地址本身标记为只读
+func (al *AccessList) AddReadSlot(address common.Address, slot common.Hash) (addrChange bool, slotChange bool) {
+	addrChange, slotChange = al.AccessListAddSlot(address, slot)
+	if addrChange {
+		al.markAddress(address, true)
+	}
+	if slotChange {
+		al.markSlot(address, slot, true)
+	}
+	return addrChange, slotChange
+}
+
+// AddWriteSlot 添加一个会被写入的slot，slot已经存在时清除它的只读标记；写slot不修改账户本身，新加入的地址标记为只读
+func (al *AccessList) AddWriteSlot(address common.Address, slot common.Hash) (addrChange bool, slotChange bool) {
+	addrChange, slotChange = al.AccessListAddSlot(address, slot)
+	if addrChange {
+		al.markAddress(address, true)
+	}
+	al.markSlot(address, slot, false)
+	return addrChange, slotChange
+}
+
+// markAddress 设置或清除地址的只读标记
+func (al *AccessList) markAddress(address common.Address, readOnly bool) {
+	if !readOnly {
+		delete(al.ReadOnlyAddresses, address)
+		return
+	}
+	if al.ReadOnlyAddresses == nil {
+		al.ReadOnlyAddresses = make(map[common.Address]struct{})
+	}
+	al.ReadOnlyAddresses[address] = struct{}{}
+}
+
+// markSlot 设置或清除slot的只读标记
+func (al *AccessList) markSlot(address common.Address, slot common.Hash, readOnly bool) {
+	if !readOnly {
+		if slots, ok := al.ReadOnlySlots[address]; ok {
+			delete(slots, slot)
+			if len(slots) == 0 {
+				delete(al.ReadOnlySlots, address)
+			}
+		}
+		return
+	}
+	if al.ReadOnlySlots == nil {
+		al.ReadOnlySlots = make(map[common.Address]map[common.Hash]struct{})
+	}
+	if al.ReadOnlySlots[address] == nil {
+		al.ReadOnlySlots[address] = make(map[common.Hash]struct{})
+	}
+	al.ReadOnlySlots[address][slot] = struct{}{}
+}
@@ -0,0 +1,84 @@
+package accesslist
+
+import (
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/rlp"
+)
+
+// rlpTuple AccessList的规范编码形式中的一项：地址及其slot列表
+// 只读标记放在可选的尾部字段中，没有只读标记的AccessList编码与之前相同
+type rlpTuple struct {
+	Address      common.Address
+	StorageKeys  []common.Hash
+	ReadOnly     bool          `rlp:"optional"`
+	ReadOnlyKeys []common.Hash `rlp:"optional"` // StorageKeys中只读的slot，从小到大排序
+}
+
+// tuples 将AccessList转成规范形式：地址从小到大排序，每个地址的slot从小到大排序
+// map的遍历顺序是随机的，签名和哈希必须基于规范形式计算
+func (al *AccessList) tuples() []rlpTuple {
+	if al == nil {
+		return []rlpTuple{}
+	}
+	tuples := make([]rlpTuple, 0, len(al.Addresses))
+	for addr, idx := range al.Addresses {
+		tuple := rlpTuple{Address: addr, StorageKeys: []common.Hash{}, ReadOnly: al.IsReadOnly(addr)}
+		if idx >= 0 && idx < len(al.Slots) {
+			for slot := range al.Slots[idx] {
+				tuple.StorageKeys = append(tuple.StorageKeys, slot)
+			}
+			sort.Slice(tuple.StorageKeys, func(i, j int) bool {
+				return tuple.StorageKeys[i].Less(tuple.StorageKeys[j])
+			})
+			// 保持nil，使没有只读slot时省略该字段
+			for _, slot := range tuple.StorageKeys {
+				if al.IsReadOnlySlot(addr, slot) {
+					tuple.ReadOnlyKeys = append(tuple.ReadOnlyKeys, slot)
+				}
+			}
+		}
+		tuples = append(tuples, tuple)
+	}
+	sort.Slice(tuples, func(i, j int) bool {
+		return tuples[i].Address.Less(tuples[j].Address)
+	})
+	return tuples
+}
+
+// EncodeRLP 实现rlp.Encoder，按规范形式编码
+func (al *AccessList) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, al.tuples())
+}
+
+// DecodeRLP 实现rlp.Decoder
+func (al *AccessList) DecodeRLP(s *rlp.Stream) error {
+	var tuples []rlpTuple
+	if err := s.Decode(&tuples); err != nil {
+		return err
+	}
+	*al = *NewAccessList()
+	for _, tuple := range tuples {
+		al.AddAddress(tuple.Address)
+		for _, slot := range tuple.StorageKeys {
+			al.AddSlot(tuple.Address, slot)
+		}
+		if tuple.ReadOnly {
+			al.markAddress(tuple.Address, true)
+		}
+		for _, slot := range tuple.ReadOnlyKeys {
+			if _, ok := al.Contains(tuple.Address, slot); ok {
+				al.markSlot(tuple.Address, slot, true)
+			}
+		}
+	}
+	return nil
+}
+
+// Equal 两个AccessList的地址、slot以及只读标记是否完全相同
+func (al *AccessList) Equal(other *AccessList) bool {
+	return reflect.DeepEqual(al.tuples(), other.tuples())
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/SipengXie/pangu/core/evm"
+	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/params"
+)
+
+var ErrEmptyAggregate = errors.New("aggregate transaction contains no inner transactions")
+
+// ApplyAggregateCover 处理聚合交易的Cover：验证聚合者签名与nonce，聚合者按基础费支付Cover的内在汽油并将nonce加一，返回拆出的内部交易
+// Cover没有小费字段，内在汽油按基础费收取，与惩罚汽油一样不计入区块的GasUsed；聚合者余额不足时整笔聚合交易不执行
+// 内部交易各自的签名、nonce与汽油费在执行时按普通交易检查，由各自的发送方支付
+func ApplyAggregateCover(tx *types.Transaction, signer types.Signer, evmEvent *evm.EVM) (types.Transactions, error) {
+	aggregator, err := types.Sender(signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	inner := tx.InnerTxs()
+	if len(inner) == 0 {
+		return nil, ErrEmptyAggregate
+	}
+	statedb := evmEvent.StateDB
+	if nonce := statedb.GetNonce(aggregator); nonce != tx.Nonce() {
+		return nil, fmt.Errorf("%w: aggregator %v, tx: %d state: %d", errors.New("invalid aggregate nonce"), aggregator.Hex(), tx.Nonce(), nonce)
+	}
+	if BaseFee := evmEvent.Context.BaseFee; BaseFee != nil && BaseFee.Sign() > 0 {
+		Cost := new(big.Int).Mul(new(big.Int).SetUint64(params.TxGas), BaseFee)
+		if Balance := statedb.GetBalance(aggregator); Balance.Cmp(Cost) < 0 {
+			return nil, fmt.Errorf("%w: aggregator %v, balance %v, cover cost %v", types.ErrInsufficientFunds, aggregator.Hex(), Balance, Cost)
+		}
+		statedb.SubBalance(aggregator, Cost)
+		PayFees(&TxMessage{GasPrice: BaseFee}, params.TxGas, evmEvent)
+	}
+	statedb.SetNonce(aggregator, tx.Nonce()+1)
+	fmt.Printf("%sPROMPT MSG%s   聚合交易 %v 中共有 %d 笔内部交易\n", types.FGREEN, types.FRESET, tx.Hash(), len(inner))
+	return inner, nil
+}
+
+// HasAggregate 交易列表中是否包含聚合交易
+func HasAggregate(txs types.Transactions) bool {
+	for _, tx := range txs {
+		if tx.IsAggregate() {
+			return true
+		}
+	}
+	return false
+}
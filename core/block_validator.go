@@ -0,0 +1,152 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/params"
+	"github.com/SipengXie/pangu/trie"
+)
+
+// allowedFutureBlockTime 区块时间戳最多可以超前本地时间的秒数
+const allowedFutureBlockTime = 15 * time.Second
+
+var (
+	// ErrKnownBlock 区块已经在链上
+	ErrKnownBlock = errors.New("block already known")
+	// ErrUnknownAncestor 找不到区块的父区块
+	ErrUnknownAncestor = errors.New("unknown ancestor")
+	// ErrFutureBlock 区块时间戳超前本地时间太多
+	ErrFutureBlock = errors.New("block in the future")
+	// ErrInvalidNumber 区块高度不是父区块高度加一
+	ErrInvalidNumber = errors.New("invalid block number")
+	// ErrOlderBlockTime 区块时间戳早于父区块
+	ErrOlderBlockTime = errors.New("timestamp older than parent")
+	// ErrInvalidGasLimit GasLimit超出范围或相对父区块变化太大
+	ErrInvalidGasLimit = errors.New("invalid gas limit")
+	// ErrInvalidGasUsed 区块使用的汽油超过GasLimit，或与执行结果不一致
+	ErrInvalidGasUsed = errors.New("invalid gas used")
+	// ErrExtraDataTooLong 区块头的附加数据超过MaximumExtraDataSize
+	ErrExtraDataTooLong = errors.New("extra-data too long")
+	// ErrInvalidHeader 区块头中的字段超出编码范围
+	ErrInvalidHeader = errors.New("invalid header")
+	// ErrInvalidTxRoot 区块头的TxRoot与区块体中的交易不一致
+	ErrInvalidTxRoot = errors.New("invalid transaction root")
+	// ErrInvalidGroupRoot 区块头的GroupRoot与区块体中的执行布局不一致
+	ErrInvalidGroupRoot = errors.New("invalid group root")
+	// ErrInvalidReceiptRoot 区块头的ReceiptRoot与执行得到的收据不一致
+	ErrInvalidReceiptRoot = errors.New("invalid receipt root")
+	// ErrInvalidBloom 区块头的布隆过滤器与执行得到的收据不一致
+	ErrInvalidBloom = errors.New("invalid bloom")
+)
+
+// ValidateHeader 检查区块头相对父区块是否合法：高度连续、父哈希、时间戳不早于父区块且不超前本地时间太多、
+// 汽油使用量与GasLimit、GasLimit的变化幅度、附加数据长度与基础费
+// 同一秒内可以出多个区块，因此时间戳允许与父区块相同
+func ValidateHeader(config *params.ChainConfig, parent, header *types.Header) error {
+	if err := header.SanityCheck(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	if parent == nil || header.ParentHash != parent.Hash() {
+		return fmt.Errorf("%w: parent %x", ErrUnknownAncestor, header.ParentHash)
+	}
+	if header.Number == nil || header.Number.Uint64() != parent.Number.Uint64()+1 {
+		return fmt.Errorf("%w: have %v, want %d", ErrInvalidNumber, header.Number, parent.Number.Uint64()+1)
+	}
+	if uint64(len(header.Extra)) > params.MaximumExtraDataSize {
+		return fmt.Errorf("%w: %d > %d", ErrExtraDataTooLong, len(header.Extra), params.MaximumExtraDataSize)
+	}
+	if header.Time < parent.Time {
+		return fmt.Errorf("%w: have %d, parent %d", ErrOlderBlockTime, header.Time, parent.Time)
+	}
+	if header.Time > uint64(time.Now().Add(allowedFutureBlockTime).Unix()) {
+		return fmt.Errorf("%w: timestamp %d", ErrFutureBlock, header.Time)
+	}
+	if header.GasLimit > params.MaxGasLimit {
+		return fmt.Errorf("%w: have %d, max %d", ErrInvalidGasLimit, header.GasLimit, params.MaxGasLimit)
+	}
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("%w: have %d, gasLimit %d", ErrInvalidGasUsed, header.GasUsed, header.GasLimit)
+	}
+	if err := VerifyGaslimit(parent.GasLimit, header.GasLimit); err != nil {
+		return err
+	}
+	return VerifyEIP1559Header(config, parent, header)
+}
+
+// VerifyGaslimit 检查GasLimit相对父区块的变化不超过 parentGasLimit / GasLimitBoundDivisor，且不低于MinGasLimit
+func VerifyGaslimit(parentGasLimit, headerGasLimit uint64) error {
+	diff := int64(parentGasLimit) - int64(headerGasLimit)
+	if diff < 0 {
+		diff *= -1
+	}
+	limit := parentGasLimit / params.GasLimitBoundDivisor
+	if uint64(diff) >= limit {
+		return fmt.Errorf("%w: have %d, want %d += %d", ErrInvalidGasLimit, headerGasLimit, parentGasLimit, limit-1)
+	}
+	if headerGasLimit < params.MinGasLimit {
+		return fmt.Errorf("%w: have %d, minimum %d", ErrInvalidGasLimit, headerGasLimit, params.MinGasLimit)
+	}
+	return nil
+}
+
+// CalcGasLimit 计算下一个区块的GasLimit，在父区块的基础上每个区块最多变化允许幅度，逐步向desiredLimit靠近
+func CalcGasLimit(parentGasLimit, desiredLimit uint64) uint64 {
+	delta := parentGasLimit/params.GasLimitBoundDivisor - 1
+	limit := parentGasLimit
+	if desiredLimit < params.MinGasLimit {
+		desiredLimit = params.MinGasLimit
+	}
+	if limit < desiredLimit {
+		limit = parentGasLimit + delta
+		if limit > desiredLimit {
+			limit = desiredLimit
+		}
+		return limit
+	}
+	if limit > desiredLimit {
+		limit = parentGasLimit - delta
+		if limit < desiredLimit {
+			limit = desiredLimit
+		}
+	}
+	return limit
+}
+
+// ValidateBody 检查区块体与区块头的承诺一致：交易对应TxRoot，携带的执行布局对应GroupRoot
+func ValidateBody(block *types.Block) error {
+	header := block.Header()
+	if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != header.TxRoot {
+		return fmt.Errorf("%w: have %x, want %x", ErrInvalidTxRoot, hash, header.TxRoot)
+	}
+	if layout := block.Layout(); layout != nil && layout.Hash() != header.GroupRoot {
+		return fmt.Errorf("%w: have %x, want %x", ErrInvalidGroupRoot, layout.Hash(), header.GroupRoot)
+	}
+	return nil
+}
+
+// ValidateState 检查执行得到的收据与区块头一致：ReceiptRoot、布隆过滤器，以及收据的汽油之和等于GasUsed
+func ValidateState(block *types.Block, receipts types.Receipts) error {
+	header := block.Header()
+	var gasUsed uint64
+	for _, receipt := range receipts {
+		gasUsed += receipt.GasUsed
+	}
+	if gasUsed != header.GasUsed {
+		return fmt.Errorf("%w: have %d, want %d", ErrInvalidGasUsed, gasUsed, header.GasUsed)
+	}
+	receiptRoot, bloom := types.EmptyReceiptsHash, types.Bloom{}
+	if len(receipts) != 0 {
+		receiptRoot = types.DeriveSha(receipts, trie.NewStackTrie(nil))
+		bloom = types.CreateBloom(receipts)
+	}
+	if receiptRoot != header.ReceiptRoot {
+		return fmt.Errorf("%w: have %x, want %x", ErrInvalidReceiptRoot, receiptRoot, header.ReceiptRoot)
+	}
+	if bloom != header.Bloom {
+		return fmt.Errorf("%w: receipts and header differ", ErrInvalidBloom)
+	}
+	return nil
+}
@@ -2,12 +2,16 @@ package core
 
 import (
 	"errors"
+	"fmt"
 	"sync/atomic"
 
 	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/common/prque"
 	"github.com/SipengXie/pangu/core/evm"
+	"github.com/SipengXie/pangu/core/rawdb"
 	"github.com/SipengXie/pangu/core/state"
 	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/ethdb"
 	"github.com/SipengXie/pangu/event"
 	"github.com/SipengXie/pangu/params"
 	"github.com/SipengXie/pangu/utils/syncx"
@@ -15,6 +19,7 @@ import (
 
 var (
 	errChainStopped = errors.New("chain stopped")
+	errMissingHead  = errors.New("missing head block")
 )
 
 type WriteStatus byte
@@ -25,13 +30,22 @@ const (
 	SideStatTy
 )
 
+// Blockchain 区块、收据与交易索引通过rawdb写入db，状态树提交到db，重启后从db中的链头恢复
 type Blockchain struct {
-	blocks types.Blocks
+	db               ethdb.Database // 区块与状态所在的数据库
+	stateCache       state.Database // 状态树的读写缓存
+	currentBlock     atomic.Pointer[types.Block]
+	currentFinalized atomic.Pointer[types.Header] // 共识最终确认的区块，规范链不会回滚到它之前
+
+	triesInMemory uint64                           // 状态树保留在内存中的最近区块数，0表示每个区块的状态都直接写入磁盘
+	triegc        *prque.Prque[int64, common.Hash] // 内存中的状态根，按区块高度从低到高释放
+	txLookupLimit uint64                           // 保留交易索引的最近区块数，0表示保留所有区块的交易索引
 
 	config        *params.ChainConfig
 	gasLimit      atomic.Uint64
-	statedb       *state.StateDB
 	chainHeadFeed *event.Feed
+	chainSideFeed *event.Feed // 进入分叉的区块
+	rmLogsFeed    *event.Feed // 回滚时被移除的日志
 	vmConfig      evm.Config
 
 	chainmu *syncx.ClosableMutex
@@ -39,18 +53,72 @@ type Blockchain struct {
 	scope event.SubscriptionScope
 }
 
+// NewBlokchain 在statedb所在的数据库上创建区块链，数据库中还没有链时statedb的当前内容作为创世状态
 func NewBlokchain(config *params.ChainConfig, statedb *state.StateDB, vmConfig evm.Config) *Blockchain {
+	kvdb := statedb.Database().DiskDB()
+	db, ok := kvdb.(ethdb.Database)
+	if !ok {
+		db = rawdb.NewDatabase(kvdb)
+	}
+	if rawdb.ReadCanonicalHash(db, 0) == (common.Hash{}) {
+		// 提交statedb的副本，statedb本身仍然可以继续执行交易
+		if _, err := (&Genesis{Config: config}).commit(db, statedb.Copy()); err != nil {
+			panic(err)
+		}
+	}
+	bc, err := newBlockchain(db, config, statedb.Database(), vmConfig)
+	if err != nil {
+		panic(err)
+	}
+	return bc
+}
+
+// NewBlockchain 在db上打开区块链：db中还没有链时提交genesis，已有链时检查genesis与db中的创世区块一致（genesis可以为nil），然后从链头恢复区块与状态
+func NewBlockchain(db ethdb.Database, genesis *Genesis, vmConfig evm.Config) (*Blockchain, error) {
+	return NewBlockchainWithOverride(db, genesis, false, vmConfig)
+}
+
+// NewBlockchainWithOverride 与NewBlockchain相同，overrideConfig为true时用genesis的链配置覆盖db中不一致的链配置
+func NewBlockchainWithOverride(db ethdb.Database, genesis *Genesis, overrideConfig bool, vmConfig evm.Config) (*Blockchain, error) {
+	config, _, err := SetupGenesisBlockWithOverride(db, genesis, overrideConfig)
+	if err != nil {
+		return nil, err
+	}
+	return newBlockchain(db, config, state.NewDatabase(db), vmConfig)
+}
+
+func newBlockchain(db ethdb.Database, config *params.ChainConfig, stateCache state.Database, vmConfig evm.Config) (*Blockchain, error) {
 	bc := &Blockchain{
-		blocks:        make(types.Blocks, 0),
+		db:            db,
+		stateCache:    stateCache,
 		config:        config,
-		statedb:       statedb,
+		triesInMemory: DefaultTriesInMemory,
+		triegc:        prque.New[int64, common.Hash](nil),
 		chainHeadFeed: new(event.Feed),
+		chainSideFeed: new(event.Feed),
+		rmLogsFeed:    new(event.Feed),
 		chainmu:       syncx.NewClosableMutex(),
 		vmConfig:      vmConfig,
 	}
-	b := NewGenesisBlock()
-	bc.blocks = append(bc.blocks, b)
-	return bc
+	if hash := rawdb.ReadFinalizedBlockHash(db); hash != (common.Hash{}) {
+		if number := rawdb.ReadHeaderNumber(db, hash); number != nil {
+			bc.currentFinalized.Store(rawdb.ReadHeader(db, hash, *number))
+		}
+	}
+	head := rawdb.ReadHeadBlock(db)
+	if head == nil {
+		return nil, errMissingHead
+	}
+	// 节点异常退出时内存中的状态没有写入磁盘，链头回退到状态完整的区块
+	head, err := bc.repairHead(head)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.setHeadState(head); err != nil {
+		return nil, err
+	}
+	fmt.Printf("%sPROMPT MSG%s   链头区块高度 %d\n", types.FGREEN, types.FRESET, head.NumberU64())
+	return bc, nil
 }
 
 func (bc *Blockchain) VmConfig() evm.Config {
@@ -61,25 +129,115 @@ func (bc *Blockchain) Config() *params.ChainConfig {
 	return bc.config
 }
 
+// DB 区块链所在的数据库
+func (bc *Blockchain) DB() ethdb.Database {
+	return bc.db
+}
+
 func (bc *Blockchain) CurrentBlock() *types.Header {
-	return bc.blocks[len(bc.blocks)-1].Header()
+	return bc.currentBlock.Load().Header()
 }
 
 func (bc *Blockchain) GetBlock(hash common.Hash, number uint64) *types.Block {
-	return bc.blocks[number]
+	// 链头区块直接返回内存中的对象
+	if head := bc.currentBlock.Load(); head.NumberU64() == number && head.Header().Hash() == hash {
+		return head
+	}
+	return rawdb.ReadBlock(bc.db, hash, number)
+}
+
+// GetBlockByNumber 规范链上高度为number的区块
+func (bc *Blockchain) GetBlockByNumber(number uint64) *types.Block {
+	hash := rawdb.ReadCanonicalHash(bc.db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return bc.GetBlock(hash, number)
 }
 
-func (bc *Blockchain) StateAt(root common.Hash) (*state.StateDB, error) {
-	return bc.statedb, nil
+// setHeadState 把block设为链头，它的状态必须可以打开，之后的区块在它之上执行
+func (bc *Blockchain) setHeadState(block *types.Block) error {
+	if !bc.HasState(block.StateRoot()) {
+		return fmt.Errorf("%w: block %d [%x]", ErrMissingState, block.NumberU64(), block.Hash())
+	}
+	bc.currentBlock.Store(block)
+	return nil
 }
 
-func (bc *Blockchain) writeHeadBlock(block *types.Block, state *state.StateDB) {
-	bc.blocks = append(bc.blocks, block)
-	// state.Commit(false) // TODO
+// writeBlockWithState 保留区块的状态树，区块与收据按哈希写入batch，不修改规范链
+// 区块的状态在执行后已经Commit到状态树缓存中，分叉上的区块也保留状态，切换规范链时直接在它之上继续执行
+func (bc *Blockchain) writeBlockWithState(batch ethdb.KeyValueWriter, block *types.Block, receipts []*types.Receipt) error {
+	if err := bc.retainState(block); err != nil {
+		return err
+	}
+	rawdb.WriteBlock(batch, block)
+	rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receipts)
+	return nil
+}
+
+// writeSideBlock 保存不在当前链头之上的区块，等待共识的最终确认切换规范链
+func (bc *Blockchain) writeSideBlock(block *types.Block, receipts []*types.Receipt) error {
+	batch := bc.db.NewBatch()
+	if err := bc.writeBlockWithState(batch, block, receipts); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// writeHeadBlock 把区块、收据与交易索引写入数据库并设为规范链头，超出txLookupLimit的旧交易索引随之删除
+func (bc *Blockchain) writeHeadBlock(block *types.Block, receipts []*types.Receipt) error {
+	batch := bc.db.NewBatch()
+	if err := bc.writeBlockWithState(batch, block, receipts); err != nil {
+		return err
+	}
+	rawdb.WriteTxLookupEntriesByBlock(batch, block)
+	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
+	rawdb.WriteHeadBlockHash(batch, block.Hash())
+	rawdb.WriteHeadHeaderHash(batch, block.Hash())
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	bc.unindexTxs(block.NumberU64())
+	return bc.setHeadState(block)
+}
+
+// validateBlock 写入前检查区块头相对父区块合法，区块体与执行得到的收据和区块头一致
+func (bc *Blockchain) validateBlock(block *types.Block, receipts types.Receipts) error {
+	if rawdb.HasHeader(bc.db, block.Hash(), block.NumberU64()) {
+		return fmt.Errorf("%w: %d [%x]", ErrKnownBlock, block.NumberU64(), block.Hash())
+	}
+	header := block.Header()
+	// 按哈希查找父区块，高度是否连续由ValidateHeader检查
+	var parent *types.Header
+	if number := rawdb.ReadHeaderNumber(bc.db, header.ParentHash); number != nil {
+		parent = bc.GetHeader(header.ParentHash, *number)
+	}
+	if err := ValidateHeader(bc.config, parent, header); err != nil {
+		return err
+	}
+	if err := ValidateBody(block); err != nil {
+		return err
+	}
+	return ValidateState(block, receipts)
 }
 
 func (bc *Blockchain) writeBlockAndSetHead(block *types.Block, receipts []*types.Receipt, logs []*types.Log, state *state.StateDB, emitHeadEvent bool) (status WriteStatus, err error) {
-	bc.writeHeadBlock(block, state)
+	if err := bc.validateBlock(block, receipts); err != nil {
+		fmt.Printf("%sERROR MSG%s   区块 %d 校验不通过 err = %v\n", types.FRED, types.FRESET, block.NumberU64(), err)
+		return NonStatTy, err
+	}
+	// 不在当前链头之上的区块进入分叉，规范链只在共识确认后切换
+	if block.ParentHash() != bc.currentBlock.Load().Hash() {
+		if err := bc.writeSideBlock(block, receipts); err != nil {
+			return NonStatTy, err
+		}
+		fmt.Printf("%sPROMPT MSG%s   区块 %d [%x] 不在当前链头之上，作为分叉保存\n", types.FGREEN, types.FRESET, block.NumberU64(), block.Hash().Bytes()[:4])
+		bc.chainSideFeed.Send(types.ChainSideEvent{Block: block})
+		return SideStatTy, nil
+	}
+	if err := bc.writeHeadBlock(block, receipts); err != nil {
+		return NonStatTy, err
+	}
 	if emitHeadEvent {
 		bc.chainHeadFeed.Send(types.ChainHeadEvent{Block: block})
 	}
@@ -96,12 +254,34 @@ func (bc *Blockchain) WriteBlockAndSetHead(block *types.Block, receipts []*types
 	return bc.writeBlockAndSetHead(block, receipts, logs, state, emitHeadEvent)
 }
 
+// Stop 停止区块链，链头的状态写入磁盘，之后的写入返回errChainStopped，数据库由打开它的一方关闭
+func (bc *Blockchain) Stop() {
+	bc.scope.Close()
+	bc.chainmu.Close()
+	if err := bc.stateCache.TrieDB().Commit(bc.CurrentBlock().StateRoot, false); err != nil {
+		fmt.Printf("%sERROR MSG%s   链头状态写入磁盘失败 err = %v\n", types.FRED, types.FRESET, err)
+	}
+}
+
 // SubscribeChainHeadEvent registers a subscription of ChainHeadEvent.
 func (bc *Blockchain) SubscribeChainHeadEvent(ch chan<- types.ChainHeadEvent) event.Subscription {
 	return bc.scope.Track(bc.chainHeadFeed.Subscribe(ch))
 }
 
+// SubscribeChainSideEvent registers a subscription of ChainSideEvent.
+func (bc *Blockchain) SubscribeChainSideEvent(ch chan<- types.ChainSideEvent) event.Subscription {
+	return bc.scope.Track(bc.chainSideFeed.Subscribe(ch))
+}
+
+// SubscribeRemovedLogsEvent registers a subscription of RemovedLogsEvent.
+func (bc *Blockchain) SubscribeRemovedLogsEvent(ch chan<- types.RemovedLogsEvent) event.Subscription {
+	return bc.scope.Track(bc.rmLogsFeed.Subscribe(ch))
+}
+
 // GetHeader 临时定义一个，在process中需要实现这个方法获取哈希值来创建evm环境
 func (bc *Blockchain) GetHeader(h common.Hash, i uint64) *types.Header {
-	return bc.blocks[i].Header()
+	if head := bc.currentBlock.Load(); head.NumberU64() == i && head.Header().Hash() == h {
+		return head.Header()
+	}
+	return rawdb.ReadHeader(bc.db, h, i)
 }
@@ -0,0 +1,553 @@
+// Block-STM风格的乐观并行执行器，不依赖用户声明的AccessList
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/SipengXie/pangu/common"
+	evmparams "github.com/SipengXie/pangu/core/evm/params"
+
+	"github.com/SipengXie/pangu/core/evm"
+	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/types"
+)
+
+// ExecStrategy Processor的交易执行策略
+type ExecStrategy byte
+
+const (
+	StrategyGroup ExecStrategy = iota // 按AccessList分组并行 + 串行队列（默认）
+	StrategySTM                       // Block-STM乐观并行执行
+)
+
+// errSTMFallback 乐观执行遇到无法建模的状态修改（自毁合约），整个区块退化为串行执行
+var errSTMFallback = errors.New("block-stm: unsupported state modification, fallback to serial")
+
+// stmKey 多版本内存中的一个状态项，Slot为空表示账户本身（余额、nonce、代码）
+type stmKey struct {
+	Addr    common.Address
+	Slot    common.Hash
+	IsStore bool
+}
+
+// stmValue 状态项某个版本的值
+type stmValue struct {
+	Balance  *big.Int
+	Nonce    uint64
+	CodeHash common.Hash
+	Code     []byte
+	Storage  common.Hash
+}
+
+func (v *stmValue) equal(o *stmValue) bool {
+	if v.Balance == nil || o.Balance == nil {
+		return v.Storage == o.Storage
+	}
+	return v.Balance.Cmp(o.Balance) == 0 && v.Nonce == o.Nonce && v.CodeHash == o.CodeHash
+}
+
+// MVMemory 多版本内存，记录每个状态项被哪些交易写入过，以及各自写入的值
+type MVMemory struct {
+	mu   sync.RWMutex
+	data map[stmKey]map[int]*stmValue // 状态项 -> 交易序号 -> 写入的值
+	base map[stmKey]*stmValue         // 状态项在区块执行前的值
+	keys [][]stmKey                   // 每笔交易最近一次执行写入的状态项
+}
+
+func NewMVMemory(txNum int) *MVMemory {
+	return &MVMemory{
+		data: make(map[stmKey]map[int]*stmValue),
+		base: make(map[stmKey]*stmValue),
+		keys: make([][]stmKey, txNum),
+	}
+}
+
+// read 返回序号小于txIndex的交易中最后一次写入key的值，没有则返回区块执行前的值
+func (mv *MVMemory) read(key stmKey, txIndex int) (*stmValue, bool) {
+	mv.mu.RLock()
+	defer mv.mu.RUnlock()
+
+	writer := -1
+	for idx := range mv.data[key] {
+		if idx < txIndex && idx > writer {
+			writer = idx
+		}
+	}
+	if writer >= 0 {
+		return mv.data[key][writer], true
+	}
+	v, ok := mv.base[key]
+	return v, ok
+}
+
+// setBase 记录状态项在区块执行前的值，所有交易读到的基础值都一样，只保留第一次写入的
+func (mv *MVMemory) setBase(key stmKey, v *stmValue) {
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+	if _, ok := mv.base[key]; !ok {
+		mv.base[key] = v
+	}
+}
+
+// record 用交易txIndex最新一次执行的写集合替换上一次执行的写集合
+func (mv *MVMemory) record(txIndex int, writes map[stmKey]*stmValue) {
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+
+	for _, key := range mv.keys[txIndex] {
+		if _, ok := writes[key]; !ok {
+			delete(mv.data[key], txIndex)
+		}
+	}
+	keys := make([]stmKey, 0, len(writes))
+	for key, v := range writes {
+		if mv.data[key] == nil {
+			mv.data[key] = make(map[int]*stmValue)
+		}
+		mv.data[key][txIndex] = v
+		keys = append(keys, key)
+	}
+	mv.keys[txIndex] = keys
+}
+
+// snapshot 返回每个状态项最后一次写入的值，按地址、slot排序，保证写回状态的顺序确定
+func (mv *MVMemory) snapshot() ([]stmKey, []*stmValue) {
+	mv.mu.RLock()
+	defer mv.mu.RUnlock()
+
+	keys := make([]stmKey, 0, len(mv.data))
+	for key, versions := range mv.data {
+		if len(versions) != 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Addr != keys[j].Addr {
+			return keys[i].Addr.Less(keys[j].Addr)
+		}
+		if keys[i].IsStore != keys[j].IsStore {
+			return !keys[i].IsStore
+		}
+		return keys[i].Slot.Less(keys[j].Slot)
+	})
+	values := make([]*stmValue, len(keys))
+	for i, key := range keys {
+		writer := -1
+		for idx := range mv.data[key] {
+			if idx > writer {
+				writer = idx
+			}
+		}
+		values[i] = mv.data[key][writer]
+	}
+	return keys, values
+}
+
+// stmStateDB 单次执行使用的StateDB，在区块基础状态的独立副本上执行，
+// 第一次访问某个状态项时从多版本内存中注入更早交易写入的值，并记录读写集合
+type stmStateDB struct {
+	*state.StateDB
+
+	mv       *MVMemory
+	txIndex  int
+	reads    map[stmKey]*stmValue
+	writes   map[stmKey]struct{}
+	fallback bool
+}
+
+func newSTMStateDB(base *state.StateDB, mv *MVMemory, txIndex int) *stmStateDB {
+	return &stmStateDB{
+		StateDB: base.ForkView(),
+		mv:      mv,
+		txIndex: txIndex,
+		reads:   make(map[stmKey]*stmValue),
+		writes:  make(map[stmKey]struct{}),
+	}
+}
+
+// prepare 第一次访问账户时注入更早交易写入的版本，并记录读集合
+func (s *stmStateDB) prepare(addr common.Address) {
+	key := stmKey{Addr: addr}
+	if _, ok := s.reads[key]; ok {
+		return
+	}
+	if v, ok := s.mv.read(key, s.txIndex); ok {
+		s.StateDB.InjectAccount(addr, v.Balance, v.Nonce, v.CodeHash, v.Code)
+		s.reads[key] = v
+		return
+	}
+	v := s.accountValue(addr)
+	s.mv.setBase(key, v)
+	s.reads[key] = v
+}
+
+// prepareSlot 第一次访问slot时注入更早交易写入的版本，并记录读集合
+func (s *stmStateDB) prepareSlot(addr common.Address, slot common.Hash) {
+	s.prepare(addr)
+	key := stmKey{Addr: addr, Slot: slot, IsStore: true}
+	if _, ok := s.reads[key]; ok {
+		return
+	}
+	if v, ok := s.mv.read(key, s.txIndex); ok {
+		s.StateDB.InjectStorage(addr, slot, v.Storage)
+		s.reads[key] = v
+		return
+	}
+	v := &stmValue{Storage: s.StateDB.GetState(addr, slot)}
+	s.mv.setBase(key, v)
+	s.reads[key] = v
+}
+
+func (s *stmStateDB) accountValue(addr common.Address) *stmValue {
+	return &stmValue{
+		Balance:  new(big.Int).Set(s.StateDB.GetBalance(addr)),
+		Nonce:    s.StateDB.GetNonce(addr),
+		CodeHash: s.StateDB.GetCodeHash(addr),
+		Code:     s.StateDB.GetCode(addr),
+	}
+}
+
+// writeSet 返回本次执行写入的所有状态项及其最终值
+func (s *stmStateDB) writeSet() map[stmKey]*stmValue {
+	writes := make(map[stmKey]*stmValue, len(s.writes))
+	for key := range s.writes {
+		if key.IsStore {
+			writes[key] = &stmValue{Storage: s.StateDB.GetState(key.Addr, key.Slot)}
+		} else {
+			writes[key] = s.accountValue(key.Addr)
+		}
+	}
+	return writes
+}
+
+func (s *stmStateDB) CreateAccount(addr common.Address) {
+	s.prepare(addr)
+	s.StateDB.CreateAccount(addr)
+	s.writes[stmKey{Addr: addr}] = struct{}{}
+}
+
+func (s *stmStateDB) SubBalance(addr common.Address, amount *big.Int) {
+	s.prepare(addr)
+	s.StateDB.SubBalance(addr, amount)
+	s.writes[stmKey{Addr: addr}] = struct{}{}
+}
+
+func (s *stmStateDB) AddBalance(addr common.Address, amount *big.Int) {
+	s.prepare(addr)
+	s.StateDB.AddBalance(addr, amount)
+	s.writes[stmKey{Addr: addr}] = struct{}{}
+}
+
+func (s *stmStateDB) GetBalance(addr common.Address) *big.Int {
+	s.prepare(addr)
+	return s.StateDB.GetBalance(addr)
+}
+
+func (s *stmStateDB) GetNonce(addr common.Address) uint64 {
+	s.prepare(addr)
+	return s.StateDB.GetNonce(addr)
+}
+
+func (s *stmStateDB) SetNonce(addr common.Address, nonce uint64) {
+	s.prepare(addr)
+	s.StateDB.SetNonce(addr, nonce)
+	s.writes[stmKey{Addr: addr}] = struct{}{}
+}
+
+func (s *stmStateDB) GetCodeHash(addr common.Address) common.Hash {
+	s.prepare(addr)
+	return s.StateDB.GetCodeHash(addr)
+}
+
+func (s *stmStateDB) GetCode(addr common.Address) []byte {
+	s.prepare(addr)
+	return s.StateDB.GetCode(addr)
+}
+
+func (s *stmStateDB) SetCode(addr common.Address, code []byte) {
+	s.prepare(addr)
+	s.StateDB.SetCode(addr, code)
+	s.writes[stmKey{Addr: addr}] = struct{}{}
+}
+
+func (s *stmStateDB) GetCodeSize(addr common.Address) int {
+	s.prepare(addr)
+	return s.StateDB.GetCodeSize(addr)
+}
+
+func (s *stmStateDB) GetCommittedState(addr common.Address, slot common.Hash) common.Hash {
+	s.prepareSlot(addr, slot)
+	return s.StateDB.GetCommittedState(addr, slot)
+}
+
+func (s *stmStateDB) GetState(addr common.Address, slot common.Hash) common.Hash {
+	s.prepareSlot(addr, slot)
+	return s.StateDB.GetState(addr, slot)
+}
+
+func (s *stmStateDB) SetState(addr common.Address, slot, value common.Hash) {
+	s.prepareSlot(addr, slot)
+	s.StateDB.SetState(addr, slot, value)
+	s.writes[stmKey{Addr: addr, Slot: slot, IsStore: true}] = struct{}{}
+}
+
+func (s *stmStateDB) SelfDestruct(addr common.Address) {
+	s.fallback = true
+	s.StateDB.SelfDestruct(addr)
+}
+
+func (s *stmStateDB) Selfdestruct6780(addr common.Address) {
+	s.fallback = true
+	s.StateDB.Selfdestruct6780(addr)
+}
+
+func (s *stmStateDB) Exist(addr common.Address) bool {
+	s.prepare(addr)
+	return s.StateDB.Exist(addr)
+}
+
+func (s *stmStateDB) Empty(addr common.Address) bool {
+	s.prepare(addr)
+	return s.StateDB.Empty(addr)
+}
+
+// stmResult 一笔交易最近一次执行的结果
+type stmResult struct {
+	state   *stmStateDB
+	receipt *types.Receipt
+	err     error
+}
+
+// STMStats Block-STM执行统计信息，用于和分组执行方式对比
+type STMStats struct {
+	Executions   int // 总执行次数
+	ReExecutions int // 因读集合失效而重新执行的次数
+	Validations  int // 验证次数
+}
+
+// blockSTM 一个区块的乐观并行执行上下文
+type blockSTM struct {
+	p       *Processor
+	base    *state.StateDB
+	txs     types.Transactions
+	header  *types.Header
+	cfg     evm.Config
+	signer  types.Signer
+	mv      *MVMemory
+	results []*stmResult
+	stats   STMStats
+	workers int
+}
+
+// execute 在多版本内存上执行第i笔交易，并用新的写集合替换旧的写集合
+func (b *blockSTM) execute(i int) {
+	var (
+		tx      = b.txs[i]
+		statedb = newSTMStateDB(b.base, b.mv, i)
+		usedGas = new(uint64)
+		res     = &stmResult{state: statedb}
+	)
+	EachEvm := evm.NewEVM(NewEVMBlockContext(b.header, b.p.blockchain, nil), evm.TxContext{}, statedb, new(evmparams.ChainConfig).FromGlobal(b.p.config), b.cfg)
+	msg, err := TransactionToMessage(tx, b.signer, b.header.BaseFee, false, b.p.decryptKey)
+	if IsDecryptError(err) {
+		res.receipt, res.err = ExecuteUndecryptableTx(msg, b.header.Number, b.header.Hash(), tx, usedGas, EachEvm)
+	} else if err != nil {
+		res.err = err
+	} else {
+		res.receipt, _, res.err = ExecuteTx(msg, b.header.Number, b.header.Hash(), tx, usedGas, EachEvm)
+	}
+	b.mv.record(i, statedb.writeSet())
+	b.results[i] = res
+}
+
+// executeAll 使用有限个线程并行执行txIndexes中的交易
+func (b *blockSTM) executeAll(txIndexes []int) {
+	var (
+		wg    sync.WaitGroup
+		queue = make(chan int, len(txIndexes))
+	)
+	for _, i := range txIndexes {
+		queue <- i
+	}
+	close(queue)
+	for w := 0; w < b.workers && w < len(txIndexes); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				b.execute(i)
+			}
+		}()
+	}
+	wg.Wait()
+	b.stats.Executions += len(txIndexes)
+}
+
+// validate 检查第i笔交易读到的值是否仍然是更早交易写入的最新版本
+func (b *blockSTM) validate(i int) bool {
+	b.stats.Validations++
+	for key, v := range b.results[i].state.reads {
+		cur, ok := b.mv.read(key, i)
+		if !ok || !cur.equal(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// run 乐观并行执行所有交易，按区块顺序逐笔验证并提交
+// 第一个验证失败的交易之前的交易都已提交，它重新执行后的结果一定正确；之后验证失败的交易再并行重新执行
+func (b *blockSTM) run() error {
+	all := make([]int, len(b.txs))
+	for i := range all {
+		all[i] = i
+	}
+	b.executeAll(all)
+
+	committed := 0
+	for committed < len(b.txs) {
+		for committed < len(b.txs) && b.validate(committed) {
+			if b.results[committed].state.fallback {
+				return errSTMFallback
+			}
+			committed++
+		}
+		if committed == len(b.txs) {
+			break
+		}
+		b.execute(committed)
+		b.stats.Executions++
+		b.stats.ReExecutions++
+		if b.results[committed].state.fallback {
+			return errSTMFallback
+		}
+		committed++
+
+		var invalid []int
+		for i := committed; i < len(b.txs); i++ {
+			if !b.validate(i) {
+				invalid = append(invalid, i)
+			}
+		}
+		b.executeAll(invalid)
+		b.stats.ReExecutions += len(invalid)
+	}
+	return nil
+}
+
+// ProcessSTM 使用Block-STM方式执行区块：交易按区块顺序排列，乐观并行执行并记录真实的读写集合，
+// 验证失败的交易重新执行，最终按区块顺序提交，结果与串行执行一致
+func (p *Processor) ProcessSTM(block *types.Block, statedb *state.StateDB, cfg evm.Config) (*ProcessReturnMsg, error) {
+	var (
+		Header      = block.Header()
+		Receipts    types.Receipts
+		AllLogs     []*types.Log
+		ErrorTxList []*TxErrorMessage
+		UsedGas     = new(uint64)
+	)
+	statedb.Finalise(true)
+
+	fmt.Printf("\n%sSTAGE CHANGE%s   交易开始乐观并行处理 <<< \n", types.FBLUE, types.FRESET)
+
+	stm := &blockSTM{
+		p:       p,
+		base:    statedb,
+		txs:     block.Transactions(),
+		header:  Header,
+		cfg:     cfg,
+		signer:  types.MakeSigner(p.config, Header.Number, Header.Time),
+		workers: p.workers,
+	}
+	if stm.workers <= 0 {
+		stm.workers = runtime.NumCPU()
+	}
+	stm.mv = NewMVMemory(len(stm.txs))
+	stm.results = make([]*stmResult, len(stm.txs))
+
+	// 聚合交易的内部交易在执行时才展开，交给串行执行处理
+	if HasAggregate(stm.txs) {
+		fmt.Printf("%sPROMPT MSG%s   区块中包含聚合交易，退化为串行执行\n", types.FGREEN, types.FRESET)
+		return p.processSerial(block, statedb, cfg)
+	}
+	if err := stm.run(); err != nil {
+		fmt.Printf("%sPROMPT MSG%s   乐观并行执行无法处理当前区块，退化为串行执行\n", types.FGREEN, types.FRESET)
+		return p.processSerial(block, statedb, cfg)
+	}
+
+	fmt.Printf("\n%sSTAGE CHANGE%s   乐观并行交易结果提交 <<< \n", types.FBLUE, types.FRESET)
+
+	// 按顺序写回每个状态项的最终版本
+	keys, values := stm.mv.snapshot()
+	for i, key := range keys {
+		v := values[i]
+		if key.IsStore {
+			statedb.SetState(key.Addr, key.Slot, v.Storage)
+			continue
+		}
+		statedb.SetBalance(key.Addr, v.Balance)
+		statedb.SetNonce(key.Addr, v.Nonce)
+		if statedb.GetCodeHash(key.Addr) != v.CodeHash {
+			statedb.SetCode(key.Addr, v.Code)
+		}
+	}
+	// 收费增量不经过多版本内存，按最终一次执行的结果累加
+	for _, res := range stm.results {
+		statedb.MergeFeeLedger(res.state.StateDB)
+	}
+	Fees := FinaliseFees(p.config, Header, statedb)
+	for i, res := range stm.results {
+		if res.err != nil {
+			ErrorTxList = append(ErrorTxList, NewTxErrorMessage(stm.txs[i], "function ExecuteTx err", res.err))
+			continue
+		}
+		*UsedGas += res.receipt.GasUsed
+		Receipts = append(Receipts, res.receipt)
+		AllLogs = append(AllLogs, res.receipt.Logs...)
+	}
+
+	RootHash, err := statedb.Commit(true)
+	if err != nil {
+		fmt.Printf("%sERROR MSG%s   Commit函数出错\n", types.FRED, types.FRESET)
+		return new(ProcessReturnMsg), errors.New("commit函数出错")
+	}
+	fmt.Printf("%sPROMPT MSG%s   乐观并行执行完成，共执行 %d 次，其中重新执行 %d 次\n", types.FGREEN, types.FRESET, stm.stats.Executions, stm.stats.ReExecutions)
+
+	DeriveReceiptIndexes(Receipts) // Block-STM的规范顺序即区块中的交易顺序
+	PReturnMsg := NewProcessReturnMsg(Receipts, AllLogs, ErrorTxList, nil, UsedGas, RootHash)
+	PReturnMsg.STMStats = &stm.stats
+	PReturnMsg.FeeSummary = Fees
+	return PReturnMsg, nil
+}
+
+// processSerial 按区块顺序在单个线程中串行执行所有交易
+func (p *Processor) processSerial(block *types.Block, statedb *state.StateDB, cfg evm.Config) (*ProcessReturnMsg, error) {
+	var (
+		Header  = block.Header()
+		UsedGas = new(uint64)
+		wg      sync.WaitGroup
+		ch      = make(chan MessageReturn, 1)
+	)
+	EachEvm := evm.NewEVM(NewEVMBlockContext(Header, p.blockchain, nil), evm.TxContext{}, statedb, new(evmparams.ChainConfig).FromGlobal(p.config), cfg)
+	EachThreadMessage := NewThreadMessage(p.config, block.Number(), block.Hash(), UsedGas, EachEvm, types.MakeSigner(p.config, Header.Number, Header.Time), Header, p.decryptKey)
+	wg.Add(1)
+	go TxThread(0, block.Transactions(), &wg, ch, EachThreadMessage, false)
+	wg.Wait()
+	value := <-ch
+	Fees := FinaliseFees(p.config, Header, statedb)
+
+	RootHash, err := statedb.Commit(true)
+	if err != nil {
+		fmt.Printf("%sERROR MSG%s   Commit函数出错\n", types.FRED, types.FRESET)
+		return new(ProcessReturnMsg), errors.New("commit函数出错")
+	}
+	DeriveReceiptIndexes(value.NewReceipt)
+	PReturnMsg := NewProcessReturnMsg(value.NewReceipt, value.NewLogs, value.TxError, value.TxAccessList, UsedGas, RootHash)
+	PReturnMsg.FeeSummary = Fees
+	return PReturnMsg, nil
+}
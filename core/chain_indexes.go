@@ -0,0 +1,45 @@
+package core
+
+import (
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core/rawdb"
+	"github.com/SipengXie/pangu/core/types"
+)
+
+// SetTxLookupLimit 设置保留交易索引的最近区块数，更早区块的交易索引在写入新链头时删除；0表示保留所有区块的交易索引
+func (bc *Blockchain) SetTxLookupLimit(blocks uint64) {
+	bc.chainmu.MustLock()
+	defer bc.chainmu.Unlock()
+	bc.txLookupLimit = blocks
+}
+
+// TxIndexTail 保留交易索引的最早区块高度，从未删除过交易索引时为nil
+func (bc *Blockchain) TxIndexTail() *uint64 {
+	return rawdb.ReadTxIndexTail(bc.db)
+}
+
+// GetTransaction 按哈希查找规范链上的交易，返回交易所在区块的哈希、高度与交易在区块中的序号（执行顺序，与收据的序号一致）
+// 聚合交易的内部交易同样可以查找；交易不存在或索引已经删除时返回nil
+func (bc *Blockchain) GetTransaction(hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64) {
+	return rawdb.ReadTransaction(bc.db, hash)
+}
+
+// GetReceipt 按交易哈希查找规范链上的收据，返回收据所在区块的哈希、高度与收据在区块中的序号（执行顺序）
+// 交易不存在或索引已经删除时返回nil
+func (bc *Blockchain) GetReceipt(hash common.Hash) (*types.Receipt, common.Hash, uint64, uint64) {
+	return rawdb.ReadReceipt(bc.db, hash, bc.config)
+}
+
+// unindexTxs 链头为head时删除超出txLookupLimit的旧区块的交易索引，并记录新的索引起点
+func (bc *Blockchain) unindexTxs(head uint64) {
+	if bc.txLookupLimit == 0 || head < bc.txLookupLimit {
+		return
+	}
+	var from uint64
+	if tail := rawdb.ReadTxIndexTail(bc.db); tail != nil {
+		from = *tail
+	}
+	if to := head - bc.txLookupLimit + 1; from < to {
+		rawdb.UnindexTransactions(bc.db, from, to, nil)
+	}
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core/rawdb"
+	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/types"
+)
+
+// DefaultTriesInMemory 默认在内存中保留状态树的最近区块数
+const DefaultTriesInMemory = 128
+
+// ErrMissingState 状态根对应的状态树已经释放或从未写入
+var ErrMissingState = errors.New("missing state")
+
+// SetTriesInMemory 设置状态树保留在内存中的最近区块数
+// 离开窗口的规范链状态写入磁盘，分叉上的状态直接释放；0表示每个区块的状态都直接写入磁盘
+func (bc *Blockchain) SetTriesInMemory(blocks uint64) {
+	bc.chainmu.MustLock()
+	defer bc.chainmu.Unlock()
+	bc.triesInMemory = blocks
+}
+
+// HasState 状态根对应的状态是否可以打开，包括内存中保留的与已经写入磁盘的
+func (bc *Blockchain) HasState(root common.Hash) bool {
+	_, err := bc.stateCache.OpenTrie(root)
+	return err == nil
+}
+
+// StateAt 在状态根root上打开一个独立的StateDB，对它的修改不影响链上的状态与其他调用者
+func (bc *Blockchain) StateAt(root common.Hash) (*state.StateDB, error) {
+	statedb, err := state.New(root, bc.stateCache, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: root %x: %v", ErrMissingState, root, err)
+	}
+	return statedb, nil
+}
+
+// StateAtBlock 打开规范链上高度为number的区块执行后的状态
+func (bc *Blockchain) StateAtBlock(number uint64) (*state.StateDB, error) {
+	hash := rawdb.ReadCanonicalHash(bc.db, number)
+	if hash == (common.Hash{}) {
+		return nil, fmt.Errorf("%w: number %d", ErrUnknownBlock, number)
+	}
+	return bc.StateAtBlockHash(hash)
+}
+
+// StateAtBlockHash 打开哈希为hash的区块执行后的状态，区块可以在分叉上
+func (bc *Blockchain) StateAtBlockHash(hash common.Hash) (*state.StateDB, error) {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownBlock, hash)
+	}
+	header := bc.GetHeader(hash, *number)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownBlock, hash)
+	}
+	return bc.StateAt(header.StateRoot)
+}
+
+// retainState 在内存中保留区块的状态树，超出窗口的状态写入磁盘（规范链）或释放（分叉）
+func (bc *Blockchain) retainState(block *types.Block) error {
+	triedb := bc.stateCache.TrieDB()
+	if bc.triesInMemory == 0 {
+		return triedb.Commit(block.StateRoot(), false)
+	}
+	if err := triedb.Reference(block.StateRoot(), common.Hash{}); err != nil {
+		return err
+	}
+	bc.triegc.Push(block.StateRoot(), -int64(block.NumberU64()))
+
+	current := block.NumberU64()
+	if current <= bc.triesInMemory {
+		return nil
+	}
+	chosen := current - bc.triesInMemory
+	// 规范链上离开窗口的状态写入磁盘，之后仍然可以打开
+	if hash := rawdb.ReadCanonicalHash(bc.db, chosen); hash != (common.Hash{}) {
+		if header := bc.GetHeader(hash, chosen); header != nil {
+			if err := triedb.Commit(header.StateRoot, false); err != nil {
+				return err
+			}
+		}
+	}
+	// 窗口之外的状态从内存中释放，已经写入磁盘的不受影响
+	for !bc.triegc.Empty() {
+		root, number := bc.triegc.Pop()
+		if uint64(-number) > chosen {
+			bc.triegc.Push(root, number)
+			break
+		}
+		triedb.Dereference(root)
+	}
+	return nil
+}
+
+// repairHead 从head开始向前找到第一个状态完整的区块作为链头，之后的规范链区块连同交易索引一起删除，由共识层重新同步
+func (bc *Blockchain) repairHead(head *types.Block) (*types.Block, error) {
+	var (
+		repaired = head
+		dropped  types.Blocks
+	)
+	for !bc.HasState(repaired.StateRoot()) {
+		if repaired.NumberU64() == 0 {
+			return nil, fmt.Errorf("%w: genesis state", ErrMissingState)
+		}
+		dropped = append(dropped, repaired)
+		if repaired = rawdb.ReadBlock(bc.db, repaired.ParentHash(), repaired.NumberU64()-1); repaired == nil {
+			return nil, fmt.Errorf("%w: ancestor of %x", ErrUnknownAncestor, head.Hash())
+		}
+	}
+	if len(dropped) == 0 {
+		return head, nil
+	}
+	fmt.Printf("%sPROMPT MSG%s   区块 %d 的状态不完整，链头回退到区块 %d\n", types.FGREEN, types.FRESET, head.NumberU64(), repaired.NumberU64())
+	batch := bc.db.NewBatch()
+	for _, block := range dropped {
+		rawdb.DeleteTxLookupEntries(batch, block.Transactions().LookupHashes())
+		rawdb.DeleteBlock(batch, block.Hash(), block.NumberU64())
+		rawdb.DeleteCanonicalHash(batch, block.NumberU64())
+	}
+	rawdb.WriteHeadBlockHash(batch, repaired.Hash())
+	rawdb.WriteHeadHeaderHash(batch, repaired.Hash())
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	return repaired, nil
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/SipengXie/pangu/accesslist"
+	"github.com/SipengXie/pangu/core/evm"
+	evmparams "github.com/SipengXie/pangu/core/evm/params"
+	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/params"
+)
+
+// maxAccessListRounds 生成AccessList时最多模拟执行的次数
+const maxAccessListRounds = 8
+
+var ErrAccessListUnstable = errors.New("access list did not converge")
+
+// AccessListResult CreateAccessList的返回值
+type AccessListResult struct {
+	AccessList *accesslist.AccessList // 交易应当声明的AccessList，按它声明时不会被收取惩罚汽油
+	GasUsed    uint64                 // 声明该AccessList时交易使用的汽油
+	Rounds     int                    // 模拟执行的次数
+}
+
+// CreateAccessList 在statedb的副本上串行模拟执行交易，返回交易实际访问的AccessList以及使用的汽油，不修改statedb
+// 声明的AccessList会改变IntrinsicGas，从而可能改变执行路径，因此用上一次得到的AccessList作为声明重新模拟，直到AccessList不再变化
+// 交易没有指定汽油价格时按零价格、零基础费模拟，不要求发送方有足够的余额支付汽油费
+func CreateAccessList(config *params.ChainConfig, chain ChainContext, header *types.Header, statedb *state.StateDB, msg *TxMessage, cfg evm.Config) (*AccessListResult, error) {
+	if msg.GasPrice == nil || msg.GasPrice.Sign() == 0 {
+		header = types.CopyHeader(header)
+		header.BaseFee = new(big.Int)
+	}
+	Declared := msg.AccessList
+	if Declared == nil {
+		Declared = accesslist.NewAccessList()
+	}
+	for Round := 1; Round <= maxAccessListRounds; Round++ {
+		SimMsg := *msg
+		SimMsg.AccessList = Declared
+		TrueAccessList, UsedGas, err := simulateTx(config, chain, header, statedb.Copy(), &SimMsg, cfg)
+		if err != nil {
+			fmt.Printf("%sERROR MSG%s   生成AccessList时交易模拟执行出错\n", types.FRED, types.FRESET)
+			return nil, err
+		}
+		Actual := actualAccessList(&SimMsg, TrueAccessList)
+		if Actual.Equal(Declared) {
+			return &AccessListResult{AccessList: Actual, GasUsed: UsedGas, Rounds: Round}, nil
+		}
+		Declared = Actual
+	}
+	return nil, fmt.Errorf("%w after %d rounds", ErrAccessListUnstable, maxAccessListRounds)
+}
+
+// simulateTx 在statedb上串行模拟执行一次交易，返回解释器记录的TrueAccessList与使用的汽油，会修改statedb，调用方需要传入副本
+func simulateTx(config *params.ChainConfig, chain ChainContext, header *types.Header, statedb *state.StateDB, msg *TxMessage, cfg evm.Config) (*accesslist.AccessList, uint64, error) {
+	msg.IsParallel = false
+	msg.CanParallel = false
+	if msg.GasPrice == nil {
+		msg.GasPrice = new(big.Int)
+	}
+	if msg.GasFeeCap == nil {
+		msg.GasFeeCap = new(big.Int)
+	}
+	if msg.GasTipCap == nil {
+		msg.GasTipCap = new(big.Int)
+	}
+	if msg.Value == nil {
+		msg.Value = new(big.Int)
+	}
+	EVM := evm.NewEVM(NewEVMBlockContext(header, chain, nil), NewEVMTxContext(msg), statedb, new(evmparams.ChainConfig).FromGlobal(config), cfg)
+	Result := ApplyTransaction(msg, EVM)
+	if Result.Err != nil {
+		return nil, Result.UsedGas, Result.Err
+	}
+	return Result.TrueAccessList, Result.UsedGas, nil
+}
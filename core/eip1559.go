@@ -0,0 +1,105 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/params"
+)
+
+var ErrInvalidBaseFee = errors.New("invalid base fee")
+
+// CalcBaseFee 根据父区块的汽油使用量计算下一个区块的基础费（EIP-1559）
+// 目标汽油使用量为 GasLimit / ElasticityMultiplier，父区块超过目标时基础费上涨，低于目标时下降，每个区块最多变化 1/BaseFeeChangeDenominator
+// 父区块没有基础费（创世区块）时返回InitialBaseFee
+func CalcBaseFee(config *params.ChainConfig, parent *types.Header) *big.Int {
+	if parent.BaseFee == nil {
+		return new(big.Int).SetUint64(params.InitialBaseFee)
+	}
+	ParentGasTarget := parent.GasLimit / params.DefaultElasticityMultiplier
+	if ParentGasTarget == 0 || parent.GasUsed == ParentGasTarget {
+		return new(big.Int).Set(parent.BaseFee)
+	}
+
+	var (
+		Num   = new(big.Int)
+		Denom = new(big.Int)
+	)
+	if parent.GasUsed > ParentGasTarget {
+		// 父区块超过目标，基础费上涨，至少上涨1
+		Num.SetUint64(parent.GasUsed - ParentGasTarget)
+		Num.Mul(Num, parent.BaseFee)
+		Num.Div(Num, Denom.SetUint64(ParentGasTarget))
+		Num.Div(Num, Denom.SetUint64(params.DefaultBaseFeeChangeDenominator))
+		if Num.Cmp(common.Big1) < 0 {
+			Num.Set(common.Big1)
+		}
+		return Num.Add(parent.BaseFee, Num)
+	}
+	// 父区块低于目标，基础费下降，最低为0
+	Num.SetUint64(ParentGasTarget - parent.GasUsed)
+	Num.Mul(Num, parent.BaseFee)
+	Num.Div(Num, Denom.SetUint64(ParentGasTarget))
+	Num.Div(Num, Denom.SetUint64(params.DefaultBaseFeeChangeDenominator))
+	BaseFee := Num.Sub(parent.BaseFee, Num)
+	if BaseFee.Sign() < 0 {
+		BaseFee.SetUint64(0)
+	}
+	return BaseFee
+}
+
+// VerifyEIP1559Header 检查区块头中的基础费是否等于根据父区块计算出的值
+func VerifyEIP1559Header(config *params.ChainConfig, parent, header *types.Header) error {
+	if header.BaseFee == nil {
+		return fmt.Errorf("%w: header is missing baseFee", ErrInvalidBaseFee)
+	}
+	if expected := CalcBaseFee(config, parent); header.BaseFee.Cmp(expected) != 0 {
+		return fmt.Errorf("%w: have %s, want %s, parentBaseFee %s, parentGasUsed %d", ErrInvalidBaseFee, header.BaseFee, expected, parent.BaseFee, parent.GasUsed)
+	}
+	return nil
+}
+
+// FeeAccounts 区块内收取汽油费的账户：coinbase收取小费，配置了FeeCollector时基础费转给FeeCollector，否则销毁
+func FeeAccounts(config *params.ChainConfig, header *types.Header) []common.Address {
+	Accounts := []common.Address{header.Coinbase}
+	if config.FeeCollector != nil && *config.FeeCollector != header.Coinbase {
+		Accounts = append(Accounts, *config.FeeCollector)
+	}
+	return Accounts
+}
+
+// FeeSummary 一个区块的汽油费汇总，由各执行线程累计的可交换余额增量合并而来
+type FeeSummary struct {
+	Credits   map[common.Address]*big.Int // 每个收费账户在本区块中增加的余额
+	Tips      *big.Int                    // coinbase收到的小费
+	Collected *big.Int                    // FeeCollector收到的基础费
+	Burnt     *big.Int                    // 销毁的基础费
+}
+
+// FinaliseFees 汇总statedb中累计的收费增量，并在提交状态之前把增量一次性写入收费账户
+func FinaliseFees(config *params.ChainConfig, header *types.Header, statedb *state.StateDB) *FeeSummary {
+	Summary := &FeeSummary{
+		Credits:   statedb.BalanceDeltas(),
+		Tips:      new(big.Int),
+		Collected: new(big.Int),
+		Burnt:     statedb.Burnt(),
+	}
+	if Summary.Credits == nil {
+		Summary.Credits = make(map[common.Address]*big.Int)
+	}
+	if Tips, ok := Summary.Credits[header.Coinbase]; ok {
+		Summary.Tips.Set(Tips)
+	}
+	if config.FeeCollector != nil {
+		if Collected, ok := Summary.Credits[*config.FeeCollector]; ok {
+			Summary.Collected.Set(Collected)
+		}
+	}
+	statedb.FoldFeeLedger()
+	fmt.Printf("%sPROMPT MSG%s   区块汽油费汇总：小费 %v，基础费收取 %v，销毁 %v\n", types.FGREEN, types.FRESET, Summary.Tips, Summary.Collected, Summary.Burnt)
+	return Summary
+}
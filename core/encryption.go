@@ -0,0 +1,48 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core/evm"
+	"github.com/SipengXie/pangu/core/types"
+)
+
+// IsDecryptError 判断TransactionToMessage返回的错误是否是交易内容无法解密
+func IsDecryptError(err error) bool {
+	return errors.Is(err, types.ErrDecryptContent) || errors.Is(err, types.ErrInvalidEncAlgo)
+}
+
+// ExecuteUndecryptableTx 处理内容无法解密的加密交易
+// Cover上的签名是合法的，因此与执行出错的交易一样：nonce加一，不归还汽油费，生成状态为失败的收据
+func ExecuteUndecryptableTx(msg *TxMessage, blockNumber *big.Int, blockHash common.Hash, tx *types.Transaction, usedGas *uint64, evm *evm.EVM) (*types.Receipt, error) {
+	evm.TxContext = NewEVMTxContext(msg)
+	evm.StateDB.SetTxContext(tx.Hash())
+
+	// 预检查并买汽油，Cover本身不合法时不生成收据
+	if err := PreCheck(msg, evm); err != nil {
+		fmt.Printf("%sERROR MSG%s   交易执行出错 in PreCheck function\n", types.FRED, types.FRESET)
+		return nil, fmt.Errorf("%w: %w", ErrTxRejected, err)
+	}
+	evm.StateDB.SetNonce(msg.From, evm.StateDB.GetNonce(msg.From)+1)
+
+	// 按出错交易收费，担保交易按 1.5 * GasLimit 收费
+	PayFees(msg, ChargedGas(msg, msg.GasLimit, true), evm)
+
+	*usedGas += msg.GasLimit
+	receipt := &types.Receipt{
+		Type:              tx.Type(),
+		Status:            types.ReceiptStatusFailed,
+		CumulativeGasUsed: *usedGas,
+		TxHash:            tx.Hash(),
+		GasUsed:           msg.GasLimit,
+		EffectiveGasPrice: new(big.Int).Set(msg.GasPrice),
+		Logs:              []*types.Log{},
+		BlockHash:         blockHash,
+		BlockNumber:       blockNumber,
+	}
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	return receipt, nil
+}
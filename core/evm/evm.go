@@ -68,6 +68,8 @@ type TxContext struct {
 	Origin     common.Address // Provides information for ORIGIN
 	GasPrice   *big.Int       // Provides information for GASPRICE
 	BlobHashes []common.Hash  // Provides information for BLOBHASH
+
+	AccessList *accesslist.AccessList // 交易声明的AccessList，并行执行时检查实际访问是否超出声明
 }
 
 // EVM is the Ethereum Virtual Machine base object and provides
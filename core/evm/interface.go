@@ -35,6 +35,10 @@ type StateDB interface {
 	AddBalance(common.Address, *big.Int)
 	GetBalance(common.Address) *big.Int
 
+	// 可交换的收费增量，区块结束时统一写入状态
+	AddBalanceDelta(common.Address, *big.Int)
+	AddBurnt(*big.Int)
+
 	GetNonce(common.Address) uint64
 	SetNonce(common.Address, uint64)
 
@@ -74,8 +74,9 @@ func NewEVMInterpreter(evm *EVM) *EVMInterpreter {
 	//	table = &istanbulInstructionSet
 	//case evm.chainRules.IsConstantinople:
 	//	table = &constantinopleInstructionSet
-	//case evm.chainRules.IsByzantium:
-	//	table = &byzantiumInstructionSet
+	case evm.chainRules.IsByzantium:
+		// Byzantium指令集包含REVERT与RETURNDATA*，合约可以带着原因回滚
+		table = &byzantiumInstructionSet
 	//case evm.chainRules.IsEIP158:
 	//	table = &spuriousDragonInstructionSet
 	//case evm.chainRules.IsEIP150:
@@ -190,7 +191,11 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool, T
 			GetTrueAccessList(op, callContext, TrueAccessListPart)
 			// 暂时不需要合并AccessList，因为不需要更改AccessList
 
-			result, _, _, _ := TrueAccessListPart.ConflictDetection(in.evm.StateDB.GetAccessList())
+			DeclaredAL := in.evm.TxContext.AccessList
+			if DeclaredAL == nil {
+				DeclaredAL = in.evm.StateDB.GetAccessList()
+			}
+			result, _, _, _ := TrueAccessListPart.ConflictDetection(DeclaredAL)
 			if !result {
 				fmt.Printf("%sPROMPT MSG%s   Run函数执行获取到的AccessList与用户定义的AccessList不同，并行程序无法串行执行\n", types.FGREEN, types.FRESET)
 				CanParallel = false
@@ -3,20 +3,29 @@ package params
 import (
 	"math/big"
 
+	"github.com/SipengXie/pangu/common"
+
 	global "github.com/SipengXie/pangu/params"
 )
 
 type ChainConfig struct {
 	ChainID *big.Int `json:"chainId"` // chainId identifies the current chain and is used for replay protection
+
+	FeeCollector   *common.Address `json:"feeCollector,omitempty"`   // 基础费的接收地址，nil表示销毁基础费
+	ByzantiumBlock *big.Int        `json:"byzantiumBlock,omitempty"` // 从该高度起使用Byzantium指令集，nil表示一直使用Frontier指令集
 }
 
 func (c *ChainConfig) Rules(num *big.Int, timestamp uint64) Rules {
-	return Rules{}
+	return Rules{
+		IsByzantium: c.ByzantiumBlock != nil && num != nil && c.ByzantiumBlock.Cmp(num) <= 0,
+	}
 }
 
 // FromGlobal global -> evm 增加了* 增加了返回代码
 func (cfg *ChainConfig) FromGlobal(gcfg *global.ChainConfig) *ChainConfig {
 	cfg.ChainID = new(big.Int).Set(gcfg.ChainID)
+	cfg.FeeCollector = gcfg.FeeCollector
+	cfg.ByzantiumBlock = gcfg.ByzantiumBlock
 	return cfg
 }
 
@@ -27,6 +36,7 @@ func (cfg *ChainConfig) ToGlobal() global.ChainConfig {
 
 // Rules 暂时将所有执行用到这个地方的判断全部删除了
 type Rules struct {
+	IsByzantium bool
 }
 
 var (
@@ -6,25 +6,40 @@ import (
 )
 
 // GetTrueAccessList 得到当前操作实际访问到的AccessList，类型归类为*AccessList，表明可以对调用数据进行修改
+// 区分读写：SLOAD读slot，SSTORE写slot；查询余额与代码只读地址；带转账的CALL写入双方账户，SELFDESTRUCT写入合约和受益人账户
 func GetTrueAccessList(op OpCode, scope *ScopeContext, NewAL *accesslist.AccessList) {
 	stack := scope.Stack // scope ScopeContext包含每个调用的东西，比如堆栈和内存
 	stackData := stack.Data()
 	stackLen := len(stackData)
-	if (op == SLOAD || op == SSTORE) && stackLen >= 1 {
+	if op == SLOAD && stackLen >= 1 {
 		slot := common.Hash(stackData[stackLen-1].Bytes32())
-		//a.list.addSlot(scope.Contract.Address(), slot)
-		NewAL.AccessListAddSlot(scope.Contract.Address(), slot)
+		NewAL.AddReadSlot(scope.Contract.Address(), slot)
 	}
-	if (op == EXTCODECOPY || op == EXTCODEHASH || op == EXTCODESIZE || op == BALANCE || op == SELFDESTRUCT) && stackLen >= 1 {
+	if op == SSTORE && stackLen >= 1 {
+		slot := common.Hash(stackData[stackLen-1].Bytes32())
+		NewAL.AddWriteSlot(scope.Contract.Address(), slot)
+	}
+	if (op == EXTCODECOPY || op == EXTCODEHASH || op == EXTCODESIZE || op == BALANCE) && stackLen >= 1 {
 		addr := common.Address(stackData[stackLen-1].Bytes20())
-		if ok := NewAL.AccessListIsAddressExce(addr); !ok {
-			NewAL.AccessListAddAddress(addr)
-		}
+		NewAL.AddReadAddress(addr)
+	}
+	if op == SELFDESTRUCT && stackLen >= 1 {
+		addr := common.Address(stackData[stackLen-1].Bytes20())
+		NewAL.AddWriteAddress(addr)
+		NewAL.AddWriteAddress(scope.Contract.Address())
+	}
+	if (op == DELEGATECALL || op == STATICCALL || op == CALLCODE) && stackLen >= 5 {
+		// CALLCODE的转账发生在调用者自身，不修改被调用的账户
+		addr := common.Address(stackData[stackLen-2].Bytes20())
+		NewAL.AddReadAddress(addr)
 	}
-	if (op == DELEGATECALL || op == CALL || op == STATICCALL || op == CALLCODE) && stackLen >= 5 {
+	if op == CALL && stackLen >= 5 {
 		addr := common.Address(stackData[stackLen-2].Bytes20())
-		if ok := NewAL.AccessListIsAddressExce(addr); !ok {
-			NewAL.AccessListAddAddress(addr)
+		if stackData[stackLen-3].IsZero() {
+			NewAL.AddReadAddress(addr)
+		} else {
+			NewAL.AddWriteAddress(addr)
+			NewAL.AddWriteAddress(scope.Contract.Address())
 		}
 	}
 	if op == CREATE || op == CREATE2 {
@@ -1,19 +1,287 @@
 package core
 
 import (
-	"github.com/SipengXie/pangu/core/types"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
-	"time"
+	"os"
+
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/common/hexutil"
+	"github.com/SipengXie/pangu/common/math"
+	"github.com/SipengXie/pangu/core/rawdb"
+	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/ethdb"
+	"github.com/SipengXie/pangu/params"
+	"github.com/SipengXie/pangu/trie"
+)
+
+var (
+	errNoGenesis       = errors.New("genesis not found in database and no genesis specified")
+	errGenesisNoConfig = errors.New("genesis has no chain config")
 )
 
-func NewGenesisBlock() *types.Block {
+// Genesis 创世区块的描述，可以从JSON文件加载，相同的Genesis总是得到相同的创世区块与状态根
+type Genesis struct {
+	Config    *params.ChainConfig `json:"config"`
+	Timestamp uint64              `json:"timestamp"`
+	GasLimit  uint64              `json:"gasLimit"` // 为0时使用params.GenesisGasLimit
+	BaseFee   *big.Int            `json:"baseFeePerGas"`
+	ExtraData []byte              `json:"extraData"`
+	Alloc     GenesisAlloc        `json:"alloc"`
+}
+
+// GenesisAlloc 创世状态中各账户的初始内容
+type GenesisAlloc map[common.Address]GenesisAccount
+
+// GenesisAccount 创世状态中的一个账户
+type GenesisAccount struct {
+	Code    []byte                      `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+	Balance *big.Int                    `json:"balance"`
+	Nonce   uint64                      `json:"nonce,omitempty"`
+}
+
+// genesisJSON Genesis的JSON格式，数值可以写成十进制或0x开头的十六进制
+type genesisJSON struct {
+	Config    *params.ChainConfig                         `json:"config"`
+	Timestamp math.HexOrDecimal64                         `json:"timestamp"`
+	GasLimit  math.HexOrDecimal64                         `json:"gasLimit"`
+	BaseFee   *math.HexOrDecimal256                       `json:"baseFeePerGas"`
+	ExtraData hexutil.Bytes                               `json:"extraData"`
+	Alloc     map[common.UnprefixedAddress]genesisAccount `json:"alloc"`
+}
+
+type genesisAccount struct {
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+	Balance *math.HexOrDecimal256       `json:"balance"`
+	Nonce   math.HexOrDecimal64         `json:"nonce,omitempty"`
+}
+
+// MarshalJSON 将Genesis编码为JSON
+func (g *Genesis) MarshalJSON() ([]byte, error) {
+	enc := genesisJSON{
+		Config:    g.Config,
+		Timestamp: math.HexOrDecimal64(g.Timestamp),
+		GasLimit:  math.HexOrDecimal64(g.GasLimit),
+		BaseFee:   (*math.HexOrDecimal256)(g.BaseFee),
+		ExtraData: g.ExtraData,
+		Alloc:     make(map[common.UnprefixedAddress]genesisAccount, len(g.Alloc)),
+	}
+	for addr, account := range g.Alloc {
+		enc.Alloc[common.UnprefixedAddress(addr)] = genesisAccount{
+			Code:    account.Code,
+			Storage: account.Storage,
+			Balance: (*math.HexOrDecimal256)(account.Balance),
+			Nonce:   math.HexOrDecimal64(account.Nonce),
+		}
+	}
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON 从JSON解码Genesis
+func (g *Genesis) UnmarshalJSON(input []byte) error {
+	var dec genesisJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	g.Config = dec.Config
+	g.Timestamp = uint64(dec.Timestamp)
+	g.GasLimit = uint64(dec.GasLimit)
+	g.BaseFee = (*big.Int)(dec.BaseFee)
+	g.ExtraData = dec.ExtraData
+	g.Alloc = make(GenesisAlloc, len(dec.Alloc))
+	for addr, account := range dec.Alloc {
+		if account.Balance == nil {
+			return fmt.Errorf("missing balance of genesis account %x", common.Address(addr))
+		}
+		g.Alloc[common.Address(addr)] = GenesisAccount{
+			Code:    account.Code,
+			Storage: account.Storage,
+			Balance: (*big.Int)(account.Balance),
+			Nonce:   uint64(account.Nonce),
+		}
+	}
+	return nil
+}
+
+// LoadGenesis 从JSON文件加载Genesis
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	genesis := new(Genesis)
+	if err := json.Unmarshal(data, genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %w", path, err)
+	}
+	if genesis.Config == nil {
+		return nil, fmt.Errorf("invalid genesis file %s: missing chain config", path)
+	}
+	return genesis, nil
+}
+
+// GenesisMismatchError 数据库中的创世区块与指定的Genesis不一致
+type GenesisMismatchError struct {
+	Stored, New common.Hash
+}
+
+func (e *GenesisMismatchError) Error() string {
+	return fmt.Sprintf("database contains incompatible genesis (have %x, new %x)", e.Stored, e.New)
+}
+
+// ConfigMismatchError 数据库中的链配置与指定Genesis的链配置不一致，并且没有要求覆盖
+type ConfigMismatchError struct {
+	Stored, New *params.ChainConfig
+}
+
+func (e *ConfigMismatchError) Error() string {
+	stored, _ := json.Marshal(e.Stored)
+	new, _ := json.Marshal(e.New)
+	return fmt.Sprintf("database contains incompatible chain config (have %s, new %s)", stored, new)
+}
+
+// apply 把Alloc写入statedb
+func (ga GenesisAlloc) apply(statedb *state.StateDB) {
+	for addr, account := range ga {
+		if account.Balance != nil {
+			statedb.SetBalance(addr, account.Balance)
+		}
+		statedb.SetCode(addr, account.Code)
+		statedb.SetNonce(addr, account.Nonce)
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+	}
+}
+
+// toBlock 由Genesis的参数与创世状态根生成创世区块
+func (g *Genesis) toBlock(root common.Hash) *types.Block {
 	header := &types.Header{
-		ParentHash: types.EmptyRootHash,
-		Time:       uint64(time.Now().Unix()),
-		Number:     big.NewInt(0),
-		GasLimit:   12345678,
-	}
-	txs := make([]types.Transactions, 0)
-	b := types.InitBlock(header, txs)
-	return b
+		Number:   new(big.Int),
+		Time:     g.Timestamp,
+		GasLimit: g.GasLimit,
+		BaseFee:  g.BaseFee,
+		Extra:    g.ExtraData,
+	}
+	if header.GasLimit == 0 {
+		header.GasLimit = params.GenesisGasLimit
+	}
+	if header.BaseFee == nil {
+		header.BaseFee = new(big.Int).SetUint64(params.InitialBaseFee)
+	}
+	return types.NewBlock(header, nil, nil, nil, root, trie.NewStackTrie(nil))
+}
+
+// ToBlock 在内存中计算创世状态根并返回创世区块，不写入任何数据库
+func (g *Genesis) ToBlock() (*types.Block, error) {
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		return nil, err
+	}
+	g.Alloc.apply(statedb)
+	root, err := statedb.Commit(true)
+	if err != nil {
+		return nil, err
+	}
+	return g.toBlock(root), nil
+}
+
+// Commit 把创世状态提交到db，创世区块与链配置通过rawdb写入db并设为链头
+func (g *Genesis) Commit(db ethdb.Database) (*types.Block, error) {
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(db), nil)
+	if err != nil {
+		return nil, err
+	}
+	return g.commit(db, statedb)
+}
+
+// commit 在statedb已有内容的基础上写入Alloc并提交，statedb必须建立在db之上，提交后不能再继续使用
+func (g *Genesis) commit(db ethdb.Database, statedb *state.StateDB) (*types.Block, error) {
+	g.Alloc.apply(statedb)
+	root, err := statedb.Commit(true)
+	if err != nil {
+		return nil, err
+	}
+	if err := statedb.Database().TrieDB().Commit(root, false); err != nil {
+		return nil, err
+	}
+	block := g.toBlock(root)
+
+	batch := db.NewBatch()
+	rawdb.WriteBlock(batch, block)
+	rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), nil)
+	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
+	rawdb.WriteHeadBlockHash(batch, block.Hash())
+	rawdb.WriteHeadHeaderHash(batch, block.Hash())
+	rawdb.WriteChainConfig(batch, block.Hash(), g.Config)
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// SetupGenesisBlock 返回db中链的配置与创世区块哈希
+// db中还没有链时提交genesis；已有链时genesis可以为nil，否则它的创世区块与链配置都必须与db中的一致
+func SetupGenesisBlock(db ethdb.Database, genesis *Genesis) (*params.ChainConfig, common.Hash, error) {
+	return SetupGenesisBlockWithOverride(db, genesis, false)
+}
+
+// SetupGenesisBlockWithOverride 与SetupGenesisBlock相同，overrideConfig为true时用genesis的链配置覆盖db中不一致的链配置
+func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, overrideConfig bool) (*params.ChainConfig, common.Hash, error) {
+	// 没有链配置的genesis不能写入数据库，也不能覆盖已有的链配置
+	if genesis != nil && genesis.Config == nil {
+		return nil, common.Hash{}, errGenesisNoConfig
+	}
+	stored := rawdb.ReadCanonicalHash(db, 0)
+	if stored == (common.Hash{}) {
+		if genesis == nil {
+			return nil, common.Hash{}, errNoGenesis
+		}
+		fmt.Printf("%sPROMPT MSG%s   写入创世区块\n", types.FGREEN, types.FRESET)
+		block, err := genesis.Commit(db)
+		if err != nil {
+			return nil, common.Hash{}, err
+		}
+		return genesis.Config, block.Hash(), nil
+	}
+	if genesis == nil {
+		config := rawdb.ReadChainConfig(db, stored)
+		if config == nil {
+			return nil, stored, fmt.Errorf("missing chain config of genesis %x", stored)
+		}
+		return config, stored, nil
+	}
+	block, err := genesis.ToBlock()
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	if block.Hash() != stored {
+		return nil, stored, &GenesisMismatchError{Stored: stored, New: block.Hash()}
+	}
+	// db中缺少链配置时写入genesis的配置，不一致时只有明确要求覆盖才以genesis为准
+	// 两者一致时不重写
+	config := rawdb.ReadChainConfig(db, stored)
+	if config != nil && sameChainConfig(config, genesis.Config) {
+		return config, stored, nil
+	}
+	if config != nil {
+		if !overrideConfig {
+			return config, stored, &ConfigMismatchError{Stored: config, New: genesis.Config}
+		}
+		fmt.Printf("%sPROMPT MSG%s   按指定的genesis覆盖数据库中的链配置\n", types.FGREEN, types.FRESET)
+	}
+	rawdb.WriteChainConfig(db, stored, genesis.Config)
+	return genesis.Config, stored, nil
+}
+
+// sameChainConfig 两个链配置的JSON编码是否相同
+func sameChainConfig(a, b *params.ChainConfig) bool {
+	encA, errA := json.Marshal(a)
+	encB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encA, encB)
 }
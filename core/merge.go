@@ -0,0 +1,86 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/types"
+)
+
+// MergePolicy 并行组写集合发生冲突时的处理策略，由链配置的MergePolicy规定
+type MergePolicy byte
+
+const (
+	MergeDemote MergePolicy = iota // 冲突组降级到串行队列重新执行（默认）
+	MergeFail                      // 冲突组直接使Process返回错误
+)
+
+var ErrGroupConflict = errors.New("parallel groups have overlapping write sets")
+
+// GroupMergeResult 单个并行组的合并结果
+type GroupMergeResult struct {
+	GroupID  int
+	Merged   bool             // 是否成功合并到区块状态
+	WriteSet []common.Address // 该组的写集合（不包含只修改了余额的收费账户）
+	Conflict []common.Address // 与之前已合并组冲突的地址
+}
+
+// MergeGroupStates 按组号顺序将每个并行组的独立StateDB合并到区块的基础状态base中
+// 每组的写集合必须与之前已合并组的写集合互不相交，否则该组被降级（MergeDemote）或返回错误（MergeFail）
+// 汽油费以可交换增量的形式记录在各组的账本中，合并成功的组把账本累加到base，降级的组重新执行时再记录
+// 收费账户feeAccounts（coinbase、基础费接收地址）因转账等只有余额变化时同样视为可交换的增量，不参与冲突检测，直接把余额差值累加到base
+// 合并只比较写集合，不比较读集合：一组读取另一组写入的项不会在这里发现，由执行时保证不会出现
+// 并行执行时解释器检查每次访问，访问未声明的地址或slot、写入声明为只读的项的交易都会被降级，因此组内实际读取的项都已声明，
+// 而ClassifyTx把声明读取某项的交易与写入该项的交易分在同一组；按区块携带的布局验证时，各组同样只能看到区块开始时的状态
+func MergeGroupStates(base *state.StateDB, groups []*state.StateDB, feeAccounts []common.Address, policy MergePolicy) ([]*GroupMergeResult, error) {
+	var (
+		written     = make(map[common.Address]int) // 已合并的地址 -> 组号
+		results     = make([]*GroupMergeResult, len(groups))
+		baseBalance = make(map[common.Address]*big.Int, len(feeAccounts))
+		credited    = make(map[common.Address]bool, len(feeAccounts)) // 收费账户是否已经以增量方式累加过余额
+	)
+	for _, addr := range feeAccounts {
+		baseBalance[addr] = base.GetBalance(addr)
+	}
+	for i, group := range groups {
+		group.Finalise(true)
+		res := &GroupMergeResult{GroupID: i}
+		results[i] = res
+
+		feeDeltas := make(map[common.Address]*big.Int)
+		for _, addr := range group.WriteSet() {
+			if before, ok := baseBalance[addr]; ok && group.IsBalanceOnlyChange(addr, base) {
+				feeDeltas[addr] = new(big.Int).Sub(group.GetBalance(addr), before)
+				continue
+			}
+			res.WriteSet = append(res.WriteSet, addr)
+			if _, ok := written[addr]; ok || credited[addr] {
+				res.Conflict = append(res.Conflict, addr)
+			}
+		}
+		if len(res.Conflict) != 0 {
+			fmt.Printf("%sERROR MSG%s   第 %d 组并行交易的写集合与其他组冲突，冲突地址 %v\n", types.FRED, types.FRESET, i, res.Conflict)
+			if policy == MergeFail {
+				return results, fmt.Errorf("%w: group %d, address %v", ErrGroupConflict, i, res.Conflict[0])
+			}
+			continue
+		}
+		for _, addr := range res.WriteSet {
+			written[addr] = i
+		}
+		base.MergeStateObjects(group, res.WriteSet)
+		base.MergeFeeLedger(group)
+		for _, addr := range feeAccounts {
+			if delta := feeDeltas[addr]; delta != nil && delta.Sign() != 0 {
+				base.AddBalance(addr, delta)
+				credited[addr] = true
+			}
+		}
+		res.Merged = true
+	}
+	base.Finalise(true)
+	return results, nil
+}
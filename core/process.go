@@ -4,6 +4,7 @@ package core
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"math/big"
@@ -21,9 +22,13 @@ import (
 )
 
 // Processor 执行器
+// 重新并行执行的轮数与写集合冲突的处理策略决定执行布局，由链配置规定，不是单个执行器的选项
 type Processor struct {
 	config     *params.ChainConfig // 链配置
 	blockchain *Blockchain         // 区块链
+	strategy   ExecStrategy        // 交易执行策略
+	workers    int                 // 执行线程数：并行组worker池的大小或Block-STM的线程数，0表示使用CPU核数
+	decryptKey *ecdsa.PrivateKey   // 执行者私钥，用于解密加密交易的内容
 }
 
 // NewStateProcessor 初始化一个交易执行器
@@ -34,9 +39,28 @@ func NewStateProcessor(config *params.ChainConfig, bc *Blockchain) *Processor {
 	}
 }
 
+// SetStrategy 设置交易执行策略，workers为执行线程数（并行组worker池的大小或Block-STM的线程数），0表示使用CPU核数
+func (p *Processor) SetStrategy(strategy ExecStrategy, workers int) {
+	p.strategy = strategy
+	p.workers = workers
+}
+
+// SetDecryptKey 设置执行者私钥，加密交易的内容在执行前使用它解密
+func (p *Processor) SetDecryptKey(key *ecdsa.PrivateKey) {
+	p.decryptKey = key
+}
+
 // Process * 注意，该函数不是验证函数
 // Process 执行函数，该函数作为第一次执行交易的函数，而不是验证函数；验证函数接收到的分组结果应该是Process函数中最后运行的结果
 func (p *Processor) Process(block *types.Block, statedb *state.StateDB, cfg evm.Config) (*ProcessReturnMsg, error) {
+	if p.strategy == StrategySTM {
+		return p.ProcessSTM(block, statedb, cfg)
+	}
+	return p.processGroups(block, statedb, cfg)
+}
+
+// processGroups 按区块中的二维分组逐轮并行执行，冲突组按合并策略处理，返回结果中包含执行布局
+func (p *Processor) processGroups(block *types.Block, statedb *state.StateDB, cfg evm.Config) (*ProcessReturnMsg, error) {
 	// 获取到的当前区块所有的交易序列（已分好组）
 	TXS := block.Transactions2D()
 
@@ -47,60 +71,45 @@ func (p *Processor) Process(block *types.Block, statedb *state.StateDB, cfg evm.
 		BlockHash        = block.Hash()
 		BlockNumber      = block.Number()
 		AllLogs          []*types.Log
-		EvmContext       = NewEVMBlockContext(Header, p.blockchain, nil)          // evm环境
 		Signer           = types.MakeSigner(p.config, Header.Number, Header.Time) // 签名者
-		GroupNum         = len(TXS)                                               // 组数
 		PReturnMsg       = new(ProcessReturnMsg)                                  // 函数返回值
-		ReturnChan1      = make(chan MessageReturn, GroupNum)                     // 并行组返回通道
 		ReturnChan2      = make(chan MessageReturn, 1)                            // 串行组返回通道
-		wg1              sync.WaitGroup                                           // 并行组等待组
 		wg2              sync.WaitGroup                                           // 串行组等待组
-		AllEvm           []*evm.EVM                                               // 存储所有线程的evm
 		SerialTxList     []*types.Transaction                                     // 串行交易队列
 		ErrorTxList      []*TxErrorMessage                                        // 执行出现错误的交易队列
 		AccessListTxList []*TxAccessListMessage                                   // 串行队列AccessList不一致的交易
-		// AllStateDB  []*state.StateDB                     // 存储所有线程的stateDB
+		Rounds           []*ExecRound                                             // 每一轮并行执行的分组与合并结果
+		WorkerStats      []*WorkerStats                                           // 各轮累计的worker统计
 	)
 
-	// 为每个线程拷贝一份EVM
-	for range TXS {
-		// 现在的p.config是global，转为evm的config
-		EachEvm := evm.NewEVM(EvmContext, evm.TxContext{}, statedb, new(evmparams.ChainConfig).FromGlobal(p.config), cfg)
-		AllEvm = append(AllEvm, EachEvm)
-		// 等待组+1
-		wg1.Add(1)
-	}
+	// 区块的基础状态，所有并行组都在它的副本上执行
+	statedb.Finalise(true)
 
 	fmt.Printf("\n%sSTAGE CHANGE%s   交易开始并行处理 <<< \n", types.FBLUE, types.FRESET) // ! 统一消息提示格式：英文概要大写   （空三格）中文描述具体内容 1 ERROR MSG 红色，错误提示信息；2 %sSTAGE CHANGE%s 蓝色，程序执行步骤阶段提示；3 PROMPT MSG 绿色，提示信息，用于一些小的信息提示
 
-	for i, EachTXS := range TXS {
-		EachThreadMessage := NewThreadMessage(p.config, BlockNumber, BlockHash, UsedGas, AllEvm[i], Signer, Header)
-		go TxThread(i, EachTXS, &wg1, ReturnChan1, EachThreadMessage, true) // IsParallel = true 表示并行分组
-	}
-
-	wg1.Wait()
-
-	fmt.Printf("\n%sSTAGE CHANGE%s   并行交易结果处理 <<< \n", types.FBLUE, types.FRESET)
-
-	// 提交stateDB状态到内存
-	for _, value := range AllEvm {
-		value.StateDB.Finalise(true)
-		spo, so := value.StateDB.GetPendingObj()
-		statedb.SetPendingObj(spo)
-		statedb.UpdateStateObj(so)
-	}
-
-	if len(ReturnChan1) == 0 {
-		fmt.Printf("%sERROR MSG%s   并行线程的返回通道中没有返回值", types.FRED, types.FRESET)
-		return PReturnMsg, errors.New("no Return Message in Parallel Channel")
-	}
-	for value := range ReturnChan1 {
-		fmt.Printf("%sPROMPT MSG%s   收到一组并行交易的返回值，开始处理\n", types.FGREEN, types.FRESET)
-		Receipts = append(Receipts, value.NewReceipt...)       // 收据树
-		AllLogs = append(AllLogs, value.NewLogs...)            // 日志
-		SerialTxList = append(SerialTxList, value.TxSerial...) // 串行队列
-		ErrorTxList = append(ErrorTxList, value.TxError...)    // 执行出现错误的交易队列
-		if len(ReturnChan1) == 0 {
+	// 第0轮执行区块中的分组，之后每一轮把上一轮降级的交易按实际访问集合重新分组并行执行，超过轮数上限后剩余的交易进入串行队列
+	var CheckALs map[common.Hash]*accesslist.AccessList
+	for Round := 0; ; Round++ {
+		Exec, Result, err := p.executeRound(Round, TXS, statedb, UsedGas, Header, BlockHash, BlockNumber, Signer, cfg, CheckALs)
+		Rounds = append(Rounds, Exec)
+		if err != nil {
+			return PReturnMsg, err
+		}
+		Receipts = append(Receipts, Result.Receipts...)
+		AllLogs = append(AllLogs, Result.Logs...)
+		ErrorTxList = append(ErrorTxList, Result.Errors...)
+		AccessListTxList = append(AccessListTxList, Result.AccessLists...)
+		WorkerStats = addWorkerStats(WorkerStats, Result.Stats)
+
+		if len(Result.Demoted) == 0 || Round >= ReexecRounds(p.config) {
+			SerialTxList = append(SerialTxList, Result.Demoted...)
+			break
+		}
+		fmt.Printf("\n%sSTAGE CHANGE%s   第 %d 轮：%d 笔降级交易按实际访问集合重新分组 <<< \n", types.FBLUE, types.FRESET, Round+1, len(Result.Demoted))
+		var Residual types.Transactions
+		TXS, Residual, CheckALs = p.regroupDemoted(Result.Demoted, statedb, Header, Signer, cfg)
+		SerialTxList = append(SerialTxList, Residual...)
+		if len(TXS) == 0 {
 			break
 		}
 	}
@@ -111,8 +120,9 @@ func (p *Processor) Process(block *types.Block, statedb *state.StateDB, cfg evm.
 		fmt.Printf("%sPROMPT MSG%s   串行队列中存在 %d 笔交易\n", types.FGREEN, types.FRESET, len(SerialTxList))
 
 		SortSerialTX(SerialTxList) // 串行队列排序
-		EachEvm := evm.NewEVM(EvmContext, evm.TxContext{}, statedb, new(evmparams.ChainConfig).FromGlobal(p.config), cfg)
-		EachThreadMessage := NewThreadMessage(p.config, BlockNumber, BlockHash, UsedGas, EachEvm, Signer, Header)
+		EachEvm := evm.NewEVM(NewEVMBlockContext(Header, p.blockchain, nil), evm.TxContext{}, statedb, new(evmparams.ChainConfig).FromGlobal(p.config), cfg)
+		EachThreadMessage := NewThreadMessage(p.config, BlockNumber, BlockHash, UsedGas, EachEvm, Signer, Header, p.decryptKey)
+		EachThreadMessage.Demoted = true // 串行队列中的交易都是从并行组降级的
 
 		// 执行串行交易
 		wg2.Add(1)
@@ -135,29 +145,62 @@ func (p *Processor) Process(block *types.Block, statedb *state.StateDB, cfg evm.
 		fmt.Printf("\n%sSTAGE CHANGE%s   串行交易队列长度为零，不需要执行串行队列交易 <<< \n", types.FBLUE, types.FRESET)
 	}
 
+	// 各组与串行队列累计的收费增量一次性写入收费账户
+	Fees := FinaliseFees(p.config, Header, statedb)
+
 	// stateDB commit
 	RootHash, err := statedb.Commit(true) // ? BlockHash 放在哪里？
 	fmt.Printf("%sPROMPT MSG%s   RootHash = %v\n", types.FGREEN, types.FRESET, RootHash)
 	if err != nil {
-		fmt.Printf("%sERROR MSG%s   Commit函数出错\n", types.FRED, types.FRESET)
+		fmt.Printf("%sERROR MSG%s   Commit函数出错 err = %v\n", types.FRED, types.FRESET, err)
 		return PReturnMsg, errors.New("commit函数出错")
 	}
 
 	fmt.Printf("\n%sSTAGE CHANGE%s   Process函数执行完成 <<< \n", types.FBLUE, types.FRESET)
+	// 按规范顺序设置收据序号与累计汽油费
+	DeriveReceiptIndexes(Receipts)
 	PReturnMsg = NewProcessReturnMsg(Receipts, AllLogs, ErrorTxList, AccessListTxList, UsedGas, RootHash) // Process函数返回值
+	PReturnMsg.MergeResult = Rounds[0].MergeResult
+	PReturnMsg.WorkerStats = WorkerStats
+	PReturnMsg.FeeSummary = Fees
+	PReturnMsg.Rounds = Rounds
+	for _, tx := range SerialTxList {
+		PReturnMsg.SerialLane = append(PReturnMsg.SerialLane, tx.Hash())
+	}
 	return PReturnMsg, nil
 }
 
 // TxThread 线程池执行交易，新增参数 IsParallel bool 表明当前交易队列是否是并行 true -> 并行，false -> 串行
 func TxThread(id int, txs []*types.Transaction, wg *sync.WaitGroup, msgReturn chan MessageReturn, trMessage *ThreadMessage, IsParallel bool) {
+	defer wg.Done()
+	msgReturn <- executeGroup(id, txs, trMessage, IsParallel)
+}
+
+// demoteSenderTxs 把txs[i]以及紧随其后同一发送方的交易追加到串行队列serial，返回新的串行队列和剩余未执行的交易
+func demoteSenderTxs(serial, txs []*types.Transaction, i int, signer types.Signer) ([]*types.Transaction, []*types.Transaction) {
+	serial = append(serial, txs[i])
+	tempAddress, _ := signer.Sender(txs[i]) // 获取交易发送地址
+	index := i + 1
+	for ; index < len(txs); index++ {
+		tempAddressNext, _ := signer.Sender(txs[index])
+		if bytes.Compare(tempAddress[:], tempAddressNext[:]) == 0 {
+			fmt.Printf("%sPROMPT MSG%s   因当前交易无法并行执行，将一个地址相同的交易也放到串行交易数组\n", types.FGREEN, types.FRESET)
+			serial = append(serial, txs[index])
+		} else {
+			break
+		}
+	}
+	return serial, txs[index:]
+}
+
+// executeGroup 在trMessage的EVM上依次执行一组交易，返回该组的执行结果
+func executeGroup(id int, txs []*types.Transaction, trMessage *ThreadMessage, IsParallel bool) MessageReturn {
 	if IsParallel {
 		fmt.Printf("%sPROMPT MSG%s   当前第 %d 组并行线程中总共需要执行 %d 笔交易\n", types.FGREEN, types.FRESET, id, len(txs))
 	} else {
 		fmt.Printf("%sPROMPT MSG%s   当前串行线程中总共需要执行 %d 笔交易\n", types.FGREEN, types.FRESET, len(txs))
 	}
 
-	defer wg.Done()
-
 	var (
 		ThreadReceipt  []*types.Receipt       // 线程执行的收据树
 		ThreadLogs     []*types.Log           // 线程执行的log
@@ -170,8 +213,44 @@ func TxThread(id int, txs []*types.Transaction, wg *sync.WaitGroup, msgReturn ch
 	for i := 0; i < len(txs); i++ {
 		// 每次循环处理的交易
 		tx := txs[i]
+		// 聚合交易：先处理Cover，再把内部交易展开到当前位置依次执行
+		if tx.IsAggregate() {
+			inner, err := ApplyAggregateCover(tx, trMessage.Signer, trMessage.EVMenv)
+			if err != nil {
+				EachErrMsg := NewTxErrorMessage(tx, "function ApplyAggregateCover err", err)
+				ErrReturnMsg = append(ErrReturnMsg, EachErrMsg)
+				fmt.Printf("%sERROR MSG%s   聚合交易的Cover无效，整笔聚合交易不执行\n", types.FRED, types.FRESET)
+				continue
+			}
+			unpacked := make([]*types.Transaction, 0, len(txs)+len(inner))
+			unpacked = append(append(append(unpacked, txs[:i]...), inner...), txs[i+1:]...)
+			txs = unpacked
+			i--
+			continue
+		}
+		// 加密交易声明的AccessList在执行时才解密，分组时无法据此检查冲突，并行组中的加密交易总是放到串行组执行
+		if IsParallel && tx.IsEncrypted() {
+			fmt.Printf("%sPROMPT MSG%s   加密交易无法按声明的AccessList分组，放到串行交易数组\n", types.FGREEN, types.FRESET)
+			ThreadSerialTx, txs = demoteSenderTxs(ThreadSerialTx, txs, i, trMessage.Signer)
+			i = -1
+			continue
+		}
 		// 新建执行交易的信息结构体
-		msg, err := TransactionToMessage(tx, trMessage.Signer, trMessage.Header.BaseFee, IsParallel)
+		msg, err := TransactionToMessage(tx, trMessage.Signer, trMessage.Header.BaseFee, IsParallel, trMessage.DecryptKey)
+		if err == nil {
+			msg.CheckAccessList = trMessage.CheckAccessLists[tx.Hash()]
+		}
+		// 交易内容无法解密，生成失败收据
+		if IsDecryptError(err) {
+			Receipt, err := ExecuteUndecryptableTx(msg, trMessage.BlockNumber, trMessage.BlockHash, tx, trMessage.UsedGas, trMessage.EVMenv)
+			if err != nil {
+				ErrReturnMsg = append(ErrReturnMsg, NewTxErrorMessage(tx, "function ExecuteUndecryptableTx err", err))
+				continue
+			}
+			fmt.Printf("%sERROR MSG%s   交易内容无法解密，生成失败收据\n", types.FRED, types.FRESET)
+			ThreadReceipt = append(ThreadReceipt, Receipt)
+			continue
+		}
 		if err != nil {
 			EachErrMsg := NewTxErrorMessage(tx, "function TransactionToMessage err", err)
 			ErrReturnMsg = append(ErrReturnMsg, EachErrMsg) // 将错误交易信息保存到返回值中
@@ -191,47 +270,49 @@ func TxThread(id int, txs []*types.Transaction, wg *sync.WaitGroup, msgReturn ch
 			EachErrMsg := NewTxErrorMessage(tx, "TX can not execute in parallel thread", nil)
 			ErrReturnMsg = append(ErrReturnMsg, EachErrMsg) // 将错误交易信息保存到返回值中
 
-			// 将交易放到串行组中
-			ThreadSerialTx = append(ThreadSerialTx, tx)
-			// 将同一Address的交易全部去除
-			tempAddress, _ := trMessage.Signer.Sender(tx) // 获取交易发送地址
-			index := i + 1
-			for ; index < len(txs); index++ {
-				tempAddressNext, _ := trMessage.Signer.Sender(txs[index])
-				if bytes.Compare(tempAddress[:], tempAddressNext[:]) == 0 {
-					fmt.Printf("%sPROMPT MSG%s   因当前交易无法并行执行，将一个地址相同的交易也放到串行交易数组\n", types.FGREEN, types.FRESET)
-					ThreadSerialTx = append(ThreadSerialTx, txs[index])
-				} else {
-					break
-				}
-			}
-			txs = txs[index:]
+			// 将交易以及同一Address的交易放到串行组中
+			ThreadSerialTx, txs = demoteSenderTxs(ThreadSerialTx, txs, i, trMessage.Signer)
 			i = -1
 
 			continue
 		}
 
+		// 从并行组降级的交易按AccessList的不一致程度收取惩罚汽油，记录在收据中
+		// 重新并行执行时解释器不记录TrueAccessList，使用检查冲突时的实际访问集合
+		if TrueAccessList == nil {
+			TrueAccessList = msg.CheckAccessList
+		}
+		if trMessage.Demoted {
+			PenaltyGas := AccessListPenaltyGas(trMessage.Config.AccessListPenalty, msg, TrueAccessList)
+			Receipt.AccessListPenalty = ChargeAccessListPenalty(msg, PenaltyGas, trMessage.EVMenv)
+			if Receipt.AccessListPenalty != 0 {
+				fmt.Printf("%sPROMPT MSG%s   降级交易的AccessList与实际执行不一致，收取惩罚汽油 %d\n", types.FGREEN, types.FRESET, Receipt.AccessListPenalty)
+			}
+		}
+
 		// 交易没有错误
 		fmt.Printf("%sPROMPT MSG%s   恭喜您，一笔交易在并行组中成功执行\n", types.FGREEN, types.FRESET)
 		ThreadReceipt = append(ThreadReceipt, Receipt)
 		ThreadLogs = append(ThreadLogs, Receipt.Logs...)
-		if !msg.IsParallel {
+		if !msg.IsParallel || trMessage.Demoted {
 			TxAccessList = append(TxAccessList, &TxAccessListMessage{
 				Tx:             tx,
 				TrueAccessList: TrueAccessList,
+				Penalty:        Receipt.AccessListPenalty,
 			})
 		}
 	}
 
 	// 汇总最后的返回信息
 	messageReturn := MessageReturn{
+		GroupID:      id,
 		NewReceipt:   ThreadReceipt,
 		NewLogs:      ThreadLogs,
 		TxSerial:     ThreadSerialTx,
 		TxError:      ErrReturnMsg,
 		TxAccessList: TxAccessList,
 	}
-	msgReturn <- messageReturn
+	return messageReturn
 }
 
 // ExecuteTx 交易执行入口函数，代替原applyTransaction函数
@@ -254,8 +335,9 @@ func ExecuteTx(msg *TxMessage, blockNumber *big.Int, blockHash common.Hash, tx *
 	//	fmt.Printf("%sERROR MSG%s   当前交易在执行前的检查阶段发生错误\n", types.FRED, types.FRESET)
 	//	return nil, err
 	//}
-	if executionResult.Err != nil {
-		fmt.Printf("%sERROR MSG%s   当前交易在执行中发生错误\n", types.FRED, types.FRESET)
+	// 执行前被拒绝的交易没有修改状态，不生成收据
+	if IsTxRejected(executionResult.Err) {
+		fmt.Printf("%sERROR MSG%s   当前交易在执行前的检查阶段被拒绝\n", types.FRED, types.FRESET)
 		return nil, nil, executionResult.Err
 	}
 
@@ -264,12 +346,17 @@ func ExecuteTx(msg *TxMessage, blockNumber *big.Int, blockHash common.Hash, tx *
 	var root []byte
 	receipt := &types.Receipt{Type: tx.Type(), PostState: root, CumulativeGasUsed: *usedGas}
 	if executionResult.Err != nil {
+		// 执行中出错的交易已经收取了汽油费，生成失败收据并记录revert原因
+		fmt.Printf("%sERROR MSG%s   当前交易在执行中发生错误，生成失败收据\n", types.FRED, types.FRESET)
 		receipt.Status = types.ReceiptStatusFailed
+		receipt.RevertReason, _ = UnpackRevertReason(executionResult.ReturnData)
 	} else {
 		receipt.Status = types.ReceiptStatusSuccessful
 	}
 	receipt.TxHash = tx.Hash()
+	receipt.AggregateHash = tx.AggregateHash()
 	receipt.GasUsed = executionResult.UsedGas
+	receipt.EffectiveGasPrice = new(big.Int).Set(msg.GasPrice)
 
 	if msg.To == nil {
 		receipt.ContractAddress = crypto.CreateAddress(evm.TxContext.Origin, tx.Nonce())
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"crypto/ecdsa"
 	"math/big"
 	"sort"
 
@@ -14,6 +15,8 @@ import (
 
 // MessageReturn MesReturn 作为返回结构体，通过管道传输线程中每组交易的结果，暂时去掉了IsScusses，因为这是执行函数，不是验证函数
 type MessageReturn struct {
+	// 线程编号，并行组即组号
+	GroupID int
 	// 成功交易收据树
 	NewReceipt []*types.Receipt
 	// logs
@@ -37,6 +40,7 @@ type TxErrorMessage struct {
 type TxAccessListMessage struct {
 	Tx             *types.Transaction // 出错交易
 	TrueAccessList *accesslist.AccessList
+	Penalty        uint64 // 降级交易因AccessList不一致被收取的惩罚汽油
 }
 
 // ThreadMessage 作为多线程函数的传入参数，以一个线程为单位
@@ -48,6 +52,10 @@ type ThreadMessage struct {
 	EVMenv      *evm.EVM
 	Signer      types.Signer
 	Header      *types.Header
+	DecryptKey  *ecdsa.PrivateKey // 执行者私钥，用于解密交易内容
+	Demoted     bool              // 是否是从并行组降级的串行队列，降级交易需要检查AccessList并收取惩罚汽油
+
+	CheckAccessLists map[common.Hash]*accesslist.AccessList // 重新并行执行的降级交易按实际访问的AccessList检查冲突，交易哈希 -> AccessList
 }
 
 // TxMessage 实际交易执行传递的信息
@@ -63,11 +71,14 @@ type TxMessage struct {
 	Data        []byte
 	AccessList  *accesslist.AccessList
 	BlobHashes  []common.Hash
-	IsParallel  bool // 是否是并行队列
-	CanParallel bool // 交易能否并行执行
+	Guarantor   *common.Address // 担保人，非担保交易为nil
+	IsParallel  bool            // 是否是并行队列
+	CanParallel bool            // 交易能否并行执行
 
 	// 当SkipAccountChecks为true时，消息的nonce不会与状态中的账户nonce进行检查
 	SkipAccountChecks bool
+	// 并行执行时解释器用于冲突检查的AccessList，为空时使用声明的AccessList
+	CheckAccessList *accesslist.AccessList
 }
 
 // ExecutionResult ApplyTransaction函数执行后返回值
@@ -87,11 +98,18 @@ type ProcessReturnMsg struct {
 	AlTx     []*TxAccessListMessage
 	UsedGas  *uint64
 	RootHash common.Hash
+
+	MergeResult []*GroupMergeResult // 每个并行组的写集合合并结果
+	STMStats    *STMStats           // Block-STM执行统计，仅StrategySTM时非空
+	WorkerStats []*WorkerStats      // 并行组worker池中每个worker的执行统计
+	FeeSummary  *FeeSummary         // 区块的汽油费汇总
+	Rounds      []*ExecRound        // 每一轮并行执行的分组与合并结果，第0轮即区块中的分组
+	SerialLane  []common.Hash       // 最终在串行队列中执行的交易，按执行顺序
 }
 
 // NewThreadMessage 新建，复制AllMessage结构体
 func NewThreadMessage(Config *params.ChainConfig, BlockNumber *big.Int,
-	BlockHash common.Hash, UsedGas *uint64, EVMenv *evm.EVM, Signer types.Signer, Header *types.Header) *ThreadMessage {
+	BlockHash common.Hash, UsedGas *uint64, EVMenv *evm.EVM, Signer types.Signer, Header *types.Header, DecryptKey *ecdsa.PrivateKey) *ThreadMessage {
 	ThreadMessage := &ThreadMessage{
 		Config:      Config,
 		BlockNumber: BlockNumber,
@@ -100,17 +118,18 @@ func NewThreadMessage(Config *params.ChainConfig, BlockNumber *big.Int,
 		EVMenv:      EVMenv,
 		Signer:      Signer,
 		Header:      Header,
+		DecryptKey:  DecryptKey,
 	}
 	return ThreadMessage
 }
 
 // TransactionToMessage converts a transaction into a Message. TODO: 新增参数 IsParallel bool
-func TransactionToMessage(tx *types.Transaction, s types.Signer, baseFee *big.Int, IsParallel bool) (*TxMessage, error) {
-	tipfee := new(big.Int).Set(tx.GasTipCap())
+// 加密交易在这里使用执行者私钥decryptKey解密，解密失败时返回的msg仍然带有发送方等Cover信息
+func TransactionToMessage(tx *types.Transaction, s types.Signer, baseFee *big.Int, IsParallel bool, decryptKey *ecdsa.PrivateKey) (*TxMessage, error) {
 	msg := &TxMessage{
 		Nonce:             tx.Nonce(),
 		GasLimit:          tx.GasLimit(),
-		GasPrice:          baseFee.Add(baseFee, tipfee),
+		GasPrice:          new(big.Int).Set(tx.GasTipCap()),
 		GasFeeCap:         new(big.Int).Set(tx.GasFeeCap()),
 		GasTipCap:         new(big.Int).Set(tx.GasTipCap()),
 		To:                tx.To(),
@@ -129,11 +148,37 @@ func TransactionToMessage(tx *types.Transaction, s types.Signer, baseFee *big.In
 	}
 	// If baseFee provided, set gasPrice to effectiveGasPrice.
 	if baseFee != nil {
-		msg.GasPrice = cmath.BigMin(msg.GasPrice.Add(msg.GasTipCap, baseFee), msg.GasFeeCap)
+		msg.GasPrice = cmath.BigMin(new(big.Int).Add(msg.GasTipCap, baseFee), msg.GasFeeCap)
 	}
 	var err error
 	msg.From, err = types.Sender(s, tx)
-	return msg, err
+	if err != nil {
+		return msg, err
+	}
+	// 担保交易需要同时恢复担保人
+	if tx.IsGuaranteed() {
+		guarantor, err := types.Guarantor(s, tx)
+		if err != nil {
+			return msg, err
+		}
+		msg.Guarantor = &guarantor
+	}
+	// 交易池与共识只处理Cover，交易内容在执行前才解密
+	if tx.IsEncrypted() {
+		msg.Data, msg.AccessList, err = tx.DecryptContent(decryptKey)
+		if err != nil {
+			return msg, err
+		}
+	}
+	return msg, nil
+}
+
+// GasPayer 支付汽油费的账户，担保交易由担保人支付所有汽油费与惩罚汽油费
+func (msg *TxMessage) GasPayer() common.Address {
+	if msg.Guarantor != nil {
+		return *msg.Guarantor
+	}
+	return msg.From
 }
 
 // NewTxErrorMessage 创建一个交易错误原因
@@ -145,7 +190,8 @@ func NewTxErrorMessage(tx *types.Transaction, result string, err error) *TxError
 	}
 }
 
-// SortSerialTX 串行队列排序方法
+// SortSerialTX 串行队列排序方法，排序结果即串行队列的规范执行顺序：
+// Nonce从小到大，Nonce相同按GasPrice从大到小，再相同按哈希从小到大
 func SortSerialTX(SingleTxList []*types.Transaction) {
 	// 使用 sort.Slice 排序函数对第二项进行排序
 	sort.Slice(SingleTxList, func(i, j int) bool {
@@ -167,6 +213,25 @@ func SortSerialTX(SingleTxList []*types.Transaction) {
 	})
 }
 
+// DeriveReceiptIndexes 按收据在区块中的规范顺序设置TransactionIndex、CumulativeGasUsed以及日志的序号
+// 规范顺序为：按轮次、轮内按组号顺序排列的已合并并行组收据（组内按执行顺序），之后是串行队列按SortSerialTX排序后的收据
+func DeriveReceiptIndexes(receipts types.Receipts) {
+	var (
+		cumulativeGas uint64
+		logIndex      uint
+	)
+	for i, receipt := range receipts {
+		cumulativeGas += receipt.GasUsed
+		receipt.TransactionIndex = uint(i)
+		receipt.CumulativeGasUsed = cumulativeGas
+		for _, log := range receipt.Logs {
+			log.TxIndex = uint(i)
+			log.Index = logIndex
+			logIndex++
+		}
+	}
+}
+
 func NewProcessReturnMsg(Receipts types.Receipts, AllLogs []*types.Log, ErrorTxList []*TxErrorMessage, AccessListTx []*TxAccessListMessage, UsedGas *uint64, RootHash common.Hash) *ProcessReturnMsg {
 	return &ProcessReturnMsg{
 		Receipt:  Receipts,
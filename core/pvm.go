@@ -111,9 +111,14 @@ func Transfer(db evm.StateDB, sender, recipient common.Address, amount *big.Int)
 
 // NewEVMTxContext creates a new transaction context for a single transaction.
 func NewEVMTxContext(msg *TxMessage) evm.TxContext {
-	return evm.TxContext{
-		Origin:   msg.From,
-		GasPrice: new(big.Int).Set(msg.GasPrice),
+	Context := evm.TxContext{
+		Origin:     msg.From,
+		GasPrice:   new(big.Int).Set(msg.GasPrice),
+		AccessList: msg.AccessList,
 		// BlobHashes: msg.BlobHashes,	// TODO: 暂时删除
 	}
+	if msg.CheckAccessList != nil {
+		Context.AccessList = msg.CheckAccessList
+	}
+	return Context
 }
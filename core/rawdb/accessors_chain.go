@@ -622,36 +622,49 @@ func ReadRawReceipts(db ethdb.Reader, hash common.Hash, number uint64) types.Rec
 // its corresponding metadata fields. If it is unable to populate these metadata
 // fields then nil is returned.
 //
-// The current implementation populates these metadata fields by reading the receipts'
-// corresponding block body, so if the block body is not found it will return nil even
-// if the receipt itself is stored.
+// The transaction related fields are stored along with the receipts, the location
+// fields are derived from the block hash and number. If the block body is not found
+// it will return nil even if the receipt itself is stored.
 func ReadReceipts(db ethdb.Reader, hash common.Hash, number uint64, time uint64, config *params.ChainConfig) types.Receipts {
 	// We're deriving many fields from the block body, retrieve beside the receipt
 	receipts := ReadRawReceipts(db, hash, number)
 	if receipts == nil {
 		return nil
 	}
-	body := ReadBody(db, hash, number)
-	if body == nil {
+	if body := ReadBody(db, hash, number); body == nil {
 		log.Error("Missing body but have receipt", "hash", hash, "number", number)
 		return nil
 	}
-	header := ReadHeader(db, hash, number)
-	var baseFee *big.Int
-	if header == nil {
-		baseFee = big.NewInt(0)
-	} else {
-		baseFee = header.BaseFee
-	}
-	// TODO : 暂时注释，待以后重构逻辑
-	//if err := receipts.DeriveFields(config, hash, number, time, baseFee, body.Transactions); err != nil {
-	//	log.Error("Failed to derive block receipts fields", "hash", hash, "number", number, "err", err)
-	//	return nil
-	//}
-	fmt.Println(baseFee)
+	deriveReceiptFields(receipts, hash, number)
 	return receipts
 }
 
+// deriveReceiptFields 补全收据与日志中没有存储的位置信息
+// 收据按执行顺序存储，序号即收据在区块中的位置，交易哈希等与交易相关的字段随收据一起存储
+func deriveReceiptFields(receipts types.Receipts, hash common.Hash, number uint64) {
+	logIndex := uint(0)
+	for i, receipt := range receipts {
+		receipt.BlockHash = hash
+		receipt.BlockNumber = new(big.Int).SetUint64(number)
+		receipt.TransactionIndex = uint(i)
+		// 旧格式的收据没有存储GasUsed，由累计汽油推导
+		if receipt.GasUsed == 0 {
+			receipt.GasUsed = receipt.CumulativeGasUsed
+			if i > 0 {
+				receipt.GasUsed -= receipts[i-1].CumulativeGasUsed
+			}
+		}
+		for j := 0; j < len(receipt.Logs); j++ {
+			receipt.Logs[j].BlockNumber = number
+			receipt.Logs[j].BlockHash = hash
+			receipt.Logs[j].TxHash = receipt.TxHash
+			receipt.Logs[j].TxIndex = uint(i)
+			receipt.Logs[j].Index = logIndex
+			logIndex++
+		}
+	}
+}
+
 // WriteReceipts stores all the transaction receipts belonging to a block.
 func WriteReceipts(db ethdb.KeyValueWriter, hash common.Hash, number uint64, receipts types.Receipts) {
 	// Convert the receipts into their storage form and serialize them
@@ -683,6 +696,7 @@ type storedReceiptRLP struct {
 	PostStateOrStatus []byte
 	CumulativeGasUsed uint64
 	Logs              []*types.Log
+	Rest              []rlp.RawValue `rlp:"tail"` // revert原因、交易哈希等随收据存储的字段
 }
 
 // ReceiptLogs is a barebone version of ReceiptForStorage which only keeps
@@ -760,18 +774,14 @@ func ReadBlock(db ethdb.Reader, hash common.Hash, number uint64) *types.Block {
 	if body == nil {
 		return nil
 	}
-	// TODO : 暂时注释，待以后重构逻辑
-	//return types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles).WithWithdrawals(body.Withdrawals)
-	var emptyBlock *types.Block
-	return emptyBlock
+	return types.NewBlockWithBody(header, body)
 }
 
 // WriteBlock serializes a block into the database, header and body separately.
-// TODO : 暂时注释，待以后重构逻辑
-//func WriteBlock(db ethdb.KeyValueWriter, block *types.Block) {
-//	WriteBody(db, block.Hash(), block.NumberU64(), block.Body())
-//	WriteHeader(db, block.Header())
-//}
+func WriteBlock(db ethdb.KeyValueWriter, block *types.Block) {
+	WriteBody(db, block.Hash(), block.NumberU64(), block.GetBody())
+	WriteHeader(db, block.Header())
+}
 
 // WriteAncientBlocks writes entire block data into ancient store and returns the total written size.
 func WriteAncientBlocks(db ethdb.AncientWriter, blocks []*types.Block, receipts []types.Receipts, td *big.Int) (int64, error) {
@@ -807,10 +817,9 @@ func writeAncientBlock(op ethdb.AncientWriteOp, block *types.Block, header *type
 	if err := op.Append(ChainFreezerHeaderTable, num, header); err != nil {
 		return fmt.Errorf("can't append block header %d: %v", num, err)
 	}
-	// TODO : 暂时注释，待以后重构逻辑
-	//if err := op.Append(ChainFreezerBodiesTable, num, block.Body()); err != nil {
-	//	return fmt.Errorf("can't append block body %d: %v", num, err)
-	//}
+	if err := op.Append(ChainFreezerBodiesTable, num, block.GetBody()); err != nil {
+		return fmt.Errorf("can't append block body %d: %v", num, err)
+	}
 	if err := op.Append(ChainFreezerReceiptTable, num, receipts); err != nil {
 		return fmt.Errorf("can't append block %d receipts: %v", num, err)
 	}
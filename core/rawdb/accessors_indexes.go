@@ -72,10 +72,11 @@ func WriteTxLookupEntries(db ethdb.KeyValueWriter, number uint64, hashes []commo
 
 // WriteTxLookupEntriesByBlock stores a positional metadata for every transaction from
 // a block, enabling hash based transaction and receipt lookups.
+// 聚合交易的各内部交易同样建立索引
 func WriteTxLookupEntriesByBlock(db ethdb.KeyValueWriter, block *types.Block) {
 	numberBytes := block.Number().Bytes()
-	for _, tx := range block.Transactions() {
-		writeTxLookupEntry(db, tx.Hash(), numberBytes)
+	for _, hash := range block.Transactions().LookupHashes() {
+		writeTxLookupEntry(db, hash, numberBytes)
 	}
 }
 
@@ -109,18 +110,48 @@ func ReadTransaction(db ethdb.Reader, hash common.Hash) (*types.Transaction, com
 		log.Error("Transaction referenced missing", "number", *blockNumber, "hash", blockHash)
 		return nil, common.Hash{}, 0, 0
 	}
-	// TODO : 暂时注释，待以后重构逻辑
-	//for txIndex, tx := range body.Transactions {
-	//	if tx.Hash() == hash {
-	//		return tx, blockHash, *blockNumber, uint64(txIndex)
-	//	}
-	//}
-	log.Error("Transaction not found", "number", *blockNumber, "hash", blockHash, "txhash", hash)
-	return nil, common.Hash{}, 0, 0
+	tx := findTransaction(body.Transactions(), hash)
+	if tx == nil {
+		log.Error("Transaction not found", "number", *blockNumber, "hash", blockHash, "txhash", hash)
+		return nil, common.Hash{}, 0, 0
+	}
+	// 交易的序号与收据的序号一致，为执行顺序
+	txIndex, ok := executionIndex(ReadRawReceipts(db, blockHash, *blockNumber), hash)
+	if !ok {
+		log.Error("Transaction receipt not found", "number", *blockNumber, "hash", blockHash, "txhash", hash)
+		return nil, common.Hash{}, 0, 0
+	}
+	return tx, blockHash, *blockNumber, txIndex
+}
+
+// findTransaction 在区块的交易中按哈希查找交易，包括聚合交易的内部交易
+func findTransaction(txs types.Transactions, hash common.Hash) *types.Transaction {
+	for _, tx := range txs {
+		if tx.Hash() == hash {
+			return tx
+		}
+		for _, inner := range tx.InnerTxs() {
+			if inner.Hash() == hash {
+				return inner
+			}
+		}
+	}
+	return nil
+}
+
+// executionIndex 交易在按执行顺序存储的收据中的位置；聚合交易本身没有收据，取它第一笔内部交易的位置
+func executionIndex(receipts types.Receipts, hash common.Hash) (uint64, bool) {
+	for i, receipt := range receipts {
+		if receipt.TxHash == hash || receipt.AggregateHash == hash {
+			return uint64(i), true
+		}
+	}
+	return 0, false
 }
 
 // ReadReceipt retrieves a specific transaction receipt from the database, along with
 // its added positional metadata.
+// 聚合交易按内部交易分别生成收据，按内部交易的哈希查找；按聚合交易的哈希查找不到收据
 func ReadReceipt(db ethdb.Reader, hash common.Hash, config *params.ChainConfig) (*types.Receipt, common.Hash, uint64, uint64) {
 	// Retrieve the context of the receipt based on the transaction hash
 	blockNumber := ReadTxLookupEntry(db, hash)
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/SipengXie/pangu/accesslist"
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core/evm"
+	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/params"
+)
+
+// DefaultReexecRounds 降级交易默认最多重新并行执行的轮数
+const DefaultReexecRounds = 2
+
+// ExecRound 一轮并行执行的分组与合并结果
+// 第0轮是区块中的分组；之后每一轮由上一轮降级的交易按合并后状态上实际访问的AccessList重新分组
+// 分组只由区块交易与父状态决定，验证者重新执行时得到相同的轮次
+type ExecRound struct {
+	Round       int                 // 轮次
+	Groups      [][]common.Hash     // 每组交易的哈希，按组内执行顺序
+	MergeResult []*GroupMergeResult // 每组的写集合合并结果
+}
+
+// Layout Process实际使用的执行布局，提议者用它计算区块头的GroupRoot，验证者重新执行后与区块头比对
+func (m *ProcessReturnMsg) Layout() *types.ExecLayout {
+	Layout := &types.ExecLayout{Serial: m.SerialLane}
+	for _, round := range m.Rounds {
+		Layout.Rounds = append(Layout.Rounds, round.Groups)
+	}
+	return Layout
+}
+
+// roundResult 一轮并行执行中合并成功的组的执行结果
+type roundResult struct {
+	Receipts    types.Receipts
+	Logs        []*types.Log
+	Errors      []*TxErrorMessage
+	AccessLists []*TxAccessListMessage
+	Demoted     types.Transactions // 需要进入下一轮或串行队列的交易：组内无法并行执行的交易，以及写集合冲突的整组交易
+	Stats       []*WorkerStats
+}
+
+// ReexecRounds 链配置规定的降级交易最多重新并行执行的轮数，没有规定时为DefaultReexecRounds，0表示降级交易直接进入串行队列
+func ReexecRounds(config *params.ChainConfig) int {
+	if config == nil || config.ReexecRounds == nil {
+		return DefaultReexecRounds
+	}
+	return int(*config.ReexecRounds)
+}
+
+// executeRound 在base上由worker池并行执行一轮分组并按组号合并，UsedGas只累加合并成功的组
+func (p *Processor) executeRound(round int, groups []types.Transactions, base *state.StateDB, usedGas *uint64, header *types.Header, blockHash common.Hash, blockNumber *big.Int, signer types.Signer, cfg evm.Config, checkALs map[common.Hash]*accesslist.AccessList) (*ExecRound, *roundResult, error) {
+	var (
+		Exec         = &ExecRound{Round: round, Groups: make([][]common.Hash, len(groups))}
+		Result       = new(roundResult)
+		AllStateDB   = make([]*state.StateDB, len(groups)) // 每个并行组独立的stateDB
+		GroupUsedGas = make([]*uint64, len(groups))        // 每个并行组独立的汽油费计数
+	)
+	// 为每个并行组拷贝一份stateDB，组之间不共享任何可写状态
+	for i, group := range groups {
+		AllStateDB[i] = base.ForkView()
+		GroupUsedGas[i] = new(uint64)
+		for _, tx := range group {
+			Exec.Groups[i] = append(Exec.Groups[i], tx.Hash())
+		}
+	}
+	// 由有界的worker池执行各并行组，每个worker复用自己的EVM
+	GroupReturn, WorkerStats := p.runGroups(groups, AllStateDB, GroupUsedGas, header, blockHash, blockNumber, signer, cfg, checkALs)
+	Result.Stats = WorkerStats
+
+	fmt.Printf("\n%sSTAGE CHANGE%s   第 %d 轮并行交易结果处理 <<< \n", types.FBLUE, types.FRESET, round)
+
+	// 按组号顺序合并各组的写集合，写集合冲突的组整体降级
+	MergeResults, err := MergeGroupStates(base, AllStateDB, FeeAccounts(p.config, header), MergePolicy(p.config.MergePolicy))
+	Exec.MergeResult = MergeResults
+	if err != nil {
+		return Exec, Result, err
+	}
+	for i, res := range MergeResults {
+		if !res.Merged {
+			fmt.Printf("%sPROMPT MSG%s   第 %d 组并行交易与其他组冲突，整组降级\n", types.FGREEN, types.FRESET, i)
+			Result.Demoted = append(Result.Demoted, groups[i]...)
+			continue
+		}
+		fmt.Printf("%sPROMPT MSG%s   收到一组并行交易的返回值，开始处理\n", types.FGREEN, types.FRESET)
+		value := GroupReturn[i]
+		*usedGas += *GroupUsedGas[i]
+		Result.Receipts = append(Result.Receipts, value.NewReceipt...)
+		Result.Logs = append(Result.Logs, value.NewLogs...)
+		Result.Demoted = append(Result.Demoted, value.TxSerial...)
+		Result.Errors = append(Result.Errors, value.TxError...)
+		Result.AccessLists = append(Result.AccessLists, value.TxAccessList...)
+	}
+	return Exec, Result, nil
+}
+
+// regroupDemoted 在base的副本上并行模拟执行降级交易，按实际访问的AccessList重新分组，返回分组以及每笔交易用于冲突检查的AccessList
+// 模拟出错的交易（以及同一发送方的其他降级交易）、聚合交易和加密交易留在串行队列
+func (p *Processor) regroupDemoted(txs types.Transactions, base *state.StateDB, header *types.Header, signer types.Signer, cfg evm.Config) (groups []types.Transactions, residual types.Transactions, checkALs map[common.Hash]*accesslist.AccessList) {
+	SortSerialTX(txs)
+	var (
+		States = make([]*state.StateDB, len(txs))
+		Preds  = make([]*TxPrediction, len(txs))
+		Jobs   = make(chan int, len(txs))
+		wg     sync.WaitGroup
+	)
+	// 副本在模拟开始前依次创建，模拟时各自独立
+	for i := range txs {
+		States[i] = base.Copy()
+		Jobs <- i
+	}
+	close(Jobs)
+	for w := 0; w < p.workerCount(len(txs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range Jobs {
+				if txs[i].IsAggregate() || txs[i].IsEncrypted() {
+					Preds[i] = &TxPrediction{Conflict: true}
+					continue
+				}
+				Pred, err := predictTx(p.config, p.blockchain, header, States[i], txs[i], signer, p.decryptKey, cfg)
+				if err != nil {
+					Pred = &TxPrediction{Conflict: true}
+				} else {
+					// 重新执行时按实际访问检查，不再与声明的AccessList比较
+					Pred.Conflict = false
+				}
+				Preds[i] = Pred
+			}
+		}()
+	}
+	wg.Wait()
+
+	Predictions := make(Predictions, len(txs))
+	for i, tx := range txs {
+		Predictions[tx.Hash()] = Preds[i]
+	}
+	groups, residual = ClassifyTxPredicted(txs, signer, Predictions)
+	checkALs = make(map[common.Hash]*accesslist.AccessList)
+	for _, group := range groups {
+		for _, tx := range group {
+			checkALs[tx.Hash()] = Predictions[tx.Hash()].AccessList
+		}
+	}
+	return groups, residual, checkALs
+}
+
+// addWorkerStats 把一轮执行的worker统计按worker编号累加到total
+func addWorkerStats(total, round []*WorkerStats) []*WorkerStats {
+	for _, stats := range round {
+		for len(total) <= stats.Worker {
+			total = append(total, &WorkerStats{Worker: len(total)})
+		}
+		sum := total[stats.Worker]
+		sum.Groups += stats.Groups
+		sum.Stolen += stats.Stolen
+		sum.Txs += stats.Txs
+		sum.Busy += stats.Busy
+	}
+	return total
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core/rawdb"
+	"github.com/SipengXie/pangu/core/types"
+)
+
+var (
+	// ErrUnknownBlock 数据库中没有该区块
+	ErrUnknownBlock = errors.New("unknown block")
+	// ErrReorgFinalized 切换规范链需要回滚已经最终确认的区块
+	ErrReorgFinalized = errors.New("reorg below finalized block")
+)
+
+// GetBlockByHash 按哈希查找区块，包括分叉上的区块
+func (bc *Blockchain) GetBlockByHash(hash common.Hash) *types.Block {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil
+	}
+	return bc.GetBlock(hash, *number)
+}
+
+// Children 以hash为父区块的所有区块的哈希，包括规范链与分叉
+func (bc *Blockchain) Children(hash common.Hash) []common.Hash {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil
+	}
+	var children []common.Hash
+	for _, child := range rawdb.ReadAllHashes(bc.db, *number+1) {
+		if header := rawdb.ReadHeader(bc.db, child, *number+1); header != nil && header.ParentHash == hash {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// CurrentFinalBlock 共识最终确认的区块头，还没有确认过区块时为nil
+func (bc *Blockchain) CurrentFinalBlock() *types.Header {
+	return bc.currentFinalized.Load()
+}
+
+// Finalize 收到共识对区块的最终确认：区块不在规范链上时把规范链切换到以它为链头的分叉，然后记录为最终确认的区块
+// 规范链不能回滚到最终确认的区块之前
+func (bc *Blockchain) Finalize(hash common.Hash) error {
+	if !bc.chainmu.TryLock() {
+		return errChainStopped
+	}
+	defer bc.chainmu.Unlock()
+
+	block := bc.GetBlockByHash(hash)
+	if block == nil {
+		return fmt.Errorf("%w: %x", ErrUnknownBlock, hash)
+	}
+	if rawdb.ReadCanonicalHash(bc.db, block.NumberU64()) != hash {
+		if err := bc.reorg(bc.currentBlock.Load(), block); err != nil {
+			return err
+		}
+	}
+	rawdb.WriteFinalizedBlockHash(bc.db, hash)
+	bc.currentFinalized.Store(block.Header())
+	return nil
+}
+
+// reorg 把规范链从oldHead切换到newHead：找到共同祖先，改写规范哈希与交易索引，链头状态回到newHead的状态
+// 旧链上的区块作为分叉发出ChainSideEvent，其中的日志作为RemovedLogsEvent发出，交易池收到ChainHeadEvent后重新注入被丢弃的交易
+// newHead的状态不可用时直接返回ErrMissingState，数据库中的规范链与内存中的链头都不做修改
+func (bc *Blockchain) reorg(oldHead, newHead *types.Block) error {
+	if !bc.HasState(newHead.StateRoot()) {
+		return fmt.Errorf("%w: block %d [%x]", ErrMissingState, newHead.NumberU64(), newHead.Hash())
+	}
+	var (
+		oldChain, newChain types.Blocks
+		oldBlock, newBlock = oldHead, newHead
+	)
+	for oldBlock != nil && newBlock != nil && oldBlock.NumberU64() > newBlock.NumberU64() {
+		oldChain = append(oldChain, oldBlock)
+		oldBlock = bc.GetBlock(oldBlock.ParentHash(), oldBlock.NumberU64()-1)
+	}
+	for oldBlock != nil && newBlock != nil && newBlock.NumberU64() > oldBlock.NumberU64() {
+		newChain = append(newChain, newBlock)
+		newBlock = bc.GetBlock(newBlock.ParentHash(), newBlock.NumberU64()-1)
+	}
+	for oldBlock != nil && newBlock != nil && oldBlock.Hash() != newBlock.Hash() {
+		oldChain = append(oldChain, oldBlock)
+		newChain = append(newChain, newBlock)
+		oldBlock = bc.GetBlock(oldBlock.ParentHash(), oldBlock.NumberU64()-1)
+		newBlock = bc.GetBlock(newBlock.ParentHash(), newBlock.NumberU64()-1)
+	}
+	if oldBlock == nil || newBlock == nil {
+		return fmt.Errorf("%w: no common ancestor of %x and %x", ErrUnknownAncestor, oldHead.Hash(), newHead.Hash())
+	}
+	if final := bc.currentFinalized.Load(); final != nil && newBlock.NumberU64() < final.Number.Uint64() {
+		return fmt.Errorf("%w: common ancestor %d, finalized %d", ErrReorgFinalized, newBlock.NumberU64(), final.Number.Uint64())
+	}
+	fmt.Printf("\n%sSTAGE CHANGE%s   切换规范链，共同祖先 %d，回滚 %d 个区块，新增 %d 个区块 <<< \n", types.FBLUE, types.FRESET, newBlock.NumberU64(), len(oldChain), len(newChain))
+
+	// 新链上的交易
+	included := make(map[common.Hash]struct{})
+	for _, block := range newChain {
+		for _, hash := range block.Transactions().LookupHashes() {
+			included[hash] = struct{}{}
+		}
+	}
+	batch := bc.db.NewBatch()
+	var removedLogs []*types.Log
+	for _, block := range oldChain {
+		// 只在旧链上的交易删除索引，之后由交易池重新注入
+		for _, hash := range block.Transactions().LookupHashes() {
+			if _, ok := included[hash]; !ok {
+				rawdb.DeleteTxLookupEntry(batch, hash)
+			}
+		}
+		for _, receipt := range rawdb.ReadRawReceipts(bc.db, block.Hash(), block.NumberU64()) {
+			for _, log := range receipt.Logs {
+				removed := *log
+				removed.BlockHash = block.Hash()
+				removed.BlockNumber = block.NumberU64()
+				removed.Removed = true
+				removedLogs = append(removedLogs, &removed)
+			}
+		}
+	}
+	// 从共同祖先开始按高度写入新链
+	for i := len(newChain) - 1; i >= 0; i-- {
+		rawdb.WriteCanonicalHash(batch, newChain[i].Hash(), newChain[i].NumberU64())
+		rawdb.WriteTxLookupEntriesByBlock(batch, newChain[i])
+	}
+	// 新链比旧链短时删除多出来的规范哈希
+	for number := newHead.NumberU64() + 1; ; number++ {
+		if rawdb.ReadCanonicalHash(bc.db, number) == (common.Hash{}) {
+			break
+		}
+		rawdb.DeleteCanonicalHash(batch, number)
+	}
+	rawdb.WriteHeadBlockHash(batch, newHead.Hash())
+	rawdb.WriteHeadHeaderHash(batch, newHead.Hash())
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	// 链头状态回到新链头的状态，状态已在切换前确认可用
+	bc.currentBlock.Store(newHead)
+
+	if len(removedLogs) > 0 {
+		bc.rmLogsFeed.Send(types.RemovedLogsEvent{Logs: removedLogs})
+	}
+	for i := len(oldChain) - 1; i >= 0; i-- {
+		bc.chainSideFeed.Send(types.ChainSideEvent{Block: oldChain[i]})
+	}
+	bc.chainHeadFeed.Send(types.ChainHeadEvent{Block: newHead})
+	return nil
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/SipengXie/pangu/crypto"
+)
+
+var (
+	// ErrTxRejected 交易在执行前的检查中被拒绝（nonce、余额、汽油等），状态不变，交易不能打包进区块
+	ErrTxRejected = errors.New("transaction rejected before execution")
+
+	errNotRevertData = errors.New("return data is not a revert reason")
+)
+
+var (
+	revertSelector = crypto.Keccak256([]byte("Error(string)"))[:4]  // 0x08c379a0
+	panicSelector  = crypto.Keccak256([]byte("Panic(uint256)"))[:4] // 0x4e487b71
+)
+
+// panicReasons Solidity Panic(uint256)的错误码
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "out-of-bounds array access; popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesN",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+// IsTxRejected 判断交易执行返回的错误是否是执行前的拒绝，被拒绝的交易没有收据
+// 其他错误发生在执行中，交易已经收取汽油费，生成状态为失败的收据
+func IsTxRejected(err error) bool {
+	return errors.Is(err, ErrTxRejected)
+}
+
+// UnpackRevertReason 解析revert返回的数据，支持Solidity的Error(string)与Panic(uint256)
+func UnpackRevertReason(data []byte) (string, error) {
+	if len(data) < 4+32 {
+		return "", errNotRevertData
+	}
+	switch {
+	case bytes.Equal(data[:4], revertSelector):
+		// ABI编码：字符串的偏移、长度、内容
+		// 比较时不做加法，偏移与长度接近2^64时不会回绕
+		args := data[4:]
+		offset := new(big.Int).SetBytes(args[:32])
+		if !offset.IsUint64() || offset.Uint64() > uint64(len(args))-32 {
+			return "", errNotRevertData
+		}
+		start := offset.Uint64() + 32
+		length := new(big.Int).SetBytes(args[start-32 : start])
+		if !length.IsUint64() || length.Uint64() > uint64(len(args))-start {
+			return "", errNotRevertData
+		}
+		return string(args[start : start+length.Uint64()]), nil
+	case bytes.Equal(data[:4], panicSelector):
+		code := new(big.Int).SetBytes(data[4:36])
+		if code.IsUint64() {
+			if reason, ok := panicReasons[code.Uint64()]; ok {
+				return fmt.Sprintf("panic: %s (0x%x)", reason, code), nil
+			}
+		}
+		return fmt.Sprintf("panic: unknown panic code 0x%x", code), nil
+	}
+	return "", errNotRevertData
+}
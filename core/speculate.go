@@ -0,0 +1,59 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+
+	"github.com/SipengXie/pangu/accesslist"
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core/evm"
+	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/params"
+)
+
+// TxPrediction 交易在交易池中预执行的结果
+type TxPrediction struct {
+	AccessList *accesslist.AccessList // 预执行时实际访问的AccessList，包含发送方与接收方
+	Conflict   bool                   // 实际访问超出了声明的AccessList，执行时很可能被降级到串行队列
+	Head       common.Hash            // 预执行所基于的链头
+}
+
+// Predictions 交易哈希 -> 预执行结果
+type Predictions map[common.Hash]*TxPrediction
+
+// PredictTx 在链头状态的副本上为下一个区块header预执行交易，与声明的AccessList比较，得到预测的访问集合与冲突风险，不修改statedb
+// 交易池中的交易可能还不能立即执行，预执行时使用发送方当前的nonce，并按零汽油价格、由发送方支付汽油模拟
+func PredictTx(config *params.ChainConfig, chain ChainContext, header *types.Header, statedb *state.StateDB, tx *types.Transaction, cfg evm.Config) (*TxPrediction, error) {
+	signer := types.MakeSigner(config, header.Number, header.Time)
+	return predictTx(config, chain, header, statedb.Copy(), tx, signer, nil, cfg)
+}
+
+// predictTx 在statedb上预执行交易，会修改statedb，调用方需要传入副本；加密交易使用decryptKey解密
+func predictTx(config *params.ChainConfig, chain ChainContext, header *types.Header, statedb *state.StateDB, tx *types.Transaction, signer types.Signer, decryptKey *ecdsa.PrivateKey, cfg evm.Config) (*TxPrediction, error) {
+	msg, err := TransactionToMessage(tx, signer, nil, false, decryptKey)
+	if err != nil {
+		return nil, err
+	}
+	msg.Nonce = statedb.GetNonce(msg.From)
+	msg.GasPrice, msg.GasFeeCap, msg.GasTipCap = new(big.Int), new(big.Int), new(big.Int)
+	msg.Guarantor = nil
+
+	header = types.CopyHeader(header)
+	header.BaseFee = new(big.Int)
+	TrueAccessList, _, err := simulateTx(config, chain, header, statedb, msg, cfg)
+	if err != nil {
+		return nil, err
+	}
+	Declared := msg.AccessList
+	if Declared == nil {
+		Declared = accesslist.NewAccessList()
+	}
+	// 与并行执行时解释器的检查一致：只比较解释器记录的访问
+	NoConflict, _, _, _ := TrueAccessList.ConflictDetection(Declared)
+	return &TxPrediction{
+		AccessList: actualAccessList(msg, TrueAccessList),
+		Conflict:   !NoConflict,
+		Head:       header.ParentHash,
+	}, nil
+}
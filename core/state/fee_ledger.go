@@ -0,0 +1,86 @@
+package state
+
+import (
+	"math/big"
+
+	"github.com/SipengXie/pangu/common"
+)
+
+// feeLedger 汽油费等只增不减的系统账户余额增量，以及被销毁的金额
+// 增量不修改账户，因此不进入写集合；多个并行组的增量可以按任意顺序累加
+type feeLedger struct {
+	deltas map[common.Address]*big.Int
+	burnt  *big.Int
+}
+
+func (l feeLedger) copy() feeLedger {
+	cpy := feeLedger{}
+	if l.deltas != nil {
+		cpy.deltas = make(map[common.Address]*big.Int, len(l.deltas))
+		for addr, delta := range l.deltas {
+			cpy.deltas[addr] = new(big.Int).Set(delta)
+		}
+	}
+	if l.burnt != nil {
+		cpy.burnt = new(big.Int).Set(l.burnt)
+	}
+	return cpy
+}
+
+// AddBalanceDelta 以可交换增量的方式给addr增加余额：只记录在增量表中，由FoldFeeLedger统一写入状态
+// 区块执行期间读取addr的余额得到的是不包含增量的值
+func (s *StateDB) AddBalanceDelta(addr common.Address, amount *big.Int) {
+	if amount.Sign() == 0 {
+		return
+	}
+	if s.feeLedger.deltas == nil {
+		s.feeLedger.deltas = make(map[common.Address]*big.Int)
+	}
+	if delta, ok := s.feeLedger.deltas[addr]; ok {
+		delta.Add(delta, amount)
+		return
+	}
+	s.feeLedger.deltas[addr] = new(big.Int).Set(amount)
+}
+
+// AddBurnt 记录被销毁的金额（没有配置FeeCollector时的基础费）
+func (s *StateDB) AddBurnt(amount *big.Int) {
+	if amount.Sign() == 0 {
+		return
+	}
+	if s.feeLedger.burnt == nil {
+		s.feeLedger.burnt = new(big.Int)
+	}
+	s.feeLedger.burnt.Add(s.feeLedger.burnt, amount)
+}
+
+// BalanceDeltas 返回尚未写入状态的余额增量的副本
+func (s *StateDB) BalanceDeltas() map[common.Address]*big.Int {
+	return s.feeLedger.copy().deltas
+}
+
+// Burnt 返回累计销毁的金额
+func (s *StateDB) Burnt() *big.Int {
+	if s.feeLedger.burnt == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(s.feeLedger.burnt)
+}
+
+// MergeFeeLedger 把src中的余额增量与销毁金额累加到当前StateDB
+func (s *StateDB) MergeFeeLedger(src *StateDB) {
+	for addr, delta := range src.feeLedger.deltas {
+		s.AddBalanceDelta(addr, delta)
+	}
+	if src.feeLedger.burnt != nil {
+		s.AddBurnt(src.feeLedger.burnt)
+	}
+}
+
+// FoldFeeLedger 把累计的余额增量写入状态并清空账本，区块执行结束、提交状态之前调用
+func (s *StateDB) FoldFeeLedger() {
+	for addr, delta := range s.feeLedger.deltas {
+		s.AddBalance(addr, delta)
+	}
+	s.feeLedger = feeLedger{}
+}
@@ -86,6 +86,9 @@ type StateDB struct {
 	stateObjectsDirty    map[common.Address]struct{} // State objects modified in the current execution
 	stateObjectsDestruct map[common.Address]struct{} // State objects destructed in the block
 
+	// ForkView创建的视图在本地没有某个账户时从parent的内存对象复制，parent在视图使用期间不能修改；视图的Copy不再引用parent
+	parent *StateDB
+
 	// DB error.
 	// State objects are used by the consensus core and VM which are
 	// unable to deal with database-level errors. Any error that occurs
@@ -111,6 +114,9 @@ type StateDB struct {
 	// Transient storage
 	transientStorage transientStorage
 
+	// 可交换的余额增量与销毁的金额，区块结束时由FoldFeeLedger统一写入状态
+	feeLedger feeLedger
+
 	// Journal of state modifications. This is the backbone of
 	// Snapshot and RevertToSnapshot.
 	journal        journal
@@ -574,6 +580,14 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *StateObject {
 	if obj := s.stateObjects[addr]; obj != nil {
 		return obj
 	}
+	// ForkView创建的视图优先复制父状态的内存对象，其中包含尚未写入状态树的修改
+	for parent := s.parent; parent != nil; parent = parent.parent {
+		if obj := parent.stateObjects[addr]; obj != nil {
+			obj = obj.deepCopy(s)
+			s.setStateObject(obj)
+			return obj
+		}
+	}
 	// If no live objects are available, attempt to use snapshots
 	var data *types.StateAccount
 	if s.snap != nil {
@@ -784,6 +798,22 @@ func (s *StateDB) Copy() *StateDB {
 		}
 		state.stateObjectsDirty[addr] = struct{}{}
 	}
+	// ForkView创建的视图复制时展开父状态链：本地已访问的账户以及父状态中本地还没有的内存对象全部深拷贝，
+	// 副本不引用父状态，父状态之后被修改（例如合并并行组）也不影响副本
+	if s.parent != nil {
+		for addr, object := range s.stateObjects {
+			if _, exist := state.stateObjects[addr]; !exist {
+				state.stateObjects[addr] = object.deepCopy(state)
+			}
+		}
+		for parent := s.parent; parent != nil; parent = parent.parent {
+			for addr, object := range parent.stateObjects {
+				if _, exist := state.stateObjects[addr]; !exist {
+					state.stateObjects[addr] = object.deepCopy(state)
+				}
+			}
+		}
+	}
 	// Deep copy the destruction flag.
 	for addr := range s.stateObjectsDestruct {
 		state.stateObjectsDestruct[addr] = struct{}{}
@@ -807,6 +837,7 @@ func (s *StateDB) Copy() *StateDB {
 	// in the middle of a transaction.
 	state.AccessList = s.AccessList.Copy()
 	state.transientStorage = s.transientStorage.Copy()
+	state.feeLedger = s.feeLedger.copy()
 
 	// If there's a prefetcher running, make an inactive copy of it that can
 	// only access data but does not actively preload (since the user will not
@@ -1263,3 +1294,100 @@ func (s *StateDB) ClearJournal() {
 		s.journal = newJournal()
 	}
 }
+
+// ForkView 基于当前状态创建一个写时复制的视图，视图的待提交集合为空，只记录此后发生的修改
+// 创建时不复制任何账户，第一次访问某个账户时才从当前状态的内存对象深拷贝，当前状态中没有的账户从状态树读取，
+// 因此创建的开销与区块中已经修改过的账户数无关，只与视图实际访问的账户数有关
+// 调用前需要先执行Finalise，保证当前状态中没有未结束的交易；视图使用期间当前状态不能修改，多个视图可以并发读取同一个当前状态
+func (s *StateDB) ForkView() *StateDB {
+	state := &StateDB{
+		db:                   s.db,
+		trie:                 s.db.CopyTrie(s.trie),
+		hasher:               crypto.NewKeccakState(),
+		originalRoot:         s.originalRoot,
+		snaps:                s.snaps,
+		snap:                 s.snap,
+		stateObjects:         make(map[common.Address]*StateObject),
+		stateObjectsPending:  make(map[common.Address]struct{}),
+		stateObjectsDirty:    make(map[common.Address]struct{}),
+		stateObjectsDestruct: make(map[common.Address]struct{}),
+		parent:               s,
+		logs:                 make(map[common.Hash][]*types.Log),
+		logSize:              s.logSize,
+		preimages:            make(map[common.Hash][]byte),
+		AccessList:           s.AccessList.Copy(),
+		transientStorage:     newTransientStorage(),
+		journal:              newJournal(),
+	}
+	if state.snap != nil {
+		state.snapAccounts = make(map[common.Hash][]byte)
+		state.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+	}
+	return state
+}
+
+// WriteSet 返回当前StateDB中被修改过的账户地址（按地址排序），调用前需要先执行Finalise
+func (s *StateDB) WriteSet() []common.Address {
+	addrs := make([]common.Address, 0, len(s.stateObjectsPending))
+	for addr := range s.stateObjectsPending {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Less(addrs[j])
+	})
+	return addrs
+}
+
+// IsBalanceOnlyChange 判断addr相对于base只有余额发生了变化（nonce、code、storage均未修改）
+func (s *StateDB) IsBalanceOnlyChange(addr common.Address, base *StateDB) bool {
+	obj := s.stateObjects[addr]
+	if obj == nil {
+		return true
+	}
+	if obj.suicided || obj.deleted || obj.dirtyCode || len(obj.pendingStorage) != 0 || len(obj.dirtyStorage) != 0 {
+		return false
+	}
+	return obj.Nonce() == base.GetNonce(addr) && common.BytesToHash(obj.CodeHash()) == base.GetCodeHash(addr)
+}
+
+// MergeStateObjects 将src中addrs对应的账户深拷贝到当前StateDB，并标记为待提交状态
+// 调用方需要保证addrs与当前StateDB中其他来源合并的账户互不相交
+func (s *StateDB) MergeStateObjects(src *StateDB, addrs []common.Address) {
+	for _, addr := range addrs {
+		obj, exist := src.stateObjects[addr]
+		if !exist {
+			continue
+		}
+		s.stateObjects[addr] = obj.deepCopy(s)
+		s.stateObjectsPending[addr] = struct{}{}
+		s.stateObjectsDirty[addr] = struct{}{}
+		if _, destructed := src.stateObjectsDestruct[addr]; destructed {
+			s.stateObjectsDestruct[addr] = struct{}{}
+		}
+	}
+}
+
+// InjectAccount 不记录journal地覆盖账户的余额、nonce和代码（账户不存在时创建），
+// 用于乐观并行执行时注入其他交易写入的版本，快照回滚不会撤销注入的值
+func (s *StateDB) InjectAccount(addr common.Address, balance *big.Int, nonce uint64, codeHash common.Hash, code []byte) {
+	obj := s.getStateObject(addr)
+	if obj == nil {
+		obj = newObject(s, addr, types.StateAccount{})
+		s.setStateObject(obj)
+	}
+	obj.setBalance(new(big.Int).Set(balance))
+	obj.setNonce(nonce)
+	obj.setCode(codeHash, code)
+	obj.dirtyCode = false
+}
+
+// InjectStorage 不记录journal地覆盖账户某个slot的值，注入的值视为交易开始前的已提交值
+func (s *StateDB) InjectStorage(addr common.Address, key, value common.Hash) {
+	obj := s.getStateObject(addr)
+	if obj == nil {
+		obj = newObject(s, addr, types.StateAccount{})
+		s.setStateObject(obj)
+	}
+	delete(obj.dirtyStorage, key)
+	obj.pendingStorage[key] = value
+}
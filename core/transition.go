@@ -21,9 +21,10 @@ func ApplyTransaction(msg *TxMessage, evmEvent *evm.EVM) (executionResult *Execu
 	SnapShot := evmEvent.StateDB.Snapshot()
 
 	// 交易预检查
+	// 执行前的检查失败时回滚到快照，交易被拒绝
 	if err := PreCheck(msg, evmEvent); err != nil {
 		fmt.Printf("%sERROR MSG%s   交易执行出错 in PreCheck function\n", types.FRED, types.FRESET)
-		return NewExecutionResult(0, err, nil, false, nil)
+		return rejectTransaction(evmEvent, SnapShot, err)
 	}
 
 	var (
@@ -37,24 +38,24 @@ func ApplyTransaction(msg *TxMessage, evmEvent *evm.EVM) (executionResult *Execu
 	ExpenseGasBase, err := IntrinsicGas(msg.Data, msg.AccessList, ContractCreation)
 	if err != nil {
 		fmt.Printf("%sERROR MSG%s   汽油费错误 in IntrinsicGas function\n", types.FRED, types.FRESET)
-		return NewExecutionResult(0, err, nil, false, nil)
+		return rejectTransaction(evmEvent, SnapShot, err)
 	}
 	if GasRemainBefore < ExpenseGasBase {
 		fmt.Printf("%sERROR MSG%s   汽油费错误 in GasRemain < ExpenseGas_Base\n", types.FRED, types.FRESET)
-		return NewExecutionResult(0, errors.New("gas is not enough in ExpenseGas_Base"), nil, false, nil)
+		return rejectTransaction(evmEvent, SnapShot, errors.New("gas is not enough in ExpenseGas_Base"))
 	}
 	GasRemainBefore -= ExpenseGasBase
 
 	// 检查是否有足够的钱来转账
 	if msg.Value.Sign() > 0 && !evmEvent.Context.CanTransfer(evmEvent.StateDB, msg.From, msg.Value) {
 		fmt.Printf("%sERROR MSG%s   汽油费错误 in 没有足够的钱转账\n", types.FRED, types.FRESET)
-		return NewExecutionResult(0, errors.New("insufficient funds for transfer"), nil, false, nil)
+		return rejectTransaction(evmEvent, SnapShot, errors.New("insufficient funds for transfer"))
 	}
 
 	// 检查初始代码是否超出大小（合约创建）
 	if ContractCreation && len(msg.Data) > params.MaxInitCodeSize {
 		fmt.Printf("%sERROR MSG%s   数据错误 in 初始代码超出大小\n", types.FRED, types.FRESET)
-		return NewExecutionResult(0, errors.New("max init-code size exceeded"), nil, false, nil)
+		return rejectTransaction(evmEvent, SnapShot, errors.New("max init-code size exceeded"))
 	}
 
 	// * 这里不再执行prepare函数，用户自己填写AccessList，并承担出错的风险，对接后续重构的担保人交易类型
@@ -66,6 +67,10 @@ func ApplyTransaction(msg *TxMessage, evmEvent *evm.EVM) (executionResult *Execu
 		CanParallel    bool                                    // 交易能否并行
 		TrueAccessList *accesslist.AccessList                  // 真正的AccessList 我们依然获取到真实的AccessList并返回给用户，但是不再修改
 	)
+	// 串行执行时解释器会把每次操作访问到的AccessList合并进来
+	if !IsParallel {
+		TrueAccessList = accesslist.NewAccessList()
+	}
 
 	if ContractCreation {
 		// 合约创建交易
@@ -77,8 +82,8 @@ func ApplyTransaction(msg *TxMessage, evmEvent *evm.EVM) (executionResult *Execu
 	}
 	msg.CanParallel = CanParallel
 
-	// 并行组交易无法并行执行
-	if EvmError == nil && (IsParallel && !CanParallel) {
+	// 并行组交易无法并行执行，此时的执行错误可能是读到了未声明的状态导致的，同样交给串行队列重新执行
+	if IsParallel && !CanParallel {
 		fmt.Printf("%sPROMPT MSG%s   并行组中的交易无法并行执行\n", types.FGREEN, types.FRESET)
 		evmEvent.StateDB.RevertToSnapshot(SnapShot) // 快照回滚
 		return NewExecutionResult(0, nil, nil, true, nil)
@@ -88,25 +93,32 @@ func ApplyTransaction(msg *TxMessage, evmEvent *evm.EVM) (executionResult *Execu
 	if EvmError == nil {
 		// 多余的汽油费还给用户
 		fmt.Printf("%sPROMPT MSG%s   交易没有出错，归还汽油费\n", types.FGREEN, types.FRESET)
-		RefundGas(ExpenseGasBase+GasRemainBefore-GasRemainAfter, GasRemainAfter, evmEvent, msg)
-		// Coinbase交易
-		CoinbaseFee := new(big.Int).SetUint64(ExpenseGasBase + GasRemainBefore - GasRemainAfter)
-		CoinbaseFee.Mul(CoinbaseFee, msg.GasTipCap)
-		evmEvent.StateDB.AddBalance(evmEvent.Context.Coinbase, CoinbaseFee)
+		// 退款只计算一次，扣除后的汽油同时用于收费、收据的GasUsed与区块的汽油总量
+		GasUsed := ExpenseGasBase + GasRemainBefore - GasRemainAfter
+		GasUsed -= RefundedGas(GasUsed, evmEvent)
+		// 结算汽油费，担保交易按折扣后的汽油收费
+		Charged := ChargedGas(msg, GasUsed, false)
+		RefundGas(Charged, evmEvent, msg)
+		PayFees(msg, Charged, evmEvent)
 
-		return NewExecutionResult(ExpenseGasBase+GasRemainBefore-GasRemainAfter, nil, ReturnData, false, TrueAccessList)
+		return NewExecutionResult(GasUsed, nil, ReturnData, false, TrueAccessList)
 	} else {
 		// 交易出错，不归还汽油费，将剩余汽油费交给被选举人
 		fmt.Printf("%sPROMPT MSG%s   交易出错，不归还用户汽油费\n", types.FGREEN, types.FRESET)
-		// Coinbase交易
-		CoinbaseFee := new(big.Int).SetUint64(ExpenseGasBase + GasRemainBefore)
-		CoinbaseFee.Mul(CoinbaseFee, msg.GasTipCap)
-		evmEvent.StateDB.AddBalance(evmEvent.Context.Coinbase, CoinbaseFee)
+		// 结算汽油费，担保交易按 1.5 * GasLimit 收费
+		PayFees(msg, ChargedGas(msg, ExpenseGasBase+GasRemainBefore, true), evmEvent)
 
-		return NewExecutionResult(ExpenseGasBase+GasRemainBefore, EvmError, nil, false, nil)
+		// 返回数据中可能带有revert原因
+		return NewExecutionResult(ExpenseGasBase+GasRemainBefore, EvmError, ReturnData, false, TrueAccessList)
 	}
 }
 
+// rejectTransaction 交易在执行前被拒绝：回滚已经做出的修改（例如预付的汽油费），返回包装了ErrTxRejected的错误
+func rejectTransaction(evmEvent *evm.EVM, snapshot int, err error) *ExecutionResult {
+	evmEvent.StateDB.RevertToSnapshot(snapshot)
+	return NewExecutionResult(0, fmt.Errorf("%w: %w", ErrTxRejected, err), nil, false, nil)
+}
+
 // PreCheck 交易预检查函数，主要检查Nonce，账户是否合法，EIP-1559相关信息
 func PreCheck(msg *TxMessage, evmEvent *evm.EVM) error {
 	// Nonce检查
@@ -145,20 +157,164 @@ func PreCheck(msg *TxMessage, evmEvent *evm.EVM) error {
 	return BuyGas(msg, evmEvent)
 }
 
-// BuyGas 买汽油函数，买gas limit这么多汽油费
+// BuyGas 买汽油函数，向汽油费支付方买BoughtGas这么多汽油费，转账金额仍由发送方支付
 func BuyGas(msg *TxMessage, evmEvent *evm.EVM) error {
-	LimitGas := new(big.Int).SetUint64(msg.GasLimit)   // gas limit
-	BalanceGas := LimitGas.Mul(LimitGas, msg.GasPrice) // gas limit * gas price
-	BalanceGas.Add(BalanceGas, msg.Value)              // gas + value
-	if have, want := evmEvent.StateDB.GetBalance(msg.From), BalanceGas; have.Cmp(want) < 0 {
-		return fmt.Errorf("%w: address %v have %v want %v", errors.New("insufficient funds for gas * price + value"), msg.From.Hex(), have, want)
+	Payer := msg.GasPayer()
+	BalanceGas := new(big.Int).SetUint64(BoughtGas(msg)) // 预付的汽油
+	BalanceGas.Mul(BalanceGas, msg.GasPrice)             // gas * gas price
+
+	if Payer == msg.From {
+		want := new(big.Int).Add(BalanceGas, msg.Value) // gas + value
+		if have := evmEvent.StateDB.GetBalance(msg.From); have.Cmp(want) < 0 {
+			return fmt.Errorf("%w: address %v have %v want %v", errors.New("insufficient funds for gas * price + value"), msg.From.Hex(), have, want)
+		}
+	} else {
+		if have := evmEvent.StateDB.GetBalance(Payer); have.Cmp(BalanceGas) < 0 {
+			return fmt.Errorf("%w: guarantor %v have %v want %v", errors.New("insufficient guarantor funds for gas * price"), Payer.Hex(), have, BalanceGas)
+		}
+		if have := evmEvent.StateDB.GetBalance(msg.From); have.Cmp(msg.Value) < 0 {
+			return fmt.Errorf("%w: address %v have %v want %v", errors.New("insufficient funds for value"), msg.From.Hex(), have, msg.Value)
+		}
 	}
 
-	// 扣除汽油费
-	evmEvent.StateDB.SubBalance(msg.From, BalanceGas)
+	// 扣除汽油费，转账金额在执行时由evm转账
+	evmEvent.StateDB.SubBalance(Payer, BalanceGas)
 	return nil
 }
 
+// BoughtGas 交易执行前预付的汽油数量，担保交易需要预付出错时的惩罚汽油 1.5 * GasLimit
+func BoughtGas(msg *TxMessage) uint64 {
+	if msg.Guarantor != nil {
+		return msg.GasLimit * params.GuarErrGasNumerator / params.GuarErrGasDenominator
+	}
+	return msg.GasLimit
+}
+
+// ChargedGas 实际收取的汽油数量；非担保交易即使用的汽油，担保交易正常执行打折收取，出错时收取 1.5 * GasLimit
+func ChargedGas(msg *TxMessage, usedGas uint64, failed bool) uint64 {
+	if msg.Guarantor == nil {
+		return usedGas
+	}
+	if failed {
+		return BoughtGas(msg)
+	}
+	return usedGas * params.GuarGasDiscountNumerator / params.GuarGasDiscountDenominator
+}
+
+// AccessListPenaltyGas 按惩罚规则计算声明的AccessList与实际访问不一致的惩罚汽油，一致或没有惩罚规则时为0
+// 实际访问包括解释器记录的TrueAccessList以及交易本身的发送方和接收方，未声明与未使用的地址、slot都计入不一致
+func AccessListPenaltyGas(cfg *params.AccessListPenaltyConfig, msg *TxMessage, trueAccessList *accesslist.AccessList) uint64 {
+	if cfg == nil || trueAccessList == nil {
+		return 0
+	}
+	Actual := actualAccessList(msg, trueAccessList)
+	Declared := msg.AccessList
+	if Declared == nil {
+		Declared = accesslist.NewAccessList()
+	}
+	MissingAddrs, MissingSlots := accessListDiff(Actual, Declared) // 未声明
+	UnusedAddrs, UnusedSlots := accessListDiff(Declared, Actual)   // 未使用
+	WrongAddrs, WrongSlots := readOnlyViolations(Actual, Declared) // 写入了声明为只读的项
+	Addrs, Slots := MissingAddrs+UnusedAddrs+WrongAddrs, MissingSlots+UnusedSlots+WrongSlots
+	if Addrs == 0 && Slots == 0 {
+		return 0
+	}
+	return cfg.BaseGas + cfg.AddressGas*Addrs + cfg.SlotGas*Slots
+}
+
+// actualAccessList 交易实际访问的AccessList：解释器记录的TrueAccessList加上交易本身的发送方和接收方
+func actualAccessList(msg *TxMessage, trueAccessList *accesslist.AccessList) *accesslist.AccessList {
+	Actual := trueAccessList.Copy()
+	Actual.AddWriteAddress(msg.From)
+	if msg.To != nil {
+		if msg.Value != nil && msg.Value.Sign() > 0 {
+			Actual.AddWriteAddress(*msg.To)
+		} else {
+			Actual.AddReadAddress(*msg.To)
+		}
+	}
+	return Actual
+}
+
+// accessListDiff 统计a中存在而b中不存在的地址数与slot数
+func accessListDiff(a, b *accesslist.AccessList) (addrs uint64, slots uint64) {
+	for addr, idx := range a.Addresses {
+		if !b.ContainsAddress(addr) {
+			addrs++
+		}
+		if idx < 0 || idx >= len(a.Slots) {
+			continue
+		}
+		for slot := range a.Slots[idx] {
+			if _, ok := b.Contains(addr, slot); !ok {
+				slots++
+			}
+		}
+	}
+	return addrs, slots
+}
+
+// readOnlyViolations 统计实际写入、但在声明的AccessList中被标记为只读的地址数与slot数
+func readOnlyViolations(actual, declared *accesslist.AccessList) (addrs uint64, slots uint64) {
+	for addr, idx := range actual.Addresses {
+		if !actual.IsReadOnly(addr) && declared.IsReadOnly(addr) {
+			addrs++
+		}
+		if idx < 0 || idx >= len(actual.Slots) {
+			continue
+		}
+		for slot := range actual.Slots[idx] {
+			if !actual.IsReadOnlySlot(addr, slot) && declared.IsReadOnlySlot(addr, slot) {
+				slots++
+			}
+		}
+	}
+	return addrs, slots
+}
+
+// ChargeAccessListPenalty 向汽油费支付方收取惩罚汽油，与其他汽油费一样按PayFees结算
+// 支付方余额不足时最多收取余额能够支付的汽油，返回实际收取的惩罚汽油数量；GasPrice为0时无法收取，返回0
+// 惩罚汽油只记录在收据的AccessListPenalty中，不计入收据与区块的GasUsed：它不消耗区块的GasLimit，
+// GasUsed仍然只反映执行本身，区块的GasUsed与收据之和保持一致
+func ChargeAccessListPenalty(msg *TxMessage, penaltyGas uint64, evmEvent *evm.EVM) uint64 {
+	if penaltyGas == 0 || msg.GasPrice.Sign() == 0 {
+		return 0
+	}
+	Payer := msg.GasPayer()
+	Affordable := new(big.Int).Div(evmEvent.StateDB.GetBalance(Payer), msg.GasPrice)
+	if Affordable.IsUint64() && Affordable.Uint64() < penaltyGas {
+		penaltyGas = Affordable.Uint64()
+	}
+	Penalty := new(big.Int).Mul(new(big.Int).SetUint64(penaltyGas), msg.GasPrice)
+	evmEvent.StateDB.SubBalance(Payer, Penalty)
+	PayFees(msg, penaltyGas, evmEvent)
+	return penaltyGas
+}
+
+// EffectiveTip 每单位汽油实际支付给coinbase的小费 = min(GasTipCap, GasFeeCap - baseFee)
+func EffectiveTip(msg *TxMessage, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return new(big.Int).Set(msg.GasPrice)
+	}
+	return new(big.Int).Sub(msg.GasPrice, baseFee)
+}
+
+// PayFees 结算gas数量的汽油费（支付方已按GasPrice预付）：小费部分交给coinbase，基础费部分销毁，配置了FeeCollector时转给FeeCollector
+// 收费账户只记录可交换的余额增量，不写入账户，区块结束时统一写入状态，因此coinbase不会成为各并行组共同的写入项
+func PayFees(msg *TxMessage, gas uint64, evmEvent *evm.EVM) {
+	Gas := new(big.Int).SetUint64(gas)
+	BaseFee := evmEvent.Context.BaseFee
+	evmEvent.StateDB.AddBalanceDelta(evmEvent.Context.Coinbase, new(big.Int).Mul(Gas, EffectiveTip(msg, BaseFee)))
+	if BaseFee == nil {
+		return
+	}
+	if Collector := evmEvent.ChainConfig().FeeCollector; Collector != nil {
+		evmEvent.StateDB.AddBalanceDelta(*Collector, new(big.Int).Mul(Gas, BaseFee))
+	} else {
+		evmEvent.StateDB.AddBurnt(new(big.Int).Mul(Gas, BaseFee))
+	}
+}
+
 // IntrinsicGas 计算具有给定数据的消息的内在燃料
 func IntrinsicGas(data []byte, accessList *accesslist.AccessList, isContractCreation bool) (uint64, error) {
 	var gas uint64
@@ -221,20 +377,19 @@ func NewExecutionResult(UsedGas uint64, Err error, ReturnData []byte, IsParallel
 	}
 }
 
-// RefundGas 还钱
-func RefundGas(GasUsed uint64, GasRemain uint64, evmEvent *evm.EVM, msg *TxMessage) {
-	// Apply refund counter, capped to a refund quotient
+// RefundedGas 执行中累计的退款汽油，最多为使用汽油的一半
+func RefundedGas(GasUsed uint64, evmEvent *evm.EVM) uint64 {
 	refund := GasUsed / 2
 	if refund > evmEvent.StateDB.GetRefund() {
 		refund = evmEvent.StateDB.GetRefund()
 	}
-	GasRemain += refund
+	return refund
+}
 
+// RefundGas 还钱：预付的汽油中除了实际收取的Charged之外全部退还给汽油费支付方
+// 包括剩余的汽油、执行中的退款、担保交易额外预付的惩罚汽油以及打折减免的汽油
+func RefundGas(Charged uint64, evmEvent *evm.EVM, msg *TxMessage) {
 	// Return ETH for remaining gas, exchanged at the original rate.
-	remaining := new(big.Int).Mul(new(big.Int).SetUint64(GasRemain), msg.GasPrice)
-	evmEvent.StateDB.AddBalance(msg.From, remaining)
-
-	//// Also return remaining gas to the block gas counter so it is
-	//// available for the next transaction.
-	//st.gp.AddGas(st.gasRemaining)	TODO:汽油池去掉了
+	remaining := new(big.Int).Mul(new(big.Int).SetUint64(BoughtGas(msg)-Charged), msg.GasPrice)
+	evmEvent.StateDB.AddBalance(msg.GasPayer(), remaining)
 }
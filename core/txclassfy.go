@@ -2,154 +2,294 @@ package core
 
 import (
 	"bytes"
-	"math/big"
 	"sort"
 
 	"github.com/SipengXie/pangu/accesslist"
 	"github.com/SipengXie/pangu/common"
 	"github.com/SipengXie/pangu/core/types"
-	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/SipengXie/pangu/params"
 )
 
-type TxClass struct {
-	Tx         *types.Transaction
-	ID         int
-	TxResource mapset.Set[string]
+// resourceKey 交易访问的一项资源：账户本身，或者账户下的一个slot
+type resourceKey struct {
+	Address common.Address
+	Slot    common.Hash
+	HasSlot bool
 }
 
-// NewTxClassList 生成一个TxClass用于对交易列表进行分类
-func NewTxClassList(txs types.Transactions) []TxClass {
-	var txClass []TxClass
-	for i := 0; i < len(txs); i++ {
-		var temp TxClass
-		temp.Tx = txs[i]
-		temp.ID = i
-		temp.TxResource = MergeAccessList(txs[i].AccessList())
-		txClass = append(txClass, temp)
-	}
-	return txClass
+// txResources 交易会访问的资源及是否写入：al（声明的或预测的AccessList）中的地址与slot，加上执行时一定会修改的账户
+// AccessList中标记为只读的项按读处理，未标记的项按写处理
+// 发送方（nonce）、担保人（汽油费）、聚合者（nonce）、聚合交易各内部交易的发送方以及接收转账的账户即使没有写在AccessList中也按写计入资源
+// 合并分组状态时按账户整体检测写-写冲突，因此写入某个slot同时按写计入账户本身：写同一合约不同slot的交易分在同一组，读slot仍按slot计入
+func txResources(tx *types.Transaction, signer types.Signer, al *accesslist.AccessList) map[resourceKey]bool {
+	keys := make(map[resourceKey]bool)
+	addKey := func(key resourceKey, write bool) {
+		keys[key] = keys[key] || write
+	}
+	if al != nil {
+		for addr, idx := range al.Addresses {
+			if idx < 0 || idx >= len(al.Slots) {
+				addKey(resourceKey{Address: addr}, !al.IsReadOnly(addr))
+				continue
+			}
+			for slot := range al.Slots[idx] {
+				write := !al.IsReadOnlySlot(addr, slot)
+				addKey(resourceKey{Address: addr, Slot: slot, HasSlot: true}, write)
+				if write {
+					addKey(resourceKey{Address: addr}, true)
+				}
+			}
+		}
+	}
+	if from, err := types.Sender(signer, tx); err == nil {
+		addKey(resourceKey{Address: from}, true)
+	}
+	if tx.IsGuaranteed() {
+		if guarantor, err := types.Guarantor(signer, tx); err == nil {
+			addKey(resourceKey{Address: guarantor}, true)
+		}
+	}
+	for _, inner := range tx.InnerTxs() {
+		if from, err := types.Sender(signer, inner); err == nil {
+			addKey(resourceKey{Address: from}, true)
+		}
+		if to := inner.To(); to != nil && inner.Value().Sign() > 0 {
+			addKey(resourceKey{Address: *to}, true)
+		}
+	}
+	if to := tx.To(); to != nil && tx.Value().Sign() > 0 {
+		addKey(resourceKey{Address: *to}, true)
+	}
+	return keys
 }
 
-// NewTxResource 建每个交易的资源集合
-func NewTxResource(txs types.Transactions) map[*types.Transaction]mapset.Set[string] {
-	// 使用map构建每个交易的资源集合
-	txSet := make(map[*types.Transaction]mapset.Set[string])
-	for _, tx := range txs {
-		al := tx.AccessList()
-		txSet[tx] = MergeAccessList(al)
-	} // 现在每个tx后面跟着一个资源Set
-	return txSet
+// resourceOwner 一项资源的访问者：第一个写入它的交易，以及在出现写入者之前读取它的交易
+type resourceOwner struct {
+	writer  int // -1表示还没有交易写入
+	readers []int
 }
 
-// MergeAccessList 将AccessList中的Address和StorageKey进行合并得到一个集合
-func MergeAccessList(al *accesslist.AccessList) mapset.Set[string] {
-	set := mapset.NewSet[string]()
-	for addr, num := range al.Addresses {
-		addrStr := addr.Hex()
-		if num > 0 { // num > 0说明有 slots
-			for key, _ := range al.Slots[num] {
-				keyStr := key.Hex()
-				set.Add(addrStr + keyStr)
-			}
-		} else {
-			set.Add(addrStr)
-		}
+// unionFind 按秩合并、路径压缩的并查集
+type unionFind struct {
+	parent []int
+	rank   []byte
+}
+
+func newUnionFind(n int) *unionFind {
+	uf := &unionFind{parent: make([]int, n), rank: make([]byte, n)}
+	for i := range uf.parent {
+		uf.parent[i] = i
 	}
-	return set
+	return uf
 }
 
-// IsConflict 判断两个集合是否存在交集
-func IsConflict(set1, set2 mapset.Set[string]) bool {
-	temp := set1.Intersect(set2)
-	if temp.Cardinality() != 0 {
-		return true
-	} else {
-		return false
+func (uf *unionFind) find(x int) int {
+	for uf.parent[x] != x {
+		uf.parent[x] = uf.parent[uf.parent[x]]
+		x = uf.parent[x]
 	}
+	return x
 }
 
-// ClassifyTx TODO: 对交易按资源是否冲突进行分类
-// 返回的map中每个int对应一个类，但不保证int是连续单增的，即int是什么不重要
-// 其中每个类别的交易序列按地址进行排序，若地址相同则按其Nonce从小到大排序
+func (uf *unionFind) union(x, y int) {
+	x, y = uf.find(x), uf.find(y)
+	if x == y {
+		return
+	}
+	if uf.rank[x] < uf.rank[y] {
+		x, y = y, x
+	}
+	uf.parent[y] = x
+	if uf.rank[x] == uf.rank[y] {
+		uf.rank[x]++
+	}
+}
+
+// ClassifyTx 对交易按资源是否冲突进行分类，返回冲突图的连通分量，不同分量之间没有写-写或读-写冲突
+// 多笔交易只读同一资源时不合并；每项资源记录第一个写入者，之后的访问者与写入者合并，先前的读取者在出现写入者时合并一次，总开销与资源数近似线性
+// 返回的分组顺序是确定的，同样的交易集合在任何节点上得到同样的分组顺序：
+// 1. 每个组内的交易按From地址从小到大排序，若地址相同则按其Nonce从小到大排序，再相同则按哈希从小到大排序
+// 2. 组与组之间按各组第一笔交易的同样规则排序
+// 加密交易声明的AccessList为空，分组结果不反映其实际访问，执行时总是放到串行队列
 func ClassifyTx(txs types.Transactions, signer types.Signer) []types.Transactions {
-	// 对txClassList的ID进行处理
-	txClassList := NewTxClassList(txs)
-	TxClassListLen := len(txClassList)
-	for i := 0; i < TxClassListLen; i++ {
-		for j := i + 1; j < TxClassListLen; j++ {
-			if !IsConflict(txClassList[i].TxResource, txClassList[j].TxResource) {
-				continue // 不存在冲突则继续循环
-			} else { // 若存在冲突，两个交易合为一类
-				txClassList[j].ID = txClassList[i].ID // 分类的ID进行改变
-				txClassList[i].TxResource = txClassList[i].TxResource.Union(txClassList[j].TxResource)
-				txClassList[j].TxResource = txClassList[i].TxResource // 交易的资源合并再继续与之后的交易进行比较
+	groups, _ := ClassifyTxPredicted(txs, signer, nil)
+	return groups
+}
+
+// ClassifyTxPredicted 按预执行结果对交易分类，没有预测结果的交易按声明的AccessList分组
+// 有预测结果的交易按预测的访问集合分组；预测会与声明冲突的交易执行时会被降级，连同同一发送方的交易一起放入likelySerial，不参与分组
+func ClassifyTxPredicted(txs types.Transactions, signer types.Signer, predictions Predictions) (groups []types.Transactions, likelySerial types.Transactions) {
+	// 同一发送方的交易必须按nonce顺序执行，一笔被降级时同一发送方之后的交易也会被降级
+	serialSenders := make(map[common.Address]struct{})
+	for _, tx := range txs {
+		if pred := predictions[tx.Hash()]; pred != nil && pred.Conflict {
+			if from, err := types.Sender(signer, tx); err == nil {
+				serialSenders[from] = struct{}{}
 			}
 		}
 	}
-	// 对交易进行分组
-	groups := make(map[int][]*types.Transaction)
-	for i := 0; i < TxClassListLen; i++ {
-		if _, ok := groups[txClassList[i].ID]; ok {
-			// key 存在，可以使用 value
-			groups[txClassList[i].ID] = append(groups[txClassList[i].ID], txClassList[i].Tx)
+	rest := make(types.Transactions, 0, len(txs))
+	for _, tx := range txs {
+		from, err := types.Sender(signer, tx)
+		if _, ok := serialSenders[from]; ok && err == nil {
+			likelySerial = append(likelySerial, tx)
 		} else {
-			// key 不存在，增加该 key
-			groups[txClassList[i].ID] = make([]*types.Transaction, 0)
-			groups[txClassList[i].ID] = append(groups[txClassList[i].ID], txClassList[i].Tx)
-
+			rest = append(rest, tx)
 		}
 	}
-	// 对每个组按From地址排序
-	for _, txList := range groups {
-		sort.Slice(txList, func(i, j int) bool {
-			acct1, _ := types.Sender(signer, txList[i])
-			acct2, _ := types.Sender(signer, txList[j])
-			if bytes.Compare(acct1.Bytes(), acct2.Bytes()) < 0 {
-				return true
-			} else if bytes.Compare(acct1.Bytes(), acct2.Bytes()) > 0 {
-				return false
+	SortGroupTX(likelySerial, signer)
+	return classify(rest, signer, predictions), likelySerial
+}
+
+// classify 按资源冲突求交易的连通分量，有预测结果的交易使用预测的访问集合
+func classify(txs types.Transactions, signer types.Signer, predictions Predictions) []types.Transactions {
+	var (
+		uf     = newUnionFind(len(txs))
+		owners = make(map[resourceKey]*resourceOwner)
+	)
+	for i, tx := range txs {
+		al := tx.AccessList()
+		if pred := predictions[tx.Hash()]; pred != nil && pred.AccessList != nil {
+			al = pred.AccessList
+		}
+		for key, write := range txResources(tx, signer, al) {
+			owner, ok := owners[key]
+			if !ok {
+				owner = &resourceOwner{writer: -1}
+				owners[key] = owner
+			}
+			switch {
+			case owner.writer >= 0:
+				uf.union(i, owner.writer)
+			case write:
+				owner.writer = i
+			default:
+				owner.readers = append(owner.readers, i)
+				continue
 			}
-			return txList[i].Nonce() < txList[j].Nonce()
-		})
+			// 写入者出现后，之前的读取者都与它冲突
+			for _, j := range owner.readers {
+				uf.union(i, j)
+			}
+			owner.readers = nil
+		}
 	}
-	groupsRes := make([]types.Transactions, 0)
+	// 对交易进行分组
+	groups := make(map[int]types.Transactions)
+	for i, tx := range txs {
+		root := uf.find(i)
+		groups[root] = append(groups[root], tx)
+	}
+	groupsRes := make([]types.Transactions, 0, len(groups))
 	for _, txList := range groups {
+		SortGroupTX(txList, signer)
 		groupsRes = append(groupsRes, txList)
 	}
+	// 按每组第一笔交易对组排序，消除map遍历顺序带来的随机性
+	sort.Slice(groupsRes, func(i, j int) bool {
+		return txCanonicalLess(groupsRes[i][0], groupsRes[j][0], signer)
+	})
 	return groupsRes
 }
 
-// FindMaxGasPrice
-func FindMaxGasPrice(txMap map[common.Address][]*types.Transaction) common.Address {
-	var maxGasPriceAddr common.Address
-	maxGasPrice := big.NewInt(0)
-	for addr, txs := range txMap {
-		if txs[0].GasPrice().Cmp(maxGasPrice) > 0 {
-			maxGasPriceAddr = addr
-			maxGasPrice = txs[0].GasPrice()
+// PackGroups 把互不冲突的分组按估计的汽油（GasLimit之和）装入lanes个执行通道，使每个通道的汽油尽量均衡
+// 按汽油从大到小依次放入当前汽油最少的通道（LPT），同一通道内各分组仍按原来的顺序排列；lanes不大于0时不合并
+func PackGroups(groups []types.Transactions, lanes int) []types.Transactions {
+	if lanes <= 0 || len(groups) <= lanes {
+		return groups
+	}
+	gas := make([]uint64, len(groups))
+	order := make([]int, len(groups))
+	for i, group := range groups {
+		for _, tx := range group {
+			gas[i] += tx.GasLimit()
 		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return gas[order[i]] > gas[order[j]]
+	})
+	var (
+		laneGas    = make([]uint64, lanes)
+		laneGroups = make([][]int, lanes)
+	)
+	for _, g := range order {
+		lane := 0
+		for l := 1; l < lanes; l++ {
+			if laneGas[l] < laneGas[lane] {
+				lane = l
+			}
+		}
+		laneGas[lane] += gas[g]
+		laneGroups[lane] = append(laneGroups[lane], g)
+	}
+	for _, members := range laneGroups {
+		sort.Ints(members)
 	}
-	return maxGasPriceAddr
+	// 通道之间按各自第一个分组的顺序排列，没有分到分组的通道去掉
+	sort.Slice(laneGroups, func(i, j int) bool {
+		if len(laneGroups[i]) == 0 || len(laneGroups[j]) == 0 {
+			return len(laneGroups[j]) == 0 && len(laneGroups[i]) != 0
+		}
+		return laneGroups[i][0] < laneGroups[j][0]
+	})
+	packed := make([]types.Transactions, 0, lanes)
+	for _, members := range laneGroups {
+		if len(members) == 0 {
+			break
+		}
+		var lane types.Transactions
+		for _, g := range members {
+			lane = append(lane, groups[g]...)
+		}
+		packed = append(packed, lane)
+	}
+	return packed
+}
+
+// SortGroupTX 组内交易排序：From地址从小到大，地址相同按Nonce从小到大，再相同按哈希从小到大
+func SortGroupTX(txList types.Transactions, signer types.Signer) {
+	sort.Slice(txList, func(i, j int) bool {
+		return txCanonicalLess(txList[i], txList[j], signer)
+	})
 }
 
-// TODO: SelectTxs 选出一些Transaction，这些Transaction的GasLimit的总和要最大且不超过整体的GasLimit
-func SelectTxs(txMap map[common.Address][]*types.Transaction, gasLimit uint64) types.Transactions {
-	// copy一个副本
-	temp := make(map[common.Address][]*types.Transaction)
-	for addr, txs := range txMap {
-		txsCopy := make([]*types.Transaction, len(txs))
-		copy(txsCopy, txs)
-		temp[addr] = txsCopy
-	}
-	var sum uint64
-	var selectedTxs types.Transactions
-	for {
-		if sum > gasLimit {
+// txCanonicalLess 交易的规范顺序比较函数
+func txCanonicalLess(tx1, tx2 *types.Transaction, signer types.Signer) bool {
+	acct1, _ := types.Sender(signer, tx1)
+	acct2, _ := types.Sender(signer, tx2)
+	if c := bytes.Compare(acct1.Bytes(), acct2.Bytes()); c != 0 {
+		return c < 0
+	}
+	if tx1.Nonce() != tx2.Nonce() {
+		return tx1.Nonce() < tx2.Nonce()
+	}
+	return tx1.Hash().Less(tx2.Hash())
+}
+
+// SelectTxs 按价格与nonce顺序（TransactionsByPriceAndNonce）选出一批交易，GasLimit之和不超过gasLimit，交易数不超过maxTxs（0表示不限制）
+// 某个账户的交易放不下时，该账户之后的交易也不再选择，放不下的交易留在交易池中等待下一个区块
+// 返回选出的交易以及它们的GasLimit之和
+func SelectTxs(txs *types.TransactionsByPriceAndNonce, gasLimit uint64, maxTxs int) (types.Transactions, uint64) {
+	var (
+		selected types.Transactions
+		gas      uint64
+	)
+	for tx := txs.Peek(); tx != nil; tx = txs.Peek() {
+		if maxTxs > 0 && len(selected) >= maxTxs {
 			break
 		}
-		selectedAddr := FindMaxGasPrice(temp)
-		selectedTxs = append(selectedTxs, temp[selectedAddr][0])
-		temp[selectedAddr] = temp[selectedAddr][1:] // 去掉对应地址中的第一个交易
+		// 剩余的汽油连一笔最简单的转账都放不下
+		if gasLimit-gas < params.TxGas {
+			break
+		}
+		if tx.GasLimit() > gasLimit-gas {
+			txs.Pop()
+			continue
+		}
+		selected = append(selected, tx)
+		gas += tx.GasLimit()
+		txs.Shift()
 	}
-	return selectedTxs
+	return selected, gas
 }
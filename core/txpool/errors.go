@@ -50,4 +50,8 @@ var (
 	// ErrFutureReplacePending is returned if a future transaction replaces a pending
 	// transaction. Future transactions should only be able to replace other future transactions.
 	ErrFutureReplacePending = errors.New("future transaction tries to replace pending")
+
+	// ErrEmptyAggregate is returned if an aggregate transaction carries no inner
+	// transactions.
+	ErrEmptyAggregate = errors.New("empty aggregate transaction")
 )
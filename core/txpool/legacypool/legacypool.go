@@ -280,7 +280,7 @@ func New(config Config, chain BlockChain) *LegacyPool {
 // pool, specifically, whether it is a Legacy, AccessList or Dynamic transaction.
 func (pool *LegacyPool) Filter(tx *types.Transaction) bool {
 	switch tx.Type() {
-	case types.PanguTxType:
+	case types.PanguTxType, types.GuaranteedTxType, types.AggregateTxType:
 		return true
 	default:
 		return false
@@ -577,7 +577,9 @@ func (pool *LegacyPool) validateTxBasics(tx *types.Transaction, local bool) erro
 	opts := &txpool.ValidationOptions{
 		Config: pool.chainconfig,
 		Accept: 0 |
-			1<<types.PanguTxType,
+			1<<types.PanguTxType |
+			1<<types.GuaranteedTxType |
+			1<<types.AggregateTxType,
 		MaxSize: txMaxSize,
 		MinTip:  pool.gasTip.Load(),
 	}
@@ -54,7 +54,7 @@ func ValidateTransaction(tx *types.Transaction, head *types.Header, signer types
 		return fmt.Errorf("%w: transaction size %v, limit %v", ErrOversizedData, tx.Size(), opts.MaxSize)
 	}
 	// Ensure only transactions that have been enabled are accepted
-	if tx.Type() != types.PanguTxType {
+	if tx.Type() != types.PanguTxType && tx.Type() != types.GuaranteedTxType && tx.Type() != types.AggregateTxType {
 		return fmt.Errorf("%w: type %d rejected, pool not yet in Berlin", types.ErrTxTypeNotSupported, tx.Type())
 	}
 	// Check whether the init code size has been exceeded
@@ -85,6 +85,12 @@ func ValidateTransaction(tx *types.Transaction, head *types.Header, signer types
 	if _, err := types.Sender(signer, tx); err != nil {
 		return ErrInvalidSender
 	}
+	// 担保交易还需要担保人签名正确
+	if tx.IsGuaranteed() {
+		if _, err := types.Guarantor(signer, tx); err != nil {
+			return ErrInvalidSender
+		}
+	}
 	// Ensure the transaction has more gas than the bare minimum needed to cover
 	// the transaction metadata
 	intrGas, err := tx.IntrinsicGas()
@@ -99,6 +105,42 @@ func ValidateTransaction(tx *types.Transaction, head *types.Header, signer types
 	if tx.GasTipCapIntCmp(opts.MinTip) < 0 {
 		return fmt.Errorf("%w: tip needed %v, tip permitted %v", ErrUnderpriced, opts.MinTip, tx.GasTipCap())
 	}
+	// 聚合交易作为一个整体验证，任何一笔内部交易不合法则整笔聚合交易不合法
+	if tx.IsAggregate() {
+		inner := tx.InnerTxs()
+		if len(inner) == 0 {
+			return ErrEmptyAggregate
+		}
+		for i, innerTx := range inner {
+			if err := validateInnerTx(innerTx, signer); err != nil {
+				return fmt.Errorf("inner tx %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateInnerTx 检查聚合交易中单笔内部交易的签名与汽油费
+func validateInnerTx(tx *types.Transaction, signer types.Signer) error {
+	if tx.To() == nil && len(tx.Data()) > params.MaxInitCodeSize {
+		return fmt.Errorf("%w: code size %v, limit %v", types.ErrMaxInitCodeSizeExceeded, len(tx.Data()), params.MaxInitCodeSize)
+	}
+	if tx.Value().Sign() < 0 {
+		return ErrNegativeValue
+	}
+	if tx.GasFeeCapIntCmp(tx.GasTipCap()) < 0 {
+		return types.ErrTipAboveFeeCap
+	}
+	if _, err := types.Sender(signer, tx); err != nil {
+		return ErrInvalidSender
+	}
+	intrGas, err := tx.IntrinsicGas()
+	if err != nil {
+		return err
+	}
+	if tx.GasLimit() < intrGas {
+		return fmt.Errorf("%w: needed %v, allowed %v", types.ErrIntrinsicGas, intrGas, tx.GasLimit())
+	}
 	return nil
 }
 
@@ -170,5 +212,20 @@ func ValidateTransactionWithState(tx *types.Transaction, signer types.Signer, op
 			return fmt.Errorf("%w: balance %v, queued cost %v, tx cost %v, overshot %v", types.ErrInsufficientFunds, balance, spent, cost, new(big.Int).Sub(need, balance))
 		}
 	}
+	// 聚合交易的费用由各内部交易的发送方支付，逐笔检查nonce与余额
+	if tx.IsAggregate() {
+		for i, innerTx := range tx.InnerTxs() {
+			innerFrom, err := types.Sender(signer, innerTx)
+			if err != nil {
+				return fmt.Errorf("inner tx %d: %w", i, err)
+			}
+			if next := opts.State.GetNonce(innerFrom); next > innerTx.Nonce() {
+				return fmt.Errorf("inner tx %d: %w: next nonce %v, tx nonce %v", i, types.ErrNonceTooLow, next, innerTx.Nonce())
+			}
+			if balance, cost := opts.State.GetBalance(innerFrom), innerTx.Cost(); balance.Cmp(cost) < 0 {
+				return fmt.Errorf("inner tx %d: %w: balance %v, tx cost %v", i, types.ErrInsufficientFunds, balance, cost)
+			}
+		}
+	}
 	return nil
 }
@@ -0,0 +1,134 @@
+package types
+
+import (
+	"math/big"
+
+	"github.com/SipengXie/pangu/accesslist"
+	"github.com/SipengXie/pangu/common"
+)
+
+// AggregateTransaction 聚合交易
+// 担保人把n笔用户交易打包到一个Cover中，只在Cover上签名一次；每笔内部交易仍然保留各自的用户签名
+// Nonce是聚合者（Cover签名者）的nonce，执行聚合交易时聚合者的nonce加一，之后依次执行内部交易
+type AggregateTransaction struct {
+	Nonce   uint64
+	ChainID *big.Int
+
+	SigAlgo   byte   // 聚合者选择的签名算法
+	Signature []byte // 聚合者对Cover的签名
+
+	Txs []*PanguTransaction // 内部交易
+}
+
+// NewAggregateTx 把已经签名的盘古交易打包成一笔未签名的聚合交易，之后由聚合者使用SignTx对Cover签名
+func NewAggregateTx(nonce uint64, chainID *big.Int, txs Transactions) (*Transaction, error) {
+	inner := make([]*PanguTransaction, len(txs))
+	for i, tx := range txs {
+		data, ok := tx.inner.(*PanguTransaction)
+		if !ok {
+			return nil, ErrInvalidTxType
+		}
+		inner[i] = data
+	}
+	return NewTx(&AggregateTransaction{Nonce: nonce, ChainID: chainID, Txs: inner}), nil
+}
+
+// copy creates a deep copy of the transaction data and initializes all fields.
+func (tx *AggregateTransaction) copy() TxData {
+	cpy := &AggregateTransaction{
+		Nonce:     tx.Nonce,
+		ChainID:   new(big.Int),
+		SigAlgo:   tx.SigAlgo,
+		Signature: common.CopyBytes(tx.Signature),
+		Txs:       make([]*PanguTransaction, len(tx.Txs)),
+	}
+	if tx.ChainID != nil {
+		cpy.ChainID.Set(tx.ChainID)
+	}
+	for i, inner := range tx.Txs {
+		cpy.Txs[i] = inner.copy().(*PanguTransaction)
+	}
+	return cpy
+}
+
+func (tx *AggregateTransaction) txType() byte        { return AggregateTxType }
+func (tx *AggregateTransaction) chainID() *big.Int   { return tx.ChainID }
+func (tx *AggregateTransaction) encContent() []byte  { return nil }
+func (tx *AggregateTransaction) data() []byte        { return nil }
+func (tx *AggregateTransaction) nonce() uint64       { return tx.Nonce }
+func (tx *AggregateTransaction) to() *common.Address { return nil }
+func (tx *AggregateTransaction) sigAlgo() byte       { return tx.SigAlgo }
+
+// accessList 所有内部交易AccessList的并集
+func (tx *AggregateTransaction) accessList() *accesslist.AccessList {
+	al := accesslist.NewAccessList()
+	for _, inner := range tx.Txs {
+		if inner.AccessList != nil {
+			al.CombineTrueAccessList(inner.AccessList)
+		}
+	}
+	return al
+}
+
+// value 所有内部交易转账金额之和
+func (tx *AggregateTransaction) value() *big.Int {
+	total := new(big.Int)
+	for _, inner := range tx.Txs {
+		total.Add(total, inner.Value)
+	}
+	return total
+}
+
+// gasLimit 所有内部交易GasLimit之和
+func (tx *AggregateTransaction) gasLimit() uint64 {
+	var total uint64
+	for _, inner := range tx.Txs {
+		total += inner.GasLimit
+	}
+	return total
+}
+
+// gasFeeCap 内部交易中最低的Max Fee，交易池按最差的内部交易给聚合交易定价
+func (tx *AggregateTransaction) gasFeeCap() *big.Int {
+	return tx.minOf(func(inner *PanguTransaction) *big.Int { return inner.FeeCap })
+}
+
+// gasTipCap 内部交易中最低的小费
+func (tx *AggregateTransaction) gasTipCap() *big.Int {
+	return tx.minOf(func(inner *PanguTransaction) *big.Int { return inner.TipCap })
+}
+
+func (tx *AggregateTransaction) gasPrice() *big.Int { return tx.gasFeeCap() }
+
+func (tx *AggregateTransaction) minOf(field func(*PanguTransaction) *big.Int) *big.Int {
+	var min *big.Int
+	for _, inner := range tx.Txs {
+		if v := field(inner); v != nil && (min == nil || v.Cmp(min) < 0) {
+			min = v
+		}
+	}
+	if min == nil {
+		return new(big.Int)
+	}
+	return min
+}
+
+func (tx *AggregateTransaction) rawSigValues() []byte {
+	return tx.Signature
+}
+
+func (tx *AggregateTransaction) setSigValues(chainID *big.Int, sig []byte, sigAlgo byte) {
+	tx.ChainID, tx.SigAlgo, tx.Signature = chainID, sigAlgo, sig
+}
+
+func (tx *AggregateTransaction) effectiveGasPrice(dst *big.Int, baseFee *big.Int) *big.Int {
+	feeCap, tipCap := tx.gasFeeCap(), tx.gasTipCap()
+	if baseFee == nil {
+		return dst.Set(feeCap)
+	}
+	tip := dst.Sub(feeCap, baseFee)
+	if tip.Cmp(tipCap) > 0 {
+		tip.Set(tipCap)
+	}
+	return tip.Add(tip, baseFee)
+}
@@ -0,0 +1,112 @@
+package types
+
+import (
+	"math/big"
+
+	"github.com/SipengXie/pangu/accesslist"
+	"github.com/SipengXie/pangu/common"
+)
+
+// GuaranteedTransaction 担保交易
+// 担保人检查并填写AccessList后对交易签名（Ensurance），用户再对包括担保人签名在内的整个交易签名（Signature）
+// 交易被担保后，所有汽油费、惩罚汽油费都由担保人支付
+type GuaranteedTransaction struct {
+	To       *common.Address `rlp:"nil"`
+	Nonce    uint64
+	Value    *big.Int
+	GasLimit uint64
+	FeeCap   *big.Int // Max Fee
+	TipCap   *big.Int // 小费
+	ChainID  *big.Int
+
+	SigAlgo     byte   // 用户选择的签名算法
+	Signature   []byte // 用户签名
+	GuarSigAlgo byte   // 担保人选择的签名算法
+	Ensurance   []byte // 担保人签名
+
+	EncAlgo    byte
+	EncContent []byte // EncContent <--> {Data, AccessList}
+	VmType     byte
+
+	Data       []byte
+	AccessList *accesslist.AccessList
+}
+
+// copy creates a deep copy of the transaction data and initializes all fields.
+func (tx *GuaranteedTransaction) copy() TxData {
+	cpy := &GuaranteedTransaction{
+		Nonce:       tx.Nonce,
+		To:          copyAddressPtr(tx.To),
+		Data:        common.CopyBytes(tx.Data),
+		GasLimit:    tx.GasLimit,
+		SigAlgo:     tx.SigAlgo,
+		Signature:   common.CopyBytes(tx.Signature),
+		GuarSigAlgo: tx.GuarSigAlgo,
+		Ensurance:   common.CopyBytes(tx.Ensurance),
+		EncAlgo:     tx.EncAlgo,
+		EncContent:  common.CopyBytes(tx.EncContent),
+		VmType:      tx.VmType,
+
+		// These are copied below.
+		AccessList: accesslist.NewAccessList(),
+		Value:      new(big.Int),
+		ChainID:    new(big.Int),
+		TipCap:     new(big.Int),
+		FeeCap:     new(big.Int),
+	}
+	if tx.AccessList != nil {
+		cpy.AccessList = tx.AccessList.Copy()
+	}
+	if tx.Value != nil {
+		cpy.Value.Set(tx.Value)
+	}
+	if tx.ChainID != nil {
+		cpy.ChainID.Set(tx.ChainID)
+	}
+	if tx.TipCap != nil {
+		cpy.TipCap.Set(tx.TipCap)
+	}
+	if tx.FeeCap != nil {
+		cpy.FeeCap.Set(tx.FeeCap)
+	}
+
+	return cpy
+}
+
+func (tx *GuaranteedTransaction) txType() byte                       { return GuaranteedTxType }
+func (tx *GuaranteedTransaction) chainID() *big.Int                  { return tx.ChainID }
+func (tx *GuaranteedTransaction) encContent() []byte                 { return tx.EncContent }
+func (tx *GuaranteedTransaction) accessList() *accesslist.AccessList { return tx.AccessList }
+func (tx *GuaranteedTransaction) data() []byte                       { return tx.Data }
+func (tx *GuaranteedTransaction) gasLimit() uint64                   { return tx.GasLimit }
+func (tx *GuaranteedTransaction) gasFeeCap() *big.Int                { return tx.FeeCap }
+func (tx *GuaranteedTransaction) gasTipCap() *big.Int                { return tx.TipCap }
+func (tx *GuaranteedTransaction) gasPrice() *big.Int                 { return tx.FeeCap }
+func (tx *GuaranteedTransaction) value() *big.Int                    { return tx.Value }
+func (tx *GuaranteedTransaction) nonce() uint64                      { return tx.Nonce }
+func (tx *GuaranteedTransaction) to() *common.Address                { return tx.To }
+func (tx *GuaranteedTransaction) sigAlgo() byte                      { return tx.SigAlgo }
+
+func (tx *GuaranteedTransaction) rawSigValues() []byte {
+	return tx.Signature
+}
+
+func (tx *GuaranteedTransaction) setSigValues(chainID *big.Int, sig []byte, sigAlgo byte) {
+	tx.ChainID, tx.SigAlgo, tx.Signature = chainID, sigAlgo, sig
+}
+
+// setGuarSigValues 设置担保人签名
+func (tx *GuaranteedTransaction) setGuarSigValues(chainID *big.Int, sig []byte, sigAlgo byte) {
+	tx.ChainID, tx.GuarSigAlgo, tx.Ensurance = chainID, sigAlgo, sig
+}
+
+func (tx *GuaranteedTransaction) effectiveGasPrice(dst *big.Int, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return dst.Set(tx.FeeCap)
+	}
+	tip := dst.Sub(tx.FeeCap, baseFee)
+	if tip.Cmp(tx.TipCap) > 0 {
+		tip.Set(tx.TipCap)
+	}
+	return tip.Add(tip, baseFee)
+}
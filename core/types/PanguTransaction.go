@@ -19,8 +19,7 @@ type PanguTransaction struct {
 	SigAlgo   byte
 	Signature []byte
 
-	// TODO: 暂时先不用
-	EncAlgo    byte
+	EncAlgo    byte   // 交易内容的加密算法，ENC_NONE表示未加密
 	EncContent []byte // EncContent <--> {Data, AccessList}
 	VmType     byte
 
@@ -31,13 +30,15 @@ type PanguTransaction struct {
 // copy creates a deep copy of the transaction data and initializes all fields.
 func (tx *PanguTransaction) copy() TxData {
 	cpy := &PanguTransaction{
-		Nonce:     tx.Nonce,
-		To:        copyAddressPtr(tx.To),
-		Data:      common.CopyBytes(tx.Data),
-		GasLimit:  tx.GasLimit,
-		SigAlgo:   tx.SigAlgo,
-		Signature: common.CopyBytes(tx.Signature),
-		// TODO : 其他东西
+		Nonce:      tx.Nonce,
+		To:         copyAddressPtr(tx.To),
+		Data:       common.CopyBytes(tx.Data),
+		GasLimit:   tx.GasLimit,
+		SigAlgo:    tx.SigAlgo,
+		Signature:  common.CopyBytes(tx.Signature),
+		EncAlgo:    tx.EncAlgo,
+		EncContent: common.CopyBytes(tx.EncContent),
+		VmType:     tx.VmType,
 
 		// These are copied below.
 		AccessList: new(accesslist.AccessList),
@@ -46,7 +47,9 @@ func (tx *PanguTransaction) copy() TxData {
 		TipCap:     new(big.Int),
 		FeeCap:     new(big.Int),
 	}
-	*cpy.AccessList = *tx.AccessList
+	if tx.AccessList != nil {
+		*cpy.AccessList = *tx.AccessList
+	}
 	if tx.Value != nil {
 		cpy.Value.Set(tx.Value)
 	}
@@ -19,13 +19,16 @@ type Header struct {
 	StateRoot   common.Hash    `json:"stateRoot"        gencodec:"required"`
 	TxRoot      common.Hash    `json:"transactionsRoot" gencodec:"required"` // Merkel
 	ReceiptRoot common.Hash    `json:"receiptsRoot"     gencodec:"required"` // Merkel
+	GroupRoot   common.Hash    `json:"groupRoot"        gencodec:"required"` // 执行布局（各轮分组边界与串行队列）的哈希
 	Bloom       Bloom          `json:"logsBloom"        gencodec:"required"`
 
-	BaseFee  *big.Int `json:"baseFeePerGas"    rlp:"optional"`
-	GasLimit uint64   `json:"gasLimit"         gencodec:"required"`
-	GasUsed  uint64   `json:"gasUsed"          gencodec:"required"`
+	GasLimit uint64 `json:"gasLimit"         gencodec:"required"`
+	GasUsed  uint64 `json:"gasUsed"          gencodec:"required"`
 
 	Extra []byte `json:"extraData"        gencodec:"required"` // this field is used for extension
+
+	// 可选字段只能放在最后，否则区块头无法RLP编码
+	BaseFee *big.Int `json:"baseFeePerGas"    rlp:"optional"`
 }
 
 // Hash returns the block hash of the header, which is simply the keccak256 hash of its
@@ -77,6 +80,8 @@ func CopyHeader(h *Header) *Header {
 type Body struct {
 	// Grouped Txs for parallel execution
 	transactions []Transactions
+	// 执行时实际使用的布局，与区块头的GroupRoot对应
+	layout *ExecLayout
 }
 
 type Block struct {
@@ -87,21 +92,57 @@ type Block struct {
 	size atomic.Value
 }
 
+// used for RLP encoding/decoding
+type extbody struct {
+	Txs    []Transactions
+	Layout *ExecLayout `rlp:"optional"`
+}
+
+// DecodeRLP 区块体的存储格式：二维分组的交易与执行布局
+func (b *Body) DecodeRLP(s *rlp.Stream) error {
+	var eb extbody
+	if err := s.Decode(&eb); err != nil {
+		return err
+	}
+	b.transactions, b.layout = eb.Txs, eb.Layout
+	return nil
+}
+
+// EncodeRLP 将区块体编码为存储格式
+func (b *Body) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, extbody{
+		Txs:    b.transactions,
+		Layout: b.layout,
+	})
+}
+
+// Transactions 区块体中按分组顺序展开的交易，与区块的Transactions顺序一致
+func (b *Body) Transactions() Transactions {
+	var txs Transactions
+	for _, group := range b.transactions {
+		txs = append(txs, group...)
+	}
+	return txs
+}
+
 // used for RLP encoding/decoding
 type extblock struct {
 	Header *Header
 	Txs    []Transactions
+	Layout *ExecLayout `rlp:"optional"`
 }
 
 // NewBlock creates a new block. The input data is copied,
 // changes to header and to the field values will not affect the
 // block.
 //
-// The values of TxHash, UncleHash, ReceiptHash and Bloom in header
-// are ignored and set to values derived from the given txs, uncles
+// The values of TxHash, GroupRoot, ReceiptHash and Bloom in header
+// are ignored and set to values derived from the given txs, layout
 // and receipts.
-func NewBlock(header *Header, txs []Transactions, receipts []*Receipt, stateRoot common.Hash, hasher TrieHasher) *Block {
+func NewBlock(header *Header, txs []Transactions, layout *ExecLayout, receipts []*Receipt, stateRoot common.Hash, hasher TrieHasher) *Block {
 	b := &Block{header: CopyHeader(header)}
+	b.header.GroupRoot = layout.Hash()
+	b.layout = layout
 
 	// TODO: panic if len(txs) != len(receipts)
 	if len(txs) == 0 {
@@ -138,6 +179,21 @@ func InitBlock(header *Header, txs []Transactions) *Block {
 	return b
 }
 
+// NewBlockWithBody 由数据库中分别存储的区块头与区块体还原区块，区块头中的各个根不会重新计算
+func NewBlockWithBody(header *Header, body *Body) *Block {
+	b := &Block{header: CopyHeader(header)}
+	if body != nil {
+		b.SetTransactions(body.transactions)
+		b.layout = body.layout
+	}
+	return b
+}
+
+// GetBody 区块体，用于与区块头分开存储
+func (b *Block) GetBody() *Body {
+	return &Body{transactions: b.transactions, layout: b.layout}
+}
+
 func (b *Block) SetTransactions(txs []Transactions) {
 	b.transactions = make([]Transactions, len(txs))
 	copy(b.transactions, txs)
@@ -150,7 +206,7 @@ func (b *Block) DecodeRLP(s *rlp.Stream) error {
 	if err := s.Decode(&eb); err != nil {
 		return err
 	}
-	b.header, b.transactions = eb.Header, eb.Txs
+	b.header, b.transactions, b.layout = eb.Header, eb.Txs, eb.Layout
 	b.size.Store(rlp.ListSize(size))
 	return nil
 }
@@ -160,6 +216,7 @@ func (b *Block) EncodeRLP(w io.Writer) error {
 	return rlp.Encode(w, extblock{
 		Header: b.header,
 		Txs:    b.transactions,
+		Layout: b.layout,
 	})
 }
 
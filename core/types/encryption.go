@@ -0,0 +1,129 @@
+package types
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/SipengXie/pangu/accesslist"
+	"github.com/SipengXie/pangu/crypto/ecies"
+	"github.com/SipengXie/pangu/rlp"
+)
+
+// 交易内容加密算法
+const (
+	ENC_NONE  = 0x00 // 不加密
+	ENC_ECIES = 0x01 // ECIES，加密到执行者的公钥
+)
+
+var (
+	ErrInvalidEncAlgo = errors.New("invalid encryption algorithm")
+	ErrDecryptContent = errors.New("failed to decrypt transaction content")
+)
+
+// TxCipher 交易内容的加密方案，不同的EncAlgo对应不同的实现
+type TxCipher interface {
+	Encrypt(pub *ecdsa.PublicKey, plaintext []byte) ([]byte, error)
+	Decrypt(prv *ecdsa.PrivateKey, ciphertext []byte) ([]byte, error)
+}
+
+var (
+	txCiphersLock sync.RWMutex
+	txCiphers     = map[byte]TxCipher{
+		ENC_ECIES: eciesCipher{},
+	}
+)
+
+// RegisterTxCipher 注册一种交易内容加密方案
+func RegisterTxCipher(algo byte, cipher TxCipher) {
+	txCiphersLock.Lock()
+	defer txCiphersLock.Unlock()
+	txCiphers[algo] = cipher
+}
+
+func getTxCipher(algo byte) (TxCipher, error) {
+	txCiphersLock.RLock()
+	defer txCiphersLock.RUnlock()
+	cipher, ok := txCiphers[algo]
+	if !ok || algo == ENC_NONE {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidEncAlgo, algo)
+	}
+	return cipher, nil
+}
+
+// eciesCipher 使用crypto/ecies实现的加密方案
+type eciesCipher struct{}
+
+func (eciesCipher) Encrypt(pub *ecdsa.PublicKey, plaintext []byte) ([]byte, error) {
+	return ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(pub), plaintext, nil, nil)
+}
+
+func (eciesCipher) Decrypt(prv *ecdsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	return ecies.ImportECDSA(prv).Decrypt(ciphertext, nil, nil)
+}
+
+// encPayload 被加密的交易内容，EncContent <--> {Data, AccessList}
+type encPayload struct {
+	Data       []byte
+	AccessList *accesslist.AccessList
+}
+
+// SealContent 把交易的Data和AccessList加密到执行者公钥pub，写入EncContent后清空明文，需要在签名前调用
+func (tx *PanguTransaction) SealContent(pub *ecdsa.PublicKey, algo byte) error {
+	cipher, err := getTxCipher(algo)
+	if err != nil {
+		return err
+	}
+	plaintext, err := rlp.EncodeToBytes(&encPayload{Data: tx.Data, AccessList: tx.AccessList})
+	if err != nil {
+		return err
+	}
+	ciphertext, err := cipher.Encrypt(pub, plaintext)
+	if err != nil {
+		return err
+	}
+	tx.EncAlgo, tx.EncContent = algo, ciphertext
+	tx.Data, tx.AccessList = nil, accesslist.NewAccessList()
+	return nil
+}
+
+// EncAlgo 交易内容的加密算法，ENC_NONE表示未加密
+func (tx *Transaction) EncAlgo() byte {
+	switch inner := tx.inner.(type) {
+	case *PanguTransaction:
+		return inner.EncAlgo
+	case *GuaranteedTransaction:
+		return inner.EncAlgo
+	}
+	return ENC_NONE
+}
+
+// IsEncrypted 交易内容是否被加密
+func (tx *Transaction) IsEncrypted() bool {
+	return tx.EncAlgo() != ENC_NONE
+}
+
+// DecryptContent 使用执行者私钥解密交易内容，返回Data和AccessList，不修改交易本身
+func (tx *Transaction) DecryptContent(prv *ecdsa.PrivateKey) ([]byte, *accesslist.AccessList, error) {
+	cipher, err := getTxCipher(tx.EncAlgo())
+	if err != nil {
+		return nil, nil, err
+	}
+	if prv == nil {
+		return nil, nil, fmt.Errorf("%w: no decryption key", ErrDecryptContent)
+	}
+	plaintext, err := cipher.Decrypt(prv, tx.EncContent())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrDecryptContent, err)
+	}
+	var payload encPayload
+	if err := rlp.DecodeBytes(plaintext, &payload); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrDecryptContent, err)
+	}
+	if payload.AccessList == nil {
+		payload.AccessList = accesslist.NewAccessList()
+	}
+	return payload.Data, payload.AccessList, nil
+}
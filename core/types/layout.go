@@ -0,0 +1,31 @@
+package types
+
+import (
+	"github.com/SipengXie/pangu/common"
+)
+
+// EmptyGroupRoot 空执行布局的GroupRoot
+var EmptyGroupRoot = rlpHash(&ExecLayout{})
+
+// ExecLayout 区块的执行布局：每一轮并行执行的分组边界，以及最终在串行队列中执行的交易
+// 第0轮即区块体中的二维分组，之后的轮次由上一轮降级的交易重新分组得到，区块头中的GroupRoot是它的哈希
+type ExecLayout struct {
+	Rounds [][][]common.Hash // 轮次 -> 组 -> 组内按执行顺序的交易哈希
+	Serial []common.Hash     // 串行队列中的交易哈希，按执行顺序
+}
+
+// Hash 执行布局的承诺，即区块头中的GroupRoot，nil与空布局的哈希相同
+func (l *ExecLayout) Hash() common.Hash {
+	if l == nil {
+		return EmptyGroupRoot
+	}
+	return rlpHash(l)
+}
+
+// Layout 区块体中携带的执行布局，创世区块等未经执行封装的区块为nil
+func (b *Block) Layout() *ExecLayout {
+	return b.layout
+}
+
+// GroupRoot 区块头对执行布局的承诺
+func (b *Block) GroupRoot() common.Hash { return b.header.GroupRoot }
@@ -60,9 +60,12 @@ type Receipt struct {
 
 	// Implementation fields: These fields are added by geth when processing a transaction.
 	TxHash            common.Hash    `json:"transactionHash" gencodec:"required"`
+	AggregateHash     common.Hash    `json:"aggregateHash"` // 从聚合交易中拆出的交易所属聚合交易的哈希
 	ContractAddress   common.Address `json:"contractAddress"`
 	GasUsed           uint64         `json:"gasUsed" gencodec:"required"`
-	EffectiveGasPrice *big.Int       `json:"effectiveGasPrice"` // required, but tag omitted for backwards compatibility
+	EffectiveGasPrice *big.Int       `json:"effectiveGasPrice"`      // required, but tag omitted for backwards compatibility
+	AccessListPenalty uint64         `json:"accessListPenalty"`      // 从并行组降级后因AccessList不一致被收取的惩罚汽油，不计入GasUsed
+	RevertReason      string         `json:"revertReason,omitempty"` // 执行失败时从返回数据中解析出的revert原因（Error(string)或Panic(uint256)）
 
 	// Inclusion information: These fields provide information about the inclusion of the
 	// transaction corresponding to this receipt.
@@ -95,6 +98,15 @@ type storedReceiptRLP struct {
 	PostStateOrStatus []byte
 	CumulativeGasUsed uint64
 	Logs              []*Log
+	RevertReason      string `rlp:"optional"` // revert原因无法从交易推导，随收据一起存储
+
+	// 收据按执行顺序存储，与区块中的交易顺序不同，无法按序号从交易推导，以下字段随收据一起存储
+	TxHash            common.Hash    `rlp:"optional"`
+	AggregateHash     common.Hash    `rlp:"optional"`
+	ContractAddress   common.Address `rlp:"optional"`
+	GasUsed           uint64         `rlp:"optional"`
+	EffectiveGasPrice *big.Int       `rlp:"optional"`
+	AccessListPenalty uint64         `rlp:"optional"` // 惩罚汽油不计入GasUsed，无法由其他字段推导
 }
 
 // EncodeRLP implements rlp.Encoder, and flattens the consensus fields of a receipt
@@ -223,6 +235,20 @@ func (r *ReceiptForStorage) EncodeRLP(_w io.Writer) error {
 		}
 	}
 	w.ListEnd(logList)
+	w.WriteString(r.RevertReason)
+	w.WriteBytes(r.TxHash[:])
+	w.WriteBytes(r.AggregateHash[:])
+	w.WriteBytes(r.ContractAddress[:])
+	w.WriteUint64(r.GasUsed)
+	// 可选字段按位置解码，写入惩罚汽油时EffectiveGasPrice必须占位
+	if r.EffectiveGasPrice != nil {
+		w.WriteBigInt(r.EffectiveGasPrice)
+	} else if r.AccessListPenalty != 0 {
+		w.WriteBigInt(new(big.Int))
+	}
+	if r.AccessListPenalty != 0 {
+		w.WriteUint64(r.AccessListPenalty)
+	}
 	w.ListEnd(outerList)
 	return w.Flush()
 }
@@ -239,6 +265,13 @@ func (r *ReceiptForStorage) DecodeRLP(s *rlp.Stream) error {
 	}
 	r.CumulativeGasUsed = stored.CumulativeGasUsed
 	r.Logs = stored.Logs
+	r.RevertReason = stored.RevertReason
+	r.TxHash = stored.TxHash
+	r.AggregateHash = stored.AggregateHash
+	r.ContractAddress = stored.ContractAddress
+	r.GasUsed = stored.GasUsed
+	r.EffectiveGasPrice = stored.EffectiveGasPrice
+	r.AccessListPenalty = stored.AccessListPenalty
 	r.Bloom = CreateBloom(Receipts{(*Receipt)(r)})
 
 	return nil
@@ -200,6 +200,46 @@ func Sender(signer Signer, tx *Transaction) (common.Address, error) {
 	return addr, nil
 }
 
+// Guarantor 返回担保交易的担保人地址，与Sender一样会缓存结果
+func Guarantor(signer Signer, tx *Transaction) (common.Address, error) {
+	if sc := tx.guar.Load(); sc != nil {
+		sigCache := sc.(sigCache)
+		if sigCache.signer.Equal(signer) {
+			return sigCache.from, nil
+		}
+	}
+
+	addr, err := signer.Guarantor(tx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	tx.guar.Store(sigCache{signer: signer, from: addr})
+	return addr, nil
+}
+
+// SignGuarantor 担保人对担保交易签名，之后用户再使用SignTx对整个交易签名
+func SignGuarantor(tx *Transaction, s Signer, prv []byte, algo byte) (*Transaction, error) {
+	h := s.GuarantorHash(tx)
+	switch algo {
+	case SIG_ECDSA:
+		{
+			pri_k, err := crypto.ToECDSA(prv)
+			if err != nil {
+				return nil, err
+			}
+			sig, err := crypto.Sign(h[:], pri_k)
+			if err != nil {
+				return nil, err
+			}
+			return tx.WithGuarantorSignature(s, sig, algo)
+		}
+	default:
+		{
+			return nil, ErrInvalidSigAlgo
+		}
+	}
+}
+
 // Signer encapsulates transaction signature handling. The name of this type is slightly
 // misleading because Signers don't actually sign, they're just for validating and
 // processing of signatures.
@@ -219,6 +259,12 @@ type Signer interface {
 	// private key. This hash does not uniquely identify the transaction.
 	Hash(tx *Transaction) common.Hash
 
+	// Guarantor returns the guarantor address of a guaranteed transaction.
+	Guarantor(tx *Transaction) (common.Address, error)
+
+	// GuarantorHash returns the hash signed by the guarantor, which covers the access list.
+	GuarantorHash(tx *Transaction) common.Hash
+
 	// Equal returns true if the given signer is the same as the receiver.
 	Equal(Signer) bool
 }
@@ -244,23 +290,39 @@ func (s panguSigner) ChainID() *big.Int {
 }
 
 func (s panguSigner) Sender(tx *Transaction) (common.Address, error) {
-	if tx.Type() != PanguTxType {
+	switch tx.Type() {
+	case PanguTxType, GuaranteedTxType, AggregateTxType:
+	default:
+		return common.Address{}, ErrTxTypeNotSupported
+	}
+	return s.recover(tx, s.Hash(tx), tx.SigAlgo(), tx.RawSigValues())
+}
+
+// Guarantor 恢复担保交易中担保人的地址
+func (s panguSigner) Guarantor(tx *Transaction) (common.Address, error) {
+	if !tx.IsGuaranteed() {
 		return common.Address{}, ErrTxTypeNotSupported
 	}
-	sigAlgo := tx.SigAlgo()
+	return s.recover(tx, s.GuarantorHash(tx), tx.GuarSigAlgo(), tx.GuarSigValues())
+}
+
+// recover 按签名算法从签名中恢复签名者地址
+func (s panguSigner) recover(tx *Transaction, hash common.Hash, sigAlgo byte, sig []byte) (common.Address, error) {
 	switch sigAlgo {
 	case SIG_ECDSA:
 		{
-			R, S, V := s.ECDSA_Algo.DecodeSignature(tx.RawSigValues())
+			if len(sig) != crypto.SignatureLength {
+				return common.Address{}, ErrInvalidSig
+			}
+			R, S, V := s.ECDSA_Algo.DecodeSignature(sig)
 			if tx.ChainId().Cmp(s.chainId) != 0 {
 				return common.Address{}, fmt.Errorf("%w: have %d want %d", ErrInvalidChainId, tx.ChainId(), s.chainId)
 			}
-			return s.ECDSA_Algo.RecoverPlain(s.Hash(tx), R, S, V, true)
+			return s.ECDSA_Algo.RecoverPlain(hash, R, S, V, true)
 		}
 	default:
 		return common.Address{}, ErrInvalidSigAlgo
 	}
-
 }
 
 func (s panguSigner) Equal(o Signer) bool {
@@ -270,7 +332,50 @@ func (s panguSigner) Equal(o Signer) bool {
 
 // Hash returns the hash to be signed by the sender.
 // It does not uniquely identify the transaction.
+// 担保交易中用户对包括担保人签名在内的整个交易签名
 func (s panguSigner) Hash(tx *Transaction) common.Hash {
+	// 聚合交易的Cover签名覆盖所有内部交易的哈希，内部交易的哈希又包含各自的用户签名
+	if tx.IsAggregate() {
+		inner := tx.InnerTxs()
+		hashes := make([]common.Hash, len(inner))
+		for i, innerTx := range inner {
+			hashes[i] = innerTx.Hash()
+		}
+		return prefixedRlpHash(
+			tx.Type(),
+			[]interface{}{
+				s.chainId,
+				tx.Nonce(),
+				hashes,
+			})
+	}
+	if tx.IsGuaranteed() {
+		return prefixedRlpHash(
+			tx.Type(),
+			[]interface{}{
+				s.GuarantorHash(tx),
+				tx.GuarSigAlgo(),
+				tx.GuarSigValues(),
+			})
+	}
+	return prefixedRlpHash(
+		tx.Type(),
+		[]interface{}{
+			s.chainId,
+			tx.Nonce(),
+			tx.GasTipCap(),
+			tx.GasFeeCap(),
+			tx.GasLimit(),
+			tx.To(),
+			tx.Value(),
+			tx.Data(),
+			tx.EncAlgo(),
+			tx.EncContent(),
+		})
+}
+
+// GuarantorHash 担保人签名的哈希，担保人确定了AccessList，因此哈希包含AccessList
+func (s panguSigner) GuarantorHash(tx *Transaction) common.Hash {
 	return prefixedRlpHash(
 		tx.Type(),
 		[]interface{}{
@@ -282,6 +387,8 @@ func (s panguSigner) Hash(tx *Transaction) common.Hash {
 			tx.To(),
 			tx.Value(),
 			tx.Data(),
+			tx.EncAlgo(),
 			tx.EncContent(),
+			tx.AccessList(),
 		})
 }
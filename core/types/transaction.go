@@ -21,6 +21,7 @@ import (
 	"container/heap"
 	"encoding/json"
 	"errors"
+	"io"
 	"math/big"
 	"sync/atomic"
 	"time"
@@ -51,7 +52,9 @@ var (
 
 // Transaction types.
 const (
-	PanguTxType = 0x01
+	PanguTxType      = 0x01
+	GuaranteedTxType = 0x02 // 担保交易
+	AggregateTxType  = 0x03 // 聚合交易
 )
 
 // Transaction is an Ethereum transaction.
@@ -63,6 +66,9 @@ type Transaction struct {
 	hash atomic.Value
 	size atomic.Value
 	from atomic.Value
+	guar atomic.Value // 担保人地址缓存
+
+	aggregate common.Hash // 从聚合交易中拆出的内部交易记录所属聚合交易的哈希
 }
 
 // NewTx creates a new transaction.
@@ -106,17 +112,16 @@ type TxData interface {
 	effectiveGasPrice(dst *big.Int, baseFee *big.Int) *big.Int
 }
 
-// // EncodeRLP implements rlp.Encoder
-// func (tx *Transaction) EncodeRLP(w io.Writer) error {
-
-// 	buf := encodeBufferPool.Get().(*bytes.Buffer)
-// 	defer encodeBufferPool.Put(buf)
-// 	buf.Reset()
-// 	if err := tx.encodeTyped(buf); err != nil {
-// 		return err
-// 	}
-// 	return rlp.Encode(w, buf.Bytes())
-// }
+// EncodeRLP implements rlp.Encoder，交易按规范编码（类型 + 内容）作为一个RLP字符串编码
+func (tx *Transaction) EncodeRLP(w io.Writer) error {
+	buf := encodeBufferPool.Get().(*bytes.Buffer)
+	defer encodeBufferPool.Put(buf)
+	buf.Reset()
+	if err := tx.encodeTyped(buf); err != nil {
+		return err
+	}
+	return rlp.Encode(w, buf.Bytes())
+}
 
 // encodeTyped writes the canonical encoding of a typed transaction to w.
 func (tx *Transaction) encodeTyped(w *bytes.Buffer) error {
@@ -134,24 +139,18 @@ func (tx *Transaction) MarshalBinary() ([]byte, error) {
 	return buf.Bytes(), err
 }
 
-// // DecodeRLP implements rlp.Decoder
-// func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
-// 	_, _, err := s.Kind()
-// 	switch {
-// 	case err != nil:
-// 		return err
-// 	default:
-// 		var b []byte
-// 		if b, err = s.Bytes(); err != nil {
-// 			return err
-// 		}
-// 		inner, err := tx.decodeTyped(b)
-// 		if err == nil {
-// 			tx.setDecoded(inner, uint64(len(b)))
-// 		}
-// 		return err
-// 	}
-// }
+// DecodeRLP implements rlp.Decoder
+func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
+	b, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+	inner, err := tx.decodeTyped(b)
+	if err == nil {
+		tx.setDecoded(inner, uint64(len(b)))
+	}
+	return err
+}
 
 // UnmarshalBinary decodes the canonical encoding of transactions.
 func (tx *Transaction) UnmarshalBinary(b []byte) error {
@@ -174,6 +173,14 @@ func (tx *Transaction) decodeTyped(b []byte) (TxData, error) {
 		// err := rlp.DecodeBytes(b[1:], &inner)
 		err := json.NewDecoder(bytes.NewReader(b[1:])).Decode(&inner)
 		return &inner, err
+	case GuaranteedTxType:
+		var inner GuaranteedTransaction
+		err := json.NewDecoder(bytes.NewReader(b[1:])).Decode(&inner)
+		return &inner, err
+	case AggregateTxType:
+		var inner AggregateTransaction
+		err := json.NewDecoder(bytes.NewReader(b[1:])).Decode(&inner)
+		return &inner, err
 	default:
 		return nil, ErrTxTypeNotSupported
 	}
@@ -274,11 +281,9 @@ func (tx *Transaction) Value() *big.Int { return new(big.Int).Set(tx.inner.value
 // Nonce returns the sender account nonce of the transaction.
 func (tx *Transaction) Nonce() uint64 { return tx.inner.nonce() }
 
+// Sender 恢复交易的发送方，结果与types.Sender共用同一个缓存
 func (tx *Transaction) Sender(signer Signer) (common.Address, error) {
-	if tx.from.Load() != nil {
-		return tx.from.Load().(common.Address), nil
-	}
-	return signer.Sender(tx)
+	return Sender(signer, tx)
 }
 
 // To returns the recipient address of the transaction.
@@ -288,7 +293,14 @@ func (tx *Transaction) To() *common.Address {
 }
 
 // Cost returns (gas * gasPrice) + (blobGas * blobGasPrice) + value.
+// 担保交易的汽油费由担保人支付，发送方只需要支付转账金额；聚合交易的费用由各内部交易的发送方支付
 func (tx *Transaction) Cost() *big.Int {
+	if tx.IsGuaranteed() {
+		return tx.Value()
+	}
+	if tx.IsAggregate() {
+		return new(big.Int)
+	}
 	total := new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(tx.GasLimit()))
 	total.Add(total, tx.Value())
 	return total
@@ -373,6 +385,8 @@ func (tx *Transaction) Hash() common.Hash {
 		inner := new(PanguTransaction)
 		inner = (tx.inner.copy()).(*PanguTransaction)
 		h = prefixedRlpHash(tx.Type(), inner)
+	} else {
+		h = prefixedRlpHash(tx.Type(), tx.inner)
 	}
 	tx.hash.Store(h)
 	return h
@@ -392,6 +406,62 @@ func (tx *Transaction) Size() uint64 {
 	return size
 }
 
+// IsGuaranteed 交易是否是担保交易
+func (tx *Transaction) IsGuaranteed() bool {
+	return tx.Type() == GuaranteedTxType
+}
+
+// GuarSigAlgo 担保人的签名算法，非担保交易返回0
+func (tx *Transaction) GuarSigAlgo() byte {
+	if inner, ok := tx.inner.(*GuaranteedTransaction); ok {
+		return inner.GuarSigAlgo
+	}
+	return 0
+}
+
+// GuarSigValues 担保人签名，非担保交易返回nil
+func (tx *Transaction) GuarSigValues() []byte {
+	if inner, ok := tx.inner.(*GuaranteedTransaction); ok {
+		return inner.Ensurance
+	}
+	return nil
+}
+
+// IsAggregate 交易是否是聚合交易
+func (tx *Transaction) IsAggregate() bool {
+	return tx.Type() == AggregateTxType
+}
+
+// InnerTxs 拆开聚合交易，返回其中的内部交易，每笔内部交易记录所属聚合交易的哈希；非聚合交易返回nil
+func (tx *Transaction) InnerTxs() Transactions {
+	inner, ok := tx.inner.(*AggregateTransaction)
+	if !ok {
+		return nil
+	}
+	hash := tx.Hash()
+	txs := make(Transactions, len(inner.Txs))
+	for i, data := range inner.Txs {
+		txs[i] = NewTx(data)
+		txs[i].aggregate = hash
+	}
+	return txs
+}
+
+// AggregateHash 内部交易所属聚合交易的哈希，不是从聚合交易中拆出的交易返回空哈希
+func (tx *Transaction) AggregateHash() common.Hash {
+	return tx.aggregate
+}
+
+// WithGuarantorSignature 返回带有担保人签名的新交易，只对担保交易有效
+func (tx *Transaction) WithGuarantorSignature(signer Signer, sig []byte, sigAlgo byte) (*Transaction, error) {
+	if !tx.IsGuaranteed() {
+		return nil, ErrTxTypeNotSupported
+	}
+	cpy := tx.inner.copy().(*GuaranteedTransaction)
+	cpy.setGuarSigValues(signer.ChainID(), sig, sigAlgo)
+	return &Transaction{inner: cpy, time: tx.time}, nil
+}
+
 // WithSignature returns a new transaction with the given signature.
 // This signature needs to be in the [R || S || V] format where V is 0 or 1.
 func (tx *Transaction) WithSignature(signer Signer, sig []byte, sigAlgo byte) (*Transaction, error) {
@@ -401,6 +471,21 @@ func (tx *Transaction) WithSignature(signer Signer, sig []byte, sigAlgo byte) (*
 }
 
 func (tx *Transaction) IntrinsicGas() (uint64, error) {
+	// 聚合交易的内在汽油是所有内部交易之和
+	if tx.IsAggregate() {
+		var gas uint64
+		for _, inner := range tx.InnerTxs() {
+			innerGas, err := inner.IntrinsicGas()
+			if err != nil {
+				return 0, err
+			}
+			if math.MaxUint64-gas < innerGas {
+				return 0, ErrGasUintOverflow
+			}
+			gas += innerGas
+		}
+		return gas, nil
+	}
 	// Set the starting gas for the raw transaction
 	var gas = params.TxGas
 	data := tx.Data()
@@ -464,6 +549,18 @@ func (s Transactions) EncodeIndex(i int, w *bytes.Buffer) {
 	s[i].encodeTyped(w)
 }
 
+// LookupHashes 按哈希查找交易与收据时需要索引的哈希：每笔交易的哈希，聚合交易还包括各内部交易的哈希
+func (s Transactions) LookupHashes() []common.Hash {
+	hashes := make([]common.Hash, 0, len(s))
+	for _, tx := range s {
+		hashes = append(hashes, tx.Hash())
+		for _, inner := range tx.InnerTxs() {
+			hashes = append(hashes, inner.Hash())
+		}
+	}
+	return hashes
+}
+
 // TxDifference returns a new set which is the difference between a and b.
 func TxDifference(a, b Transactions) Transactions {
 	keep := make(Transactions, 0, len(a))
@@ -0,0 +1,119 @@
+// 验证者模式：按提议者的方式重新执行已封装的区块，并与区块头中的承诺进行比对
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SipengXie/pangu/core/evm"
+	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/trie"
+)
+
+var ErrBlockMismatch = errors.New("block re-execution does not match header")
+
+// BlockMismatch 区块头中某一项承诺与重新执行结果不一致
+type BlockMismatch struct {
+	Field    string // 不一致的字段
+	Expected string // 区块头中的值
+	Got      string // 重新执行得到的值
+}
+
+func (m *BlockMismatch) String() string {
+	return fmt.Sprintf("%s: expected %s, got %s", m.Field, m.Expected, m.Got)
+}
+
+// VerifyReport VerifyBlock的返回结构体
+type VerifyReport struct {
+	Number     uint64
+	Hash       string
+	Mismatches []*BlockMismatch  // 为空表示区块合法
+	Result     *ProcessReturnMsg // 重新执行的结果
+}
+
+// Valid 区块重新执行的结果是否与区块头一致
+func (r *VerifyReport) Valid() bool {
+	return len(r.Mismatches) == 0
+}
+
+func (r *VerifyReport) add(field string, expected, got interface{}) {
+	r.Mismatches = append(r.Mismatches, &BlockMismatch{
+		Field:    field,
+		Expected: fmt.Sprint(expected),
+		Got:      fmt.Sprint(got),
+	})
+}
+
+// VerifyBlock 验证函数，接收提议者封装好的区块，按区块中的二维分组重新执行
+// Process的分组合并与串行队列排序都是确定的，因此验证者会得到和提议者完全相同的降级组与串行队列
+// 重新执行后比对状态根、收据根、布隆过滤器、汽油费和执行布局，任何一项不一致都返回ErrBlockMismatch
+// statedb 是父区块的状态，验证失败时其中的内容不应再被使用
+func (p *Processor) VerifyBlock(block *types.Block, statedb *state.StateDB, cfg evm.Config) (*VerifyReport, error) {
+	Header := block.Header()
+	Report := &VerifyReport{
+		Number: Header.Number.Uint64(),
+		Hash:   block.Hash().Hex(),
+	}
+
+	fmt.Printf("\n%sSTAGE CHANGE%s   开始验证区块 %d <<< \n", types.FBLUE, types.FRESET, Report.Number)
+
+	// 基础费必须等于根据父区块计算出的值
+	// 找不到父区块时无法检查基础费，直接拒绝
+	if Header.Number.Sign() > 0 {
+		Parent := p.blockchain.GetHeader(Header.ParentHash, Header.Number.Uint64()-1)
+		if Parent == nil {
+			fmt.Printf("%sERROR MSG%s   找不到区块 %d 的父区块\n", types.FRED, types.FRESET, Report.Number)
+			return Report, fmt.Errorf("%w: parent %x", ErrUnknownAncestor, Header.ParentHash)
+		}
+		if err := VerifyEIP1559Header(p.config, Parent, Header); err != nil {
+			Report.add("BaseFee", CalcBaseFee(p.config, Parent), Header.BaseFee)
+		}
+	}
+
+	// 重新执行时不能修改区块头，使用一个副本
+	// 区块头承诺的是分组执行的布局，无论处理器使用哪种执行策略都按分组重新执行
+	Replay := types.InitBlock(Header, block.Transactions2D())
+	Result, err := p.processGroups(Replay, statedb, cfg)
+	if err != nil {
+		fmt.Printf("%sERROR MSG%s   区块重新执行出错\n", types.FRED, types.FRESET)
+		return Report, err
+	}
+	Report.Result = Result
+
+	if Result.RootHash != Header.StateRoot {
+		Report.add("StateRoot", Header.StateRoot.Hex(), Result.RootHash.Hex())
+	}
+	ReceiptRoot := types.EmptyReceiptsHash
+	Bloom := types.Bloom{}
+	if len(Result.Receipt) != 0 {
+		ReceiptRoot = types.DeriveSha(Result.Receipt, trie.NewStackTrie(nil))
+		Bloom = types.CreateBloom(Result.Receipt)
+	}
+	if ReceiptRoot != Header.ReceiptRoot {
+		Report.add("ReceiptRoot", Header.ReceiptRoot.Hex(), ReceiptRoot.Hex())
+	}
+	if Bloom != Header.Bloom {
+		Report.add("Bloom", Header.Bloom.Big().Text(16), Bloom.Big().Text(16))
+	}
+	if *Result.UsedGas != Header.GasUsed {
+		Report.add("GasUsed", Header.GasUsed, *Result.UsedGas)
+	}
+	// 执行布局（各轮分组与串行队列）必须与提议者承诺的一致，区块体携带的布局也必须与承诺对应
+	if GroupRoot := Result.Layout().Hash(); GroupRoot != Header.GroupRoot {
+		Report.add("GroupRoot", Header.GroupRoot.Hex(), GroupRoot.Hex())
+	}
+	if Layout := block.Layout(); Layout != nil && Layout.Hash() != Header.GroupRoot {
+		Report.add("BodyLayout", Header.GroupRoot.Hex(), Layout.Hash().Hex())
+	}
+
+	if !Report.Valid() {
+		for _, m := range Report.Mismatches {
+			fmt.Printf("%sERROR MSG%s   区块验证不通过 %s\n", types.FRED, types.FRESET, m)
+		}
+		return Report, fmt.Errorf("%w: block %d, %d mismatches", ErrBlockMismatch, Report.Number, len(Report.Mismatches))
+	}
+	fmt.Printf("%sPROMPT MSG%s   区块 %d 验证通过\n", types.FGREEN, types.FRESET, Report.Number)
+	return Report, nil
+}
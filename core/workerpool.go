@@ -0,0 +1,171 @@
+package core
+
+import (
+	"math/big"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/SipengXie/pangu/accesslist"
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core/evm"
+	evmparams "github.com/SipengXie/pangu/core/evm/params"
+	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/types"
+)
+
+// WorkerStats 一个执行worker在一个区块中的执行统计
+type WorkerStats struct {
+	Worker int           // worker编号
+	Groups int           // 执行的并行组数
+	Stolen int           // 其中从其他worker的队列窃取的组数
+	Txs    int           // 执行的交易数
+	Busy   time.Duration // 执行并行组花费的时间
+}
+
+// groupDeque 一个worker的并行组队列，worker从队头取自己的组，空闲的worker从队尾窃取
+type groupDeque struct {
+	mu     sync.Mutex
+	groups []int
+}
+
+func (d *groupDeque) popFront() (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.groups) == 0 {
+		return 0, false
+	}
+	g := d.groups[0]
+	d.groups = d.groups[1:]
+	return g, true
+}
+
+func (d *groupDeque) popBack() (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.groups) == 0 {
+		return 0, false
+	}
+	g := d.groups[len(d.groups)-1]
+	d.groups = d.groups[:len(d.groups)-1]
+	return g, true
+}
+
+// groupPool 执行一个区块中各并行组的有界worker池
+// worker数不超过配置的线程数（默认CPU核数）与组数，每个worker复用一个EVM（及其解释器），执行不同的组时只切换stateDB
+type groupPool struct {
+	p           *Processor
+	txs         []types.Transactions
+	states      []*state.StateDB
+	usedGas     []*uint64
+	header      *types.Header
+	blockHash   common.Hash
+	blockNumber *big.Int
+	signer      types.Signer
+	cfg         evm.Config
+	checkALs    map[common.Hash]*accesslist.AccessList // 重新执行轮次中降级交易的实际访问集合，第0轮为nil
+
+	queues  []*groupDeque
+	results []MessageReturn
+	stats   []*WorkerStats
+}
+
+// workerCount 执行n个任务时使用的线程数，不超过配置的线程数（默认CPU核数）与任务数
+func (p *Processor) workerCount(n int) int {
+	workers := p.workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > n {
+		workers = n
+	}
+	return workers
+}
+
+// runGroups 使用有界的worker池执行各并行组，第i组在states[i]上执行，按组号返回执行结果以及每个worker的统计
+// checkALs非空时各组是重新执行的降级交易，按其中的实际访问集合检查冲突并收取惩罚汽油
+func (p *Processor) runGroups(txs []types.Transactions, states []*state.StateDB, usedGas []*uint64, header *types.Header, blockHash common.Hash, blockNumber *big.Int, signer types.Signer, cfg evm.Config, checkALs map[common.Hash]*accesslist.AccessList) ([]MessageReturn, []*WorkerStats) {
+	workers := p.workerCount(len(txs))
+	pool := &groupPool{
+		p:           p,
+		txs:         txs,
+		states:      states,
+		usedGas:     usedGas,
+		header:      header,
+		blockHash:   blockHash,
+		blockNumber: blockNumber,
+		signer:      signer,
+		cfg:         cfg,
+		checkALs:    checkALs,
+		queues:      make([]*groupDeque, workers),
+		results:     make([]MessageReturn, len(txs)),
+		stats:       make([]*WorkerStats, workers),
+	}
+	// 各组轮流分配到各worker的队列，分配不均时由窃取弥补
+	for w := range pool.queues {
+		pool.queues[w] = new(groupDeque)
+		pool.stats[w] = &WorkerStats{Worker: w}
+	}
+	for i := range txs {
+		q := pool.queues[i%workers]
+		q.groups = append(q.groups, i)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			pool.work(w)
+		}(w)
+	}
+	wg.Wait()
+	return pool.results, pool.stats
+}
+
+// next 取下一个要执行的组：先取自己队列的队头，为空时依次从其他worker的队尾窃取
+func (pool *groupPool) next(w int) (group int, stolen bool, ok bool) {
+	if group, ok = pool.queues[w].popFront(); ok {
+		return group, false, true
+	}
+	for i := 1; i < len(pool.queues); i++ {
+		if group, ok = pool.queues[(w+i)%len(pool.queues)].popBack(); ok {
+			return group, true, true
+		}
+	}
+	return 0, false, false
+}
+
+// work worker的执行循环，所有队列都为空时退出
+func (pool *groupPool) work(w int) {
+	var (
+		stats   = pool.stats[w]
+		EachEvm *evm.EVM
+	)
+	for {
+		group, stolen, ok := pool.next(w)
+		if !ok {
+			return
+		}
+		start := time.Now()
+		if EachEvm == nil {
+			// GetHash带有缓存，不能在worker之间共享
+			EachEvm = evm.NewEVM(NewEVMBlockContext(pool.header, pool.p.blockchain, nil), evm.TxContext{}, pool.states[group], new(evmparams.ChainConfig).FromGlobal(pool.p.config), pool.cfg)
+		} else {
+			EachEvm.Reset(evm.TxContext{}, pool.states[group])
+		}
+		EachThreadMessage := NewThreadMessage(pool.p.config, pool.blockNumber, pool.blockHash, pool.usedGas[group], EachEvm, pool.signer, pool.header, pool.p.decryptKey)
+		if pool.checkALs != nil {
+			EachThreadMessage.Demoted = true
+			EachThreadMessage.CheckAccessLists = pool.checkALs
+		}
+		pool.results[group] = executeGroup(group, pool.txs[group], EachThreadMessage, true) // IsParallel = true 表示并行分组
+
+		stats.Groups++
+		stats.Txs += len(pool.txs[group])
+		if stolen {
+			stats.Stolen++
+		}
+		stats.Busy += time.Since(start)
+	}
+}
@@ -0,0 +1,118 @@
+package executor
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/SipengXie/pangu/core"
+	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/trie"
+)
+
+// BuilderConfig 出块条件，满足任意一个即封装区块
+type BuilderConfig struct {
+	GasLimit uint64        // 区块GasLimit的目标值，每个区块按允许的幅度向它调整，待打包交易的GasLimit之和放满区块时出块
+	MaxTxs   int           // 区块最多包含的交易数，达到时出块，0表示不限制
+	Interval time.Duration // 距离上一个区块的最长时间，超时且有待打包交易时出块，不大于0时使用默认值
+	Lanes    int           // 并行执行通道数，互不冲突的交易分组按汽油均衡地装入各通道，不大于0时使用CPU核数
+}
+
+// DefaultBuilderConfig 默认出块条件
+var DefaultBuilderConfig = BuilderConfig{
+	GasLimit: 12345678,
+	MaxTxs:   0,
+	Interval: 2 * time.Second,
+}
+
+// SetBuilderConfig 设置出块条件，从下一次出块检查开始生效
+func (e *ExecutorService) SetBuilderConfig(cfg BuilderConfig) {
+	e.builderMu.Lock()
+	defer e.builderMu.Unlock()
+	e.builderConfig = cfg
+}
+
+func (e *ExecutorService) getBuilderConfig() BuilderConfig {
+	e.builderMu.RLock()
+	defer e.builderMu.RUnlock()
+	cfg := e.builderConfig
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultBuilderConfig.Interval
+	}
+	if cfg.Lanes <= 0 {
+		cfg.Lanes = runtime.NumCPU()
+	}
+	return cfg
+}
+
+// pendingTxs 从执行交易池中按价格与nonce顺序选出下一个区块的交易，full表示区块已经放满（汽油或交易数达到上限）
+func (e *ExecutorService) pendingTxs(header *types.Header, cfg BuilderConfig) (txs types.Transactions, full bool) {
+	statedb, err := e.BlockChain.StateAt(e.BlockChain.CurrentBlock().StateRoot)
+	if err != nil {
+		return nil, false
+	}
+	signer := types.MakeSigner(e.BlockChain.Config(), header.Number, header.Time)
+	pending := e.executionPool.Pending(false)
+	// 交易池在新区块上链后异步重置，已经上链的交易可能还没有被移除
+	var (
+		remaining int    // 待打包交易数
+		minGas    uint64 // 待打包交易中最小的GasLimit
+	)
+	for addr, list := range pending {
+		nonce := statedb.GetNonce(addr)
+		for len(list) > 0 && list[0].Nonce() < nonce {
+			list = list[1:]
+		}
+		if len(list) == 0 {
+			delete(pending, addr)
+			continue
+		}
+		pending[addr] = list
+		remaining += len(list)
+		for _, tx := range list {
+			if minGas == 0 || tx.GasLimit() < minGas {
+				minGas = tx.GasLimit()
+			}
+		}
+	}
+	txs, gas := core.SelectTxs(types.NewTransactionsByPriceAndNonce(signer, pending, header.BaseFee), header.GasLimit, cfg.MaxTxs)
+	// 交易数达到上限，或者剩下的交易中最小的一笔也放不下
+	full = (cfg.MaxTxs > 0 && len(txs) >= cfg.MaxTxs) || (len(txs) < remaining && header.GasLimit-gas < minGas)
+	return txs, full
+}
+
+// buildBlock 执行选出的交易并把区块写入区块链，没有可打包的交易时不出块
+func (e *ExecutorService) buildBlock(header *types.Header, txs types.Transactions, lanes int) bool {
+	if len(txs) == 0 {
+		return false
+	}
+	fmt.Printf("\n%sSTAGE CHANGE%s   开始封装区块 %d，包含 %d 笔交易 <<< \n", types.FBLUE, types.FRESET, header.Number, len(txs))
+	signer := types.MakeSigner(e.BlockChain.Config(), header.Number, header.Time)
+	// 按预执行结果对交易分组，再按汽油均衡地装入各执行通道
+	groups, likelySerial := core.ClassifyTxPredicted(txs, signer, e.speculator.Predictions(txs))
+	blockTxs := core.PackGroups(groups, lanes)
+	// 很可能被降级的交易单独放在最后一个通道，避免它们把其他分组连在一起
+	if len(likelySerial) > 0 {
+		fmt.Printf("%sPROMPT MSG%s   预执行发现 %d 笔交易很可能进入串行队列，单独放在一个通道中\n", types.FGREEN, types.FRESET, len(likelySerial))
+		blockTxs = append(blockTxs, likelySerial)
+	}
+	block := types.InitBlock(header, blockTxs)
+	// 将区块发送执行
+	statedb, _ := e.BlockChain.StateAt(e.BlockChain.CurrentBlock().StateRoot)
+	processRes, err := e.Processer.Process(block, statedb, e.BlockChain.VmConfig())
+	if err != nil {
+		panic(err)
+	}
+	// 生成可上链的block
+	sealHeader := types.CopyHeader(block.Header())
+	sealHeader.GasUsed = *processRes.UsedGas
+	okBlock := types.NewBlock(sealHeader, blockTxs, processRes.Layout(), processRes.Receipt, processRes.RootHash, trie.NewStackTrie(nil))
+
+	// 执行后将block传入一个管道，然后上链
+	status, err := e.BlockChain.WriteBlockAndSetHead(okBlock, processRes.Receipt, processRes.Logs, statedb, true)
+	fmt.Println("writeBlock status : ", status)
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
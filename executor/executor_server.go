@@ -4,11 +4,12 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/SipengXie/pangu/common"
+	cmath "github.com/SipengXie/pangu/common/math"
 	"github.com/SipengXie/pangu/core"
-	"github.com/SipengXie/pangu/trie"
 
 	"github.com/SipengXie/pangu/core/txpool"
 	"github.com/SipengXie/pangu/core/types"
@@ -40,6 +41,11 @@ type ExecutorService struct {
 	p2pClient pb.P2PClient
 	pb.UnimplementedExecutorServer
 
+	builderMu     sync.RWMutex
+	builderConfig BuilderConfig // 出块条件
+
+	speculator *Speculator // 待处理交易池的预执行器
+
 	// extra channels
 	// initBlockCh chan struct{}
 }
@@ -52,11 +58,15 @@ func NewExecutorService(ePool, pPool *txpool.TxPool, bc *core.Blockchain, Cli pb
 		pendingTxsCh:   make(chan types.NewTxsEvent, txChanSize),
 		pendingPool:    pPool,
 		p2pClient:      Cli,
+		builderConfig:  DefaultBuilderConfig,
 		// initBlockCh:    make(chan struct{}, 1),
 	}
 	es.Processer = core.NewStateProcessor(es.BlockChain.Config(), es.BlockChain)
 	es.executionTxsSub = es.executionPool.SubscribeNewTxsEvent(es.executionTxsCh)
 	es.pendingTxsSub = es.pendingPool.SubscribeNewTxsEvent(es.pendingTxsCh)
+	es.speculator = NewSpeculator(es.pendingPool, es.BlockChain, func() *types.Header {
+		return es.initHeader(COINBASE, es.getBuilderConfig().GasLimit)
+	})
 	fmt.Println("go send loop")
 	go es.SendLoop()
 	fmt.Println("go execute loop")
@@ -175,66 +185,93 @@ func (e *ExecutorService) SendLoop() {
 	}
 }
 
+// ExecuteLoop 出块循环：收到新交易时检查区块是否已经放满，定时检查距离上一个区块的时间，满足任意出块条件时封装区块
 func (e *ExecutorService) ExecuteLoop() {
 	defer e.executionTxsSub.Unsubscribe()
-	var header *types.Header
-	var txs types.Transactions
-	needNew := true
+	cfg := e.getBuilderConfig()
+	timer := time.NewTimer(cfg.Interval)
+	defer timer.Stop()
 	for {
-		if needNew {
-			txs = make(types.Transactions, 0)
-			header = types.CopyHeader(e.initHeader(COINBASE, 12345678))
-			needNew = false
-		}
+		timeout := false
 		select {
-		case ev := <-e.executionTxsCh:
-			// txs := make(map[common.Address][]*types.Transaction, len(ev.Txs))
-			// 将交易打包进区块
-			// TODO : 完善打包区块的逻辑
-			fmt.Println("exec tx")
-			for _, tx := range ev.Txs {
-				txs = append(txs, tx)
-			}
-			if len(txs) >= 1 {
-				signer := types.MakeSigner(e.BlockChain.Config(), header.Number, header.Time)
-				// 交易分组
-				blockTxs := core.ClassifyTx(txs, signer)
-				block := types.InitBlock(header, blockTxs)
-				// 将区块发送执行
-				statedb, _ := e.BlockChain.StateAt(e.BlockChain.CurrentBlock().StateRoot)
-				processRes, err := e.Processer.Process(block, statedb, e.BlockChain.VmConfig())
-				if err != nil {
-					panic(err)
-				}
-				// 生成可上链的block
-				okBlock := types.NewBlock(block.Header(), blockTxs, processRes.Receipt, processRes.RootHash, trie.NewStackTrie(nil))
-
-				// 执行后将block传入一个管道，然后上链
-				status, err := e.BlockChain.WriteBlockAndSetHead(okBlock, processRes.Receipt, processRes.Logs, statedb, true)
-				fmt.Println("writeBlock status : ", status)
-				if err != nil {
-					panic(err)
-				}
-				// 发送新建block的请求（写入initBlockCH）
-				needNew = true
-			} else {
-				continue
-			}
+		case <-e.executionTxsCh:
+		case <-timer.C:
+			timeout = true
 		case <-e.executionTxsSub.Err():
 			return // if error then exit
 		}
+		cfg = e.getBuilderConfig()
+		header := e.initHeader(COINBASE, cfg.GasLimit)
+		txs, full := e.pendingTxs(header, cfg)
+		if !timeout && !full {
+			continue
+		}
+		e.buildBlock(header, txs, cfg.Lanes)
+		// 出块或者超时后重新计时
+		if !timeout && !timer.Stop() {
+			<-timer.C
+		}
+		timer.Reset(cfg.Interval)
+	}
+}
+
+// ImportBlock 验证从共识层收到的区块，重新执行的结果与区块头一致才上链，否则拒绝该区块
+// 区块不在当前链头之上时作为分叉保存，等待FinalizeBlock切换规范链
+func (e *ExecutorService) ImportBlock(block *types.Block) (*core.VerifyReport, error) {
+	// 创世区块没有父区块，只能由SetupGenesisBlock写入
+	if block.NumberU64() == 0 {
+		return nil, fmt.Errorf("%w: cannot import genesis block %x", core.ErrInvalidNumber, block.Hash())
+	}
+	parentHeader := e.BlockChain.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parentHeader == nil {
+		return nil, fmt.Errorf("%w: parent %x", core.ErrUnknownAncestor, block.ParentHash())
+	}
+	// StateAt打开的是独立的状态，验证失败不影响本地状态
+	statedb, err := e.BlockChain.StateAt(parentHeader.StateRoot)
+	if err != nil {
+		return nil, err
+	}
+	report, err := e.Processer.VerifyBlock(block, statedb, e.BlockChain.VmConfig())
+	if err != nil {
+		return report, err
+	}
+	status, err := e.BlockChain.WriteBlockAndSetHead(block, report.Result.Receipt, report.Result.Logs, statedb, true)
+	fmt.Println("writeBlock status : ", status)
+	return report, err
+}
+
+// FinalizeBlock 共识层最终确认区块，区块不在规范链上时切换规范链，被丢弃的交易由交易池重新注入
+func (e *ExecutorService) FinalizeBlock(hash common.Hash) error {
+	return e.BlockChain.Finalize(hash)
+}
+
+// CreateAccessList 在当前链头状态上为下一个区块模拟执行交易，返回交易应当声明的AccessList与使用的汽油，不修改链上状态
+// 没有指定GasLimit时使用区块的GasLimit，Nonce使用发送方当前的nonce
+func (e *ExecutorService) CreateAccessList(msg *core.TxMessage) (*core.AccessListResult, error) {
+	statedb, err := e.BlockChain.StateAt(e.BlockChain.CurrentBlock().StateRoot)
+	if err != nil {
+		return nil, err
+	}
+	header := e.initHeader(COINBASE, e.getBuilderConfig().GasLimit)
+	if msg.GasLimit == 0 {
+		msg.GasLimit = header.GasLimit
+	}
+	msg.Nonce = statedb.GetNonce(msg.From)
+	if msg.GasFeeCap != nil && msg.GasTipCap != nil && msg.GasFeeCap.Sign() > 0 {
+		msg.GasPrice = cmath.BigMin(new(big.Int).Add(msg.GasTipCap, header.BaseFee), msg.GasFeeCap)
 	}
+	return core.CreateAccessList(e.BlockChain.Config(), e.BlockChain, header, statedb, msg, e.BlockChain.VmConfig())
 }
 
 func (e *ExecutorService) initHeader(coinBase common.Address, gasLimit uint64) *types.Header {
-	blockNum := big.NewInt(0)
+	parent := e.BlockChain.CurrentBlock()
 	header := &types.Header{
-		ParentHash: e.BlockChain.CurrentBlock().Hash(),
+		ParentHash: parent.Hash(),
 		Time:       uint64(time.Now().Unix()),
-		Number:     blockNum.Add(e.BlockChain.CurrentBlock().Number, big.NewInt(1)),
-		BaseFee:    big.NewInt(0),
+		Number:     new(big.Int).Add(parent.Number, big.NewInt(1)),
+		BaseFee:    core.CalcBaseFee(e.BlockChain.Config(), parent),
 		Coinbase:   coinBase,
-		GasLimit:   gasLimit,
+		GasLimit:   core.CalcGasLimit(parent.GasLimit, gasLimit), // 每个区块最多调整允许的幅度，逐步靠近配置的GasLimit
 	}
 	return header
 }
@@ -242,4 +279,5 @@ func (e *ExecutorService) initHeader(coinBase common.Address, gasLimit uint64) *
 func (e *ExecutorService) Stop() {
 	e.executionPool.Close()
 	e.pendingPool.Close()
+	e.BlockChain.Stop()
 }
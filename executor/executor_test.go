@@ -2,7 +2,13 @@ package executor
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/SipengXie/pangu/accesslist"
@@ -11,15 +17,19 @@ import (
 	"github.com/SipengXie/pangu/core/evm"
 	"github.com/SipengXie/pangu/core/rawdb"
 	"github.com/SipengXie/pangu/core/state"
+	"github.com/SipengXie/pangu/core/txpool"
 	"github.com/SipengXie/pangu/core/txpool/legacypool"
 	"github.com/SipengXie/pangu/core/types"
 	"github.com/SipengXie/pangu/crypto"
+	"github.com/SipengXie/pangu/ethdb"
 	"github.com/SipengXie/pangu/event"
 	"github.com/SipengXie/pangu/params"
+	"github.com/SipengXie/pangu/rlp"
 	"github.com/SipengXie/pangu/trie"
 
 	"math/big"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -39,6 +49,7 @@ var (
 	AKeyBytes = common.Hex2Bytes(AKeyHex)
 
 	BAddress = "0x055504FE4d542fE266C7215a9cc2aa22E6a78445"
+	DAddress = "0x0d3ab14bbad3d99f4203bd7a11acb94882050e7e"
 
 	CKeyHex   = "c3914129fade8d775d22202702690a8a0dcb178040bcb232a950c65b84308830"
 	CKeyBytes = common.Hex2Bytes(CKeyHex)
@@ -77,7 +88,7 @@ func (bc *testBlockChain) CurrentBlock() *types.Header {
 }
 
 func (bc *testBlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
-	return types.NewBlock(bc.CurrentBlock(), nil, nil, types.EmptyRootHash, trie.NewStackTrie(nil))
+	return types.NewBlock(bc.CurrentBlock(), nil, nil, nil, types.EmptyRootHash, trie.NewStackTrie(nil))
 }
 
 func (bc *testBlockChain) StateAt(common.Hash) (*state.StateDB, error) {
@@ -293,3 +304,2154 @@ func TestTripleTransferTX(t *testing.T) {
 		}
 	}
 }
+
+// 构造两组互不冲突的交易，A -> B，C -> D
+func NewIndependentTX() []types.Transactions {
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+	DAddr := common.BytesToAddress(common.FromHex(DAddress))
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	CKey, _ := crypto.ToECDSA(CKeyBytes)
+	CAddr := crypto.PubkeyToAddress(CKey.PublicKey)
+
+	tx1 := panguTx(0, BAddr, big.NewInt(100), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+	tx2 := panguTx(0, DAddr, big.NewInt(7), testTxGas, nil, big.NewInt(100), big.NewInt(2), CKeyBytes, CAddr)
+	return []types.Transactions{{tx1}, {tx2}}
+}
+
+// processTxs 在一条新链上按分组方式执行给定分组的交易
+func processTxs(t *testing.T, txs []types.Transactions) *core.ProcessReturnMsg {
+	return processTxsWith(t, txs, core.StrategyGroup)
+}
+
+// processTxsWith 在一条新链上使用指定的执行策略执行给定分组的交易
+func processTxsWith(t testing.TB, txs []types.Transactions, strategy core.ExecStrategy) *core.ProcessReturnMsg {
+	statedb, blockchain, block := newProcessEnv(txs)
+	processor := core.NewStateProcessor(blockchain.Config(), blockchain)
+	processor.SetStrategy(strategy, 0)
+	returnmsg, err := processor.Process(block, statedb, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	return returnmsg
+}
+
+// newProcessEnv 新建一条链，A和C有初始余额，返回父状态、链和装入交易的待执行区块
+func newProcessEnv(txs []types.Transactions) (*state.StateDB, *core.Blockchain, *types.Block) {
+	return newProcessEnvWith(txs, nil)
+}
+
+// newProcessEnvWith 与newProcessEnv相同，setup不为nil时在创世状态中写入额外的内容（例如合约代码与存储）
+func newProcessEnvWith(txs []types.Transactions, setup func(*state.StateDB)) (*state.StateDB, *core.Blockchain, *types.Block) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	CKey, _ := crypto.ToECDSA(CKeyBytes)
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetBalance(crypto.PubkeyToAddress(AKey.PublicKey), big.NewInt(99999999999999999))
+	statedb.SetBalance(crypto.PubkeyToAddress(CKey.PublicKey), big.NewInt(99999999999999999))
+	if setup != nil {
+		setup(statedb)
+	}
+
+	chainCfg := &params.ChainConfig{ChainID: big.NewInt(1337), AccessListPenalty: params.DefaultAccessListPenalty}
+	blockchain := core.NewBlokchain(chainCfg, statedb, evm.Config{})
+	curblock := blockchain.CurrentBlock()
+	curblock.BaseFee = big.NewInt(0)
+	block := blockchain.GetBlock(curblock.Hash(), curblock.Number.Uint64())
+	block = types.InitBlock(block.Header(), txs)
+	return statedb, blockchain, block
+}
+
+// withReexecRounds 返回config的副本，其中降级交易最多重新并行执行rounds轮
+func withReexecRounds(config *params.ChainConfig, rounds uint64) *params.ChainConfig {
+	cpy := *config
+	cpy.ReexecRounds = &rounds
+	return &cpy
+}
+
+// 测试并行组各自在独立的stateDB上执行，合并后的状态根与串行执行一致
+func TestParallelGroupsMatchSerial(t *testing.T) {
+	parallel := NewIndependentTX()
+	serial := []types.Transactions{{parallel[0][0], parallel[1][0]}}
+
+	parallelRes := processTxs(t, parallel)
+	serialRes := processTxs(t, serial)
+
+	for _, res := range parallelRes.MergeResult {
+		if !res.Merged {
+			t.Fatalf("group %d unexpectedly demoted, conflict %v", res.GroupID, res.Conflict)
+		}
+	}
+	if parallelRes.RootHash != serialRes.RootHash {
+		t.Fatalf("state root mismatch: parallel %x serial %x", parallelRes.RootHash, serialRes.RootHash)
+	}
+	if *parallelRes.UsedGas != *serialRes.UsedGas {
+		t.Fatalf("gas used mismatch: parallel %d serial %d", *parallelRes.UsedGas, *serialRes.UsedGas)
+	}
+}
+
+// 测试写集合冲突的并行组被降级到串行队列，且状态根与串行执行一致
+func TestConflictingGroupDemoted(t *testing.T) {
+	txs := NewTripleTX()
+	// A -> B 与 C -> B 都写B，强行拆成两组
+	grouped := []types.Transactions{{txs[0][0], txs[0][1]}, {txs[0][2]}}
+
+	groupedRes := processTxs(t, grouped)
+	serialRes := processTxs(t, txs)
+
+	if groupedRes.MergeResult[0].Merged == groupedRes.MergeResult[1].Merged {
+		t.Fatalf("expected exactly one group to be demoted")
+	}
+	if groupedRes.RootHash != serialRes.RootHash {
+		t.Fatalf("state root mismatch: grouped %x serial %x", groupedRes.RootHash, serialRes.RootHash)
+	}
+}
+
+// 测试链配置规定写集合冲突使区块执行失败时，Process返回ErrGroupConflict
+func TestConflictingGroupFails(t *testing.T) {
+	txs := NewTripleTX()
+	statedb, blockchain, block := newProcessEnv([]types.Transactions{{txs[0][0], txs[0][1]}, {txs[0][2]}})
+	config := *blockchain.Config()
+	config.MergePolicy = uint8(core.MergeFail)
+	if _, err := core.NewStateProcessor(&config, blockchain).Process(block, statedb, evm.Config{}); !errors.Is(err, core.ErrGroupConflict) {
+		t.Fatalf("expected group conflict error, got %v", err)
+	}
+}
+
+// 测试Block-STM乐观并行执行存在读写冲突的交易，状态根与串行执行一致
+func TestSTMMatchesSerial(t *testing.T) {
+	txs := NewTripleTX()
+	// C -> D，依赖前一笔 C -> B 写入的nonce和余额
+	CKey, _ := crypto.ToECDSA(CKeyBytes)
+	DAddr := common.BytesToAddress(common.FromHex(DAddress))
+	txs[0] = append(txs[0], panguTx(1, DAddr, big.NewInt(7), testTxGas, nil, big.NewInt(100), big.NewInt(2), CKeyBytes, crypto.PubkeyToAddress(CKey.PublicKey)))
+
+	stmRes := processTxsWith(t, txs, core.StrategySTM)
+	serialRes := processTxs(t, txs)
+
+	if len(stmRes.ErrTx) != 0 || len(stmRes.Receipt) != len(txs[0]) {
+		t.Fatalf("expected all %d transactions to succeed, got %d receipts", len(txs[0]), len(stmRes.Receipt))
+	}
+	if stmRes.STMStats == nil || stmRes.STMStats.Executions < len(txs[0]) {
+		t.Fatalf("unexpected stm stats %+v", stmRes.STMStats)
+	}
+	if stmRes.RootHash != serialRes.RootHash {
+		t.Fatalf("state root mismatch: stm %x serial %x", stmRes.RootHash, serialRes.RootHash)
+	}
+	if *stmRes.UsedGas != *serialRes.UsedGas {
+		t.Fatalf("gas used mismatch: stm %d serial %d", *stmRes.UsedGas, *serialRes.UsedGas)
+	}
+	for i, receipt := range stmRes.Receipt {
+		if receipt.TxHash != txs[0][i].Hash() {
+			t.Fatalf("receipt %d out of block order", i)
+		}
+	}
+}
+
+func BenchmarkProcessGroup(b *testing.B) {
+	txs := NewIndependentTX()
+	for i := 0; i < b.N; i++ {
+		processTxsWith(b, txs, core.StrategyGroup)
+	}
+}
+
+func BenchmarkProcessSTM(b *testing.B) {
+	txs := NewIndependentTX()
+	for i := 0; i < b.N; i++ {
+		processTxsWith(b, txs, core.StrategySTM)
+	}
+}
+
+// 测试ForkView是写时复制的视图：读到父状态中尚未写入状态树的修改，视图的写入不影响父状态与其他视图，写集合只包含视图自己的修改
+func TestForkView(t *testing.T) {
+	AAddr, CAddr := common.HexToAddress("0xa"), common.HexToAddress("0xc")
+	Contract, Slot := common.HexToAddress("0xc0de"), common.HexToHash("0x01")
+	base, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	base.SetBalance(AAddr, big.NewInt(1))
+	base.SetBalance(CAddr, big.NewInt(2))
+	base.SetCode(Contract, common.FromHex("0x00"))
+	base.SetState(Contract, Slot, common.BytesToHash([]byte{1}))
+	base.Finalise(true)
+
+	fork, other := base.ForkView(), base.ForkView()
+	if fork.GetBalance(CAddr).Uint64() != 2 || fork.GetState(Contract, Slot) != common.BytesToHash([]byte{1}) {
+		t.Fatalf("pending changes of the parent not visible in the view")
+	}
+	fork.SetBalance(AAddr, big.NewInt(10))
+	fork.SetState(Contract, Slot, common.BytesToHash([]byte{2}))
+	fork.Finalise(true)
+	if ws := fork.WriteSet(); len(ws) != 2 || ws[0] != AAddr || ws[1] != Contract {
+		t.Fatalf("unexpected write set %v", ws)
+	}
+	if base.GetBalance(AAddr).Uint64() != 1 || base.GetState(Contract, Slot) != common.BytesToHash([]byte{1}) {
+		t.Fatalf("view writes leaked into the parent")
+	}
+	if other.GetBalance(AAddr).Uint64() != 1 || other.GetState(Contract, Slot) != common.BytesToHash([]byte{1}) {
+		t.Fatalf("view writes leaked into another view")
+	}
+	// 视图的副本同样读取父状态，父状态之后的修改不影响副本
+	cpy := fork.Copy()
+	base.SetBalance(CAddr, big.NewInt(20))
+	base.SetState(Contract, Slot, common.BytesToHash([]byte{3}))
+	base.Finalise(true)
+	if cpy.GetBalance(CAddr).Uint64() != 2 || cpy.GetBalance(AAddr).Uint64() != 10 || cpy.GetState(Contract, Slot) != common.BytesToHash([]byte{2}) {
+		t.Fatalf("copy of a view lost the parent state or saw later parent writes")
+	}
+}
+
+// BenchmarkForkView 区块中已经修改过大量账户时创建视图并访问一个账户的开销
+func BenchmarkForkView(b *testing.B) {
+	base, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	for i := 0; i < 10000; i++ {
+		base.SetBalance(common.BigToAddress(big.NewInt(int64(i+1))), big.NewInt(1))
+	}
+	base.Finalise(true)
+	addr := common.BigToAddress(big.NewInt(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		base.ForkView().GetBalance(addr)
+	}
+}
+
+// 测试分组顺序与输入顺序无关，收据按规范顺序编号，多次执行得到相同的交易根与收据根
+func TestDeterministicOrdering(t *testing.T) {
+	independent := NewIndependentTX()
+	triple := NewTripleTX()
+	txs := types.Transactions{independent[1][0], triple[0][2], independent[0][0]}
+	reversed := types.Transactions{txs[2], txs[1], txs[0]}
+
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	groups := core.ClassifyTx(txs, signer)
+	groupsReversed := core.ClassifyTx(reversed, signer)
+	if len(groups) != len(groupsReversed) {
+		t.Fatalf("group count mismatch: %d vs %d", len(groups), len(groupsReversed))
+	}
+	for i := range groups {
+		for j := range groups[i] {
+			if groups[i][j].Hash() != groupsReversed[i][j].Hash() {
+				t.Fatalf("group %d tx %d differs between input orders", i, j)
+			}
+		}
+	}
+
+	var roots []common.Hash
+	for run := 0; run < 3; run++ {
+		res := processTxs(t, groups)
+		var cumulative uint64
+		for i, receipt := range res.Receipt {
+			cumulative += receipt.GasUsed
+			if receipt.TransactionIndex != uint(i) || receipt.CumulativeGasUsed != cumulative {
+				t.Fatalf("receipt %d: index %d cumulative %d, want %d %d", i, receipt.TransactionIndex, receipt.CumulativeGasUsed, i, cumulative)
+			}
+		}
+		block := types.NewBlock(&types.Header{Number: big.NewInt(1)}, groups, res.Layout(), res.Receipt, res.RootHash, trie.NewStackTrie(nil))
+		roots = append(roots, block.Header().TxRoot, block.Header().ReceiptRoot)
+	}
+	for i := 2; i < len(roots); i++ {
+		if roots[i] != roots[i%2] {
+			t.Fatalf("roots differ between runs")
+		}
+	}
+}
+
+// 测试验证者重新执行提议者封装的区块，结果一致时通过，区块头被篡改时返回逐项的不一致报告
+func TestVerifyBlock(t *testing.T) {
+	txs := NewIndependentTX()
+	txs = append(txs, NewTripleTX()[0][2:])
+
+	// 提议者执行并封装区块
+	statedb, blockchain, block := newProcessEnv(txs)
+	res, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	header := types.CopyHeader(block.Header())
+	header.GasUsed = *res.UsedGas
+	sealed := types.NewBlock(header, txs, res.Layout(), res.Receipt, res.RootHash, trie.NewStackTrie(nil))
+
+	// 验证者在自己的父状态上重新执行
+	statedb, blockchain, _ = newProcessEnv(nil)
+	report, err := core.NewStateProcessor(blockchain.Config(), blockchain).VerifyBlock(sealed, statedb, evm.Config{})
+	if err != nil || !report.Valid() {
+		t.Fatalf("valid block rejected: %v %v", err, report.Mismatches)
+	}
+	// 使用Block-STM策略的验证者同样按分组重新执行，得到相同的执行布局
+	statedb, blockchain, _ = newProcessEnv(nil)
+	verifier := core.NewStateProcessor(blockchain.Config(), blockchain)
+	verifier.SetStrategy(core.StrategySTM, 0)
+	if report, err := verifier.VerifyBlock(sealed, statedb, evm.Config{}); err != nil || !report.Valid() {
+		t.Fatalf("valid block rejected by an STM verifier: %v %v", err, report.Mismatches)
+	}
+	// 找不到父区块时无法检查基础费，直接拒绝
+	header = types.CopyHeader(sealed.Header())
+	header.Number = big.NewInt(1)
+	header.ParentHash = common.Hash{1}
+	orphan := types.NewBlock(header, txs, res.Layout(), res.Receipt, res.RootHash, trie.NewStackTrie(nil))
+	statedb, blockchain, _ = newProcessEnv(nil)
+	if _, err := core.NewStateProcessor(blockchain.Config(), blockchain).VerifyBlock(orphan, statedb, evm.Config{}); !errors.Is(err, core.ErrUnknownAncestor) {
+		t.Fatalf("expected ErrUnknownAncestor, got %v", err)
+	}
+
+	// 篡改状态根和汽油费
+	header = types.CopyHeader(sealed.Header())
+	header.GasUsed++
+	forged := types.NewBlock(header, txs, res.Layout(), res.Receipt, common.Hash{1}, trie.NewStackTrie(nil))
+	statedb, blockchain, _ = newProcessEnv(nil)
+	report, err = core.NewStateProcessor(blockchain.Config(), blockchain).VerifyBlock(forged, statedb, evm.Config{})
+	if !errors.Is(err, core.ErrBlockMismatch) {
+		t.Fatalf("expected ErrBlockMismatch, got %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, m := range report.Mismatches {
+		fields[m.Field] = true
+	}
+	if len(fields) != 2 || !fields["StateRoot"] || !fields["GasUsed"] {
+		t.Fatalf("unexpected mismatches %v", report.Mismatches)
+	}
+}
+
+// guaranteedTx 构造一笔担保交易：担保人先签名，用户再对包括担保人签名在内的整个交易签名
+func guaranteedTx(nonce uint64, to common.Address, amount *big.Int, gasLimit uint64, tip *big.Int, key, guarKey []byte, from common.Address) *types.Transaction {
+	al := accesslist.NewAccessList()
+	al.AddAddress(from)
+	al.AddAddress(to)
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	tx := types.NewTx(&types.GuaranteedTransaction{
+		To:         &to,
+		Nonce:      nonce,
+		Value:      amount,
+		GasLimit:   gasLimit,
+		TipCap:     tip,
+		FeeCap:     big.NewInt(100),
+		ChainID:    big.NewInt(1337),
+		AccessList: al,
+	})
+	tx, _ = types.SignGuarantor(tx, signer, guarKey, types.SIG_ECDSA)
+	tx, _ = types.SignTx(tx, signer, key, types.SIG_ECDSA)
+	return tx
+}
+
+// 测试担保交易的汽油费由担保人支付：正常执行打折收取，出错时收取 1.5 * GasLimit
+func TestGuaranteedTxFeeLiability(t *testing.T) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	CKey, _ := crypto.ToECDSA(CKeyBytes)
+	CAddr := crypto.PubkeyToAddress(CKey.PublicKey)
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+	DAddr := common.BytesToAddress(common.FromHex(DAddress))
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+
+	okTx := guaranteedTx(0, BAddr, big.NewInt(100), testTxGas, big.NewInt(2), AKeyBytes, CKeyBytes, AAddr)
+	if from, err := types.Sender(signer, okTx); err != nil || from != AAddr {
+		t.Fatalf("sender mismatch: %v %v", from, err)
+	}
+	if guar, err := types.Guarantor(signer, okTx); err != nil || guar != CAddr {
+		t.Fatalf("guarantor mismatch: %v %v", guar, err)
+	}
+	// D 的代码只有一个INVALID指令，调用一定出错
+	failTx := guaranteedTx(1, DAddr, big.NewInt(0), testTxGas, big.NewInt(2), AKeyBytes, CKeyBytes, AAddr)
+
+	statedb, blockchain, block := newProcessEnv([]types.Transactions{{okTx, failTx}})
+	statedb.SetCode(DAddr, []byte{0xfe})
+	beforeA := new(big.Int).Set(statedb.GetBalance(AAddr))
+	beforeC := new(big.Int).Set(statedb.GetBalance(CAddr))
+	res, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	if len(res.Receipt) != 2 || len(res.ErrTx) != 0 {
+		t.Fatalf("expected two receipts, got %d receipts %d errors", len(res.Receipt), len(res.ErrTx))
+	}
+	if res.Receipt[0].Status != types.ReceiptStatusSuccessful || res.Receipt[1].Status != types.ReceiptStatusFailed {
+		t.Fatalf("expected one success and one failure")
+	}
+
+	// 发送方只支付转账金额
+	if spent := new(big.Int).Sub(beforeA, statedb.GetBalance(AAddr)); spent.Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("sender paid %v, want 100", spent)
+	}
+	// 担保人支付 9/10 * GasUsed * 2 + 1.5 * GasLimit * 2
+	okFee := res.Receipt[0].GasUsed * params.GuarGasDiscountNumerator / params.GuarGasDiscountDenominator * 2
+	failFee := testTxGas * params.GuarErrGasNumerator / params.GuarErrGasDenominator * 2
+	want := new(big.Int).SetUint64(okFee + failFee)
+	if spent := new(big.Int).Sub(beforeC, statedb.GetBalance(CAddr)); spent.Cmp(want) != 0 {
+		t.Fatalf("guarantor paid %v, want %v", spent, want)
+	}
+}
+
+// 测试聚合交易在执行时拆开，内部交易的收据记录聚合交易的哈希，聚合者nonce加一
+func TestAggregateTx(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	aggKeyBytes := common.Hex2Bytes("c3914129fade8d775d22202702690a8a0dcb178040bcb232a950c65b84308831")
+	aggKey, _ := crypto.ToECDSA(aggKeyBytes)
+	aggAddr := crypto.PubkeyToAddress(aggKey.PublicKey)
+
+	inner := NewIndependentTX()
+	agg, err := types.NewAggregateTx(0, big.NewInt(1337), types.Transactions{inner[0][0], inner[1][0]})
+	if err != nil {
+		t.Fatalf("failed to build aggregate: %v", err)
+	}
+	agg, _ = types.SignTx(agg, signer, aggKeyBytes, types.SIG_ECDSA)
+	if from, err := types.Sender(signer, agg); err != nil || from != aggAddr {
+		t.Fatalf("aggregator mismatch: %v %v", from, err)
+	}
+
+	// 编解码后哈希不变
+	enc, _ := agg.MarshalBinary()
+	decoded := new(types.Transaction)
+	if err := decoded.UnmarshalBinary(enc); err != nil || decoded.Hash() != agg.Hash() {
+		t.Fatalf("aggregate round trip failed: %v", err)
+	}
+
+	groups := core.ClassifyTx(types.Transactions{agg}, signer)
+	statedb, blockchain, block := newProcessEnv(groups)
+	res, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	if len(res.Receipt) != 2 {
+		t.Fatalf("expected 2 inner receipts, got %d (errors %d)", len(res.Receipt), len(res.ErrTx))
+	}
+	for i, receipt := range res.Receipt {
+		if receipt.AggregateHash != agg.Hash() || receipt.TxHash != inner[i][0].Hash() {
+			t.Fatalf("receipt %d not linked to aggregate", i)
+		}
+	}
+	if nonce := statedb.GetNonce(aggAddr); nonce != 1 {
+		t.Fatalf("aggregator nonce %d, want 1", nonce)
+	}
+
+	// 聚合者按基础费支付Cover的内在汽油，余额不足时整笔聚合交易不执行
+	for _, funds := range []int64{1000000, 1000} {
+		statedb, blockchain, block := newProcessEnvWith(groups, func(s *state.StateDB) {
+			s.SetBalance(aggAddr, big.NewInt(funds))
+		})
+		block.Header().BaseFee = big.NewInt(10)
+		res, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+		if err != nil {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		cost := int64(params.TxGas * 10)
+		if funds < cost {
+			if len(res.Receipt) != 0 || statedb.GetNonce(aggAddr) != 0 || statedb.GetBalance(aggAddr).Int64() != funds {
+				t.Fatalf("aggregate executed although the aggregator cannot pay for the cover")
+			}
+			continue
+		}
+		if len(res.Receipt) != 2 || statedb.GetNonce(aggAddr) != 1 {
+			t.Fatalf("expected 2 inner receipts, got %d (errors %d)", len(res.Receipt), len(res.ErrTx))
+		}
+		if balance := statedb.GetBalance(aggAddr).Int64(); balance != funds-cost {
+			t.Fatalf("aggregator balance %d, want %d", balance, funds-cost)
+		}
+		// Cover的汽油不计入区块的GasUsed
+		if *res.UsedGas != res.Receipt[0].GasUsed+res.Receipt[1].GasUsed {
+			t.Fatalf("block gas %d includes the cover", *res.UsedGas)
+		}
+	}
+
+	// 内部交易被篡改后Cover签名失效
+	forged, _ := types.NewAggregateTx(0, big.NewInt(1337), types.Transactions{inner[0][0]})
+	forged, _ = forged.WithSignature(signer, agg.RawSigValues(), types.SIG_ECDSA)
+	if from, _ := types.Sender(signer, forged); from == aggAddr {
+		t.Fatalf("cover signature still valid after dropping an inner tx")
+	}
+}
+
+// 测试加密交易：交易池只看到Cover，执行前用执行者私钥解密；无法解密的交易生成失败收据并消耗nonce
+func TestEncryptedTx(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	execKey, _ := crypto.GenerateKey()
+	wrongKey, _ := crypto.GenerateKey()
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+
+	al := accesslist.NewAccessList()
+	al.AddAddress(AAddr)
+	al.AddAddress(BAddr)
+	inner := &types.PanguTransaction{
+		To:         &BAddr,
+		Nonce:      0,
+		Value:      big.NewInt(100),
+		GasLimit:   testTxGas,
+		TipCap:     big.NewInt(1),
+		FeeCap:     big.NewInt(100),
+		ChainID:    big.NewInt(1337),
+		Data:       []byte{0x01, 0x02},
+		AccessList: al,
+	}
+	if err := inner.SealContent(&execKey.PublicKey, types.ENC_ECIES); err != nil {
+		t.Fatalf("failed to seal content: %v", err)
+	}
+	tx, err := types.SignNewTx(inner, signer, AKeyBytes, types.SIG_ECDSA)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if !tx.IsEncrypted() || len(tx.Data()) != 0 || tx.AccessList().Len() != 0 {
+		t.Fatalf("plaintext content leaked into the cover")
+	}
+	data, list, err := tx.DecryptContent(execKey)
+	if err != nil || !bytes.Equal(data, []byte{0x01, 0x02}) || !list.ContainsAddress(BAddr) {
+		t.Fatalf("decrypted content mismatch: %x %v", data, err)
+	}
+
+	for _, tt := range []struct {
+		key    *ecdsa.PrivateKey
+		status uint64
+		value  int64
+	}{
+		{execKey, types.ReceiptStatusSuccessful, 100},
+		{wrongKey, types.ReceiptStatusFailed, 0},
+	} {
+		statedb, blockchain, block := newProcessEnv([]types.Transactions{{tx}})
+		processor := core.NewStateProcessor(blockchain.Config(), blockchain)
+		processor.SetDecryptKey(tt.key)
+		res, err := processor.Process(block, statedb, evm.Config{})
+		if err != nil {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		if len(res.Receipt) != 1 || res.Receipt[0].Status != tt.status {
+			t.Fatalf("unexpected receipts %v (errors %d)", res.Receipt, len(res.ErrTx))
+		}
+		// 分组时看不到加密交易实际的AccessList，它总是在串行队列执行
+		if len(res.SerialLane) != 1 || res.SerialLane[0] != tx.Hash() {
+			t.Fatalf("encrypted tx not executed serially: %v", res.SerialLane)
+		}
+		if nonce := statedb.GetNonce(AAddr); nonce != 1 {
+			t.Fatalf("sender nonce %d, want 1", nonce)
+		}
+		if balance := statedb.GetBalance(BAddr); balance.Int64() != tt.value {
+			t.Fatalf("recipient balance %v, want %d", balance, tt.value)
+		}
+	}
+}
+
+// 测试从并行组降级的交易按AccessList的不一致程度收取惩罚汽油，并记录在收据中
+func TestAccessListPenalty(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	CKey, _ := crypto.ToECDSA(CKeyBytes)
+	CAddr := crypto.PubkeyToAddress(CKey.PublicKey)
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+	DAddr := common.BytesToAddress(common.FromHex(DAddress))
+
+	// C -> B，declared为声明的AccessList
+	transfer := func(declared ...common.Address) *types.Transaction {
+		al := accesslist.NewAccessList()
+		for _, addr := range declared {
+			al.AddAddress(addr)
+		}
+		tx, _ := types.SignNewTx(&types.PanguTransaction{
+			To:         &BAddr,
+			Value:      big.NewInt(1),
+			GasLimit:   testTxGas,
+			TipCap:     big.NewInt(2),
+			FeeCap:     big.NewInt(100),
+			ChainID:    big.NewInt(1337),
+			AccessList: al,
+		}, signer, CKeyBytes, types.SIG_ECDSA)
+		return tx
+	}
+	first := panguTx(0, BAddr, big.NewInt(100), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+
+	for _, tt := range []struct {
+		tx      *types.Transaction
+		penalty uint64
+	}{
+		{transfer(CAddr, BAddr), 0},
+		{transfer(CAddr, BAddr, DAddr), params.AccessListPenaltyBaseGas + params.AccessListPenaltyAddressGas},
+		{transfer(CAddr), params.AccessListPenaltyBaseGas + params.AccessListPenaltyAddressGas},
+	} {
+		// 两组都写B，第二组被降级到串行队列
+		statedb, blockchain, block := newProcessEnv([]types.Transactions{{first}, {tt.tx}})
+		before := statedb.GetBalance(CAddr)
+		res, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+		if err != nil {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		if res.MergeResult[1].Merged || len(res.Receipt) != 2 {
+			t.Fatalf("expected the second group to be demoted")
+		}
+		receipt := res.Receipt[1]
+		if receipt.TxHash != tt.tx.Hash() || receipt.AccessListPenalty != tt.penalty {
+			t.Fatalf("penalty %d, want %d", receipt.AccessListPenalty, tt.penalty)
+		}
+		if res.Receipt[0].AccessListPenalty != 0 {
+			t.Fatalf("merged tx was penalized")
+		}
+		spent := new(big.Int).Sub(before, statedb.GetBalance(CAddr))
+		want := new(big.Int).SetUint64((receipt.GasUsed + tt.penalty) * 2)
+		if spent.Sub(spent, big.NewInt(1)).Cmp(want) != 0 {
+			t.Fatalf("sender paid %v, want %v", spent, want)
+		}
+		// 惩罚汽油不计入GasUsed，区块的汽油总量等于收据之和
+		if *res.UsedGas != res.Receipt[0].GasUsed+receipt.GasUsed {
+			t.Fatalf("block gas %d includes the penalty", *res.UsedGas)
+		}
+		// 惩罚汽油随收据一起存储，从数据库读回的收据与执行结果一致
+		db := rawdb.NewMemoryDatabase()
+		rawdb.WriteReceipts(db, block.Hash(), 1, res.Receipt)
+		stored := rawdb.ReadRawReceipts(db, block.Hash(), 1)
+		if len(stored) != 2 || stored[1].AccessListPenalty != tt.penalty || stored[1].GasUsed != receipt.GasUsed || stored[1].EffectiveGasPrice.Cmp(receipt.EffectiveGasPrice) != 0 {
+			t.Fatalf("stored receipt lost the penalty: %+v", stored)
+		}
+	}
+
+	// GasPrice为0时无法收取惩罚，收据中不记录惩罚
+	free, _ := types.SignNewTx(&types.PanguTransaction{
+		To:       &BAddr,
+		Value:    big.NewInt(1),
+		GasLimit: testTxGas,
+		TipCap:   big.NewInt(0),
+		FeeCap:   big.NewInt(0),
+		ChainID:  big.NewInt(1337),
+	}, signer, CKeyBytes, types.SIG_ECDSA)
+	statedb, blockchain, block := newProcessEnv([]types.Transactions{{first}, {free}})
+	before := statedb.GetBalance(CAddr)
+	res, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+	if err != nil || len(res.Receipt) != 2 || res.MergeResult[1].Merged {
+		t.Fatalf("expected the zero price tx to be demoted: %v", err)
+	}
+	if penalty := res.Receipt[1].AccessListPenalty; penalty != 0 {
+		t.Fatalf("zero price tx reported penalty %d that was never charged", penalty)
+	}
+	if spent := new(big.Int).Sub(before, statedb.GetBalance(CAddr)); spent.Int64() != 1 {
+		t.Fatalf("zero price sender paid %v, want only the value", spent)
+	}
+}
+
+// 测试EIP-1559：基础费随父区块的汽油使用量变化，基础费部分销毁或转给FeeCollector，coinbase只得到实际小费
+func TestBaseFee(t *testing.T) {
+	config := &params.ChainConfig{ChainID: big.NewInt(1337)}
+	parent := &types.Header{GasLimit: 20000000, GasUsed: 10000000, BaseFee: big.NewInt(params.InitialBaseFee)}
+	for _, tt := range []struct {
+		gasUsed uint64
+		want    int64
+	}{
+		{10000000, params.InitialBaseFee},           // 等于目标
+		{20000000, params.InitialBaseFee * 9 / 8},   // 满区块上涨 1/8
+		{0, params.InitialBaseFee * 7 / 8},          // 空区块下降 1/8
+		{10000001, params.InitialBaseFee + 12},      // 略高于目标
+		{9000000, params.InitialBaseFee - 12500000}, // 低于目标
+	} {
+		parent.GasUsed = tt.gasUsed
+		if got := core.CalcBaseFee(config, parent); got.Int64() != tt.want {
+			t.Fatalf("gasUsed %d: base fee %v, want %d", tt.gasUsed, got, tt.want)
+		}
+	}
+	header := &types.Header{BaseFee: big.NewInt(params.InitialBaseFee)}
+	if err := core.VerifyEIP1559Header(config, parent, header); !errors.Is(err, core.ErrInvalidBaseFee) {
+		t.Fatalf("expected ErrInvalidBaseFee, got %v", err)
+	}
+
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	collector := common.HexToAddress("0xfee")
+	for _, feeCollector := range []*common.Address{nil, &collector} {
+		txs := NewSingleTX() // A -> B，小费1，Max Fee 100
+		statedb, blockchain, block := newProcessEnv(txs)
+		blockchain.Config().FeeCollector = feeCollector
+		block.Header().BaseFee = big.NewInt(10)
+		coinbase := block.Coinbase()
+		before := statedb.GetBalance(AAddr)
+
+		res, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+		if err != nil || len(res.Receipt) != 1 {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		receipt := res.Receipt[0]
+		if receipt.EffectiveGasPrice.Int64() != 11 {
+			t.Fatalf("effective gas price %v, want 11", receipt.EffectiveGasPrice)
+		}
+		gas := int64(receipt.GasUsed)
+		if spent := new(big.Int).Sub(before, statedb.GetBalance(AAddr)); spent.Int64() != gas*11+txs[0][0].Value().Int64() {
+			t.Fatalf("sender paid %v, want %d", spent, gas*11+txs[0][0].Value().Int64())
+		}
+		if tip := statedb.GetBalance(coinbase); tip.Int64() != gas {
+			t.Fatalf("coinbase got %v, want %d", tip, gas)
+		}
+		burnt := statedb.GetBalance(collector)
+		if (feeCollector == nil && burnt.Sign() != 0) || (feeCollector != nil && burnt.Int64() != gas*10) {
+			t.Fatalf("fee collector got %v", burnt)
+		}
+	}
+}
+
+// 测试有退款的交易只按扣除退款后的汽油收费：支付方付出的汽油费等于coinbase与FeeCollector收到的总和，收据与区块的汽油也扣除了退款
+func TestRefundConservesBalance(t *testing.T) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	DAddr := common.BytesToAddress(common.FromHex(DAddress))
+	collector := common.HexToAddress("0xfee")
+	// 合约把非零的slot 0清零，得到SSTORE的退款
+	tx := panguTx(0, DAddr, big.NewInt(0), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+	txs := []types.Transactions{{tx}}
+	statedb, blockchain, block := newProcessEnvWith(txs, func(statedb *state.StateDB) {
+		statedb.SetCode(DAddr, common.FromHex("0x600060005500")) // SSTORE(0, 0)
+		statedb.SetState(DAddr, common.Hash{}, common.BigToHash(big.NewInt(1)))
+	})
+	blockchain.Config().FeeCollector = &collector
+	blockchain.Config().AccessListPenalty = nil
+	block.Header().BaseFee = big.NewInt(10)
+	coinbase := block.Coinbase()
+	total := func() *big.Int {
+		sum := new(big.Int).Add(statedb.GetBalance(AAddr), statedb.GetBalance(DAddr))
+		sum.Add(sum, statedb.GetBalance(coinbase))
+		return sum.Add(sum, statedb.GetBalance(collector))
+	}
+	before, balanceA := total(), statedb.GetBalance(AAddr)
+
+	res, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+	if err != nil || len(res.Receipt) != 1 || res.Receipt[0].Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	if statedb.GetState(DAddr, common.Hash{}) != (common.Hash{}) {
+		t.Fatalf("slot not cleared")
+	}
+	gas := res.Receipt[0].GasUsed
+	// 清零slot的退款使扣除后的汽油低于交易的内在汽油
+	if gas >= params.TxGas || *res.UsedGas != gas {
+		t.Fatalf("gas used %d, block gas %d, want refunded gas below %d", gas, *res.UsedGas, params.TxGas)
+	}
+	if spent := new(big.Int).Sub(balanceA, statedb.GetBalance(AAddr)); spent.Uint64() != gas*11 {
+		t.Fatalf("payer spent %v, want %d", spent, gas*11)
+	}
+	if after := total(); after.Cmp(before) != 0 {
+		t.Fatalf("total balance changed from %v to %v", before, after)
+	}
+}
+
+// 测试出块时按价格与nonce顺序选择交易，GasLimit之和与交易数不超过上限，放不下的交易留给下一个区块
+func TestSelectTxs(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	pending := func() map[common.Address][]*types.Transaction {
+		txs := NewTripleTX()[0] // A0, A1, C0
+		AAddr, _ := types.Sender(signer, txs[0])
+		CAddr, _ := types.Sender(signer, txs[2])
+		return map[common.Address][]*types.Transaction{AAddr: txs[:2], CAddr: txs[2:]}
+	}
+	for _, tt := range []struct {
+		gasLimit uint64
+		maxTxs   int
+		want     int
+	}{
+		{10 * testTxGas, 0, 3},
+		{2*testTxGas + testTxGas/2, 0, 2},
+		{10 * testTxGas, 1, 1},
+		{testTxGas - 1, 0, 0},
+	} {
+		selected, gas := core.SelectTxs(types.NewTransactionsByPriceAndNonce(signer, pending(), big.NewInt(0)), tt.gasLimit, tt.maxTxs)
+		if len(selected) != tt.want || gas != uint64(tt.want)*testTxGas || gas > tt.gasLimit {
+			t.Fatalf("gasLimit %d maxTxs %d: selected %d txs with gas %d, want %d", tt.gasLimit, tt.maxTxs, len(selected), gas, tt.want)
+		}
+		nonces := make(map[common.Address]uint64)
+		for _, tx := range selected {
+			from, _ := types.Sender(signer, tx)
+			if tx.Nonce() != nonces[from] {
+				t.Fatalf("nonce gap for %x: got %d, want %d", from, tx.Nonce(), nonces[from])
+			}
+			nonces[from]++
+		}
+	}
+}
+
+// 测试分类器合并传递冲突：tx3同时与tx1、tx2冲突时三笔交易必须在同一组
+func TestClassifyTransitive(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+	DAddr := common.BytesToAddress(common.FromHex(DAddress))
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	CKey, _ := crypto.ToECDSA(CKeyBytes)
+	CAddr := crypto.PubkeyToAddress(CKey.PublicKey)
+	EKeyBytes := common.Hex2Bytes("c3914129fade8d775d22202702690a8a0dcb178040bcb232a950c65b84308831")
+
+	tx1 := panguTx(0, BAddr, big.NewInt(1), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr) // A, B
+	tx2 := panguTx(0, DAddr, big.NewInt(1), testTxGas, nil, big.NewInt(100), big.NewInt(1), CKeyBytes, CAddr) // C, D
+	al := accesslist.NewAccessList()
+	al.AddAddress(BAddr)
+	al.AddAddress(DAddr)
+	tx3, _ := types.SignNewTx(&types.PanguTransaction{
+		To:         &BAddr,
+		Value:      big.NewInt(1),
+		GasLimit:   testTxGas,
+		TipCap:     big.NewInt(1),
+		FeeCap:     big.NewInt(100),
+		ChainID:    big.NewInt(1337),
+		AccessList: al,
+	}, signer, EKeyBytes, types.SIG_ECDSA) // B, D
+
+	groups := core.ClassifyTx(types.Transactions{tx1, tx2, tx3}, signer)
+	if len(groups) != 1 || len(groups[0]) != 3 {
+		t.Fatalf("expected one group of 3 txs, got %d groups", len(groups))
+	}
+	// 同一发送方的交易即使AccessList不相交也必须在同一组
+	tx4 := panguTx(1, DAddr, big.NewInt(1), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+	tx4.AccessList().DeleteAddress(AAddr)
+	if groups := core.ClassifyTx(types.Transactions{tx1, tx4}, signer); len(groups) != 1 {
+		t.Fatalf("txs of the same sender split into %d groups", len(groups))
+	}
+}
+
+// 测试互不冲突的分组按汽油均衡地装入执行通道
+func TestPackGroups(t *testing.T) {
+	var groups []types.Transactions
+	for i, gas := range []uint64{4, 3, 2, 1} {
+		tx := types.NewTx(&types.PanguTransaction{Nonce: uint64(i), GasLimit: gas * testTxGas})
+		groups = append(groups, types.Transactions{tx})
+	}
+	if packed := core.PackGroups(groups, 0); len(packed) != len(groups) {
+		t.Fatalf("lanes = 0 should keep %d groups, got %d", len(groups), len(packed))
+	}
+	packed := core.PackGroups(groups, 2)
+	if len(packed) != 2 {
+		t.Fatalf("expected 2 lanes, got %d", len(packed))
+	}
+	// LPT：4+1 与 3+2，通道内保持原来的分组顺序
+	want := [][]uint64{{0, 3}, {1, 2}}
+	for l, lane := range packed {
+		var gas uint64
+		for i, tx := range lane {
+			if tx.Nonce() != want[l][i] {
+				t.Fatalf("lane %d tx %d is group %d, want %d", l, i, tx.Nonce(), want[l][i])
+			}
+			gas += tx.GasLimit()
+		}
+		if gas != 5*testTxGas {
+			t.Fatalf("lane %d gas %d, want %d", l, gas, 5*testTxGas)
+		}
+	}
+}
+
+// 测试只读同一slot的交易不合并，读写同一slot的交易合并，只读标记随RLP编码保留
+func TestClassifyReadWrite(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	Contract := common.BytesToAddress(common.FromHex(DAddress))
+	Slot := common.HexToHash("0x01")
+	EKeyBytes := common.Hex2Bytes("c3914129fade8d775d22202702690a8a0dcb178040bcb232a950c65b84308831")
+	call := func(key []byte, write bool) *types.Transaction {
+		al := accesslist.NewAccessList()
+		if write {
+			al.AddWriteSlot(Contract, Slot)
+		} else {
+			al.AddReadSlot(Contract, Slot)
+		}
+		tx, _ := types.SignNewTx(&types.PanguTransaction{
+			To:         &Contract,
+			Value:      big.NewInt(0),
+			GasLimit:   testTxGas,
+			TipCap:     big.NewInt(1),
+			FeeCap:     big.NewInt(100),
+			ChainID:    big.NewInt(1337),
+			AccessList: al,
+		}, signer, key, types.SIG_ECDSA)
+		return tx
+	}
+	reader1, reader2, writer := call(AKeyBytes, false), call(CKeyBytes, false), call(EKeyBytes, true)
+	if groups := core.ClassifyTx(types.Transactions{reader1, reader2}, signer); len(groups) != 2 {
+		t.Fatalf("read-only txs merged into %d groups, want 2", len(groups))
+	}
+	if groups := core.ClassifyTx(types.Transactions{reader1, reader2, writer}, signer); len(groups) != 1 {
+		t.Fatalf("readers and writer split into %d groups, want 1", len(groups))
+	}
+
+	enc, err := rlp.EncodeToBytes(reader1.AccessList())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := new(accesslist.AccessList)
+	if err := rlp.DecodeBytes(enc, dec); err != nil {
+		t.Fatal(err)
+	}
+	if !dec.IsReadOnly(Contract) || !dec.IsReadOnlySlot(Contract, Slot) {
+		t.Fatal("read-only marks lost in RLP round trip")
+	}
+	// 没有只读标记的AccessList编码不变
+	plain := accesslist.NewAccessList()
+	plain.AddSlot(Contract, Slot)
+	plainEnc, _ := rlp.EncodeToBytes(plain)
+	legacyEnc, _ := rlp.EncodeToBytes([]struct {
+		Address     common.Address
+		StorageKeys []common.Hash
+	}{{Contract, []common.Hash{Slot}}})
+	if !bytes.Equal(plainEnc, legacyEnc) {
+		t.Fatalf("unmarked access list encoding changed: %x != %x", plainEnc, legacyEnc)
+	}
+	if bytes.Equal(plainEnc, enc) {
+		t.Fatal("read-only marks not part of the encoding")
+	}
+}
+
+// 测试写同一合约不同slot的交易分在同一组：合并按账户检测冲突，拆成两组必然降级其中一组
+func TestClassifySameContractSlots(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	Contract := common.HexToAddress("0xc0de")
+	// AccessList与实际访问完全一致，被降级时不收取惩罚汽油
+	call := func(key []byte, slot common.Hash) *types.Transaction {
+		priv, _ := crypto.ToECDSA(key)
+		al := accesslist.NewAccessList()
+		al.AddWriteAddress(crypto.PubkeyToAddress(priv.PublicKey))
+		al.AddWriteSlot(Contract, slot)
+		tx, _ := types.SignNewTx(&types.PanguTransaction{
+			To:         &Contract,
+			Value:      big.NewInt(0),
+			GasLimit:   testTxGas,
+			TipCap:     big.NewInt(1),
+			FeeCap:     big.NewInt(100),
+			ChainID:    big.NewInt(1337),
+			Data:       slot.Bytes(),
+			AccessList: al,
+		}, signer, key, types.SIG_ECDSA)
+		return tx
+	}
+	txA, txC := call(AKeyBytes, common.HexToHash("0x01")), call(CKeyBytes, common.HexToHash("0x02"))
+	groups := core.ClassifyTx(types.Transactions{txA, txC}, signer)
+	if len(groups) != 1 {
+		t.Fatalf("txs writing slots of the same contract split into %d groups, want 1", len(groups))
+	}
+
+	process := func(txs []types.Transactions) *core.ProcessReturnMsg {
+		statedb, blockchain, block := newProcessEnvWith(txs, func(statedb *state.StateDB) {
+			// PUSH1 1 PUSH1 0 CALLDATALOAD SSTORE STOP：把调用数据指定的slot写为1
+			statedb.SetCode(Contract, common.FromHex("0x60016000355500"))
+		})
+		res, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+		if err != nil || len(res.Receipt) != 2 {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		return res
+	}
+	classified := process(groups)
+	if len(classified.Rounds) != 1 || len(classified.SerialLane) != 0 {
+		t.Fatalf("expected a single round without demotion, got %d rounds and %d serial", len(classified.Rounds), len(classified.SerialLane))
+	}
+	for _, res := range classified.MergeResult {
+		if !res.Merged {
+			t.Fatalf("group %d unexpectedly demoted, conflict %v", res.GroupID, res.Conflict)
+		}
+	}
+	// 拆成两组时两组都写合约账户，其中一组被降级
+	split := process([]types.Transactions{{txA}, {txC}})
+	if split.MergeResult[0].Merged == split.MergeResult[1].Merged {
+		t.Fatalf("expected exactly one split group to be demoted")
+	}
+	if classified.RootHash != split.RootHash {
+		t.Fatalf("state root mismatch: classified %x split %x", classified.RootHash, split.RootHash)
+	}
+}
+
+// 测试合并不比较读集合的前提：并行执行时访问未声明的项、写入声明为只读的项的交易都会被降级，即使各组按给定布局互不冲突
+func TestUndeclaredAccessDemoted(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	Contract := common.HexToAddress("0xc0de")
+	EKeyBytes := common.Hex2Bytes("c3914129fade8d775d22202702690a8a0dcb178040bcb232a950c65b84308831")
+	EKey, _ := crypto.ToECDSA(EKeyBytes)
+	call := func(key []byte, slot common.Hash, declare func(al *accesslist.AccessList)) *types.Transaction {
+		priv, _ := crypto.ToECDSA(key)
+		al := accesslist.NewAccessList()
+		al.AddWriteAddress(crypto.PubkeyToAddress(priv.PublicKey))
+		declare(al)
+		tx, _ := types.SignNewTx(&types.PanguTransaction{
+			To:         &Contract,
+			Value:      big.NewInt(0),
+			GasLimit:   testTxGas,
+			TipCap:     big.NewInt(1),
+			FeeCap:     big.NewInt(100),
+			ChainID:    big.NewInt(1337),
+			Data:       slot.Bytes(),
+			AccessList: al,
+		}, signer, key, types.SIG_ECDSA)
+		return tx
+	}
+	Slot1, Slot2, Slot3 := common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")
+	// A按声明写slot 1；C写入声明为只读的slot 2；E只声明读取合约账户，写入未声明的slot 3
+	txA := call(AKeyBytes, Slot1, func(al *accesslist.AccessList) { al.AddWriteSlot(Contract, Slot1) })
+	txC := call(CKeyBytes, Slot2, func(al *accesslist.AccessList) { al.AddReadSlot(Contract, Slot2) })
+	txE := call(EKeyBytes, Slot3, func(al *accesslist.AccessList) { al.AddReadAddress(Contract) })
+
+	statedb, blockchain, block := newProcessEnvWith([]types.Transactions{{txA}, {txC}, {txE}}, func(statedb *state.StateDB) {
+		statedb.SetBalance(crypto.PubkeyToAddress(EKey.PublicKey), big.NewInt(99999999999999999))
+		// PUSH1 1 PUSH1 0 CALLDATALOAD SSTORE STOP：把调用数据指定的slot写为1
+		statedb.SetCode(Contract, common.FromHex("0x60016000355500"))
+	})
+	res, err := core.NewStateProcessor(withReexecRounds(blockchain.Config(), 0), blockchain).Process(block, statedb, evm.Config{})
+	if err != nil || len(res.Receipt) != 3 {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	demoted := make(map[common.Hash]bool)
+	for _, hash := range res.SerialLane {
+		demoted[hash] = true
+	}
+	if len(demoted) != 2 || !demoted[txC.Hash()] || !demoted[txE.Hash()] {
+		t.Fatalf("expected txC and txE in the serial lane, got %v", res.SerialLane)
+	}
+	for _, slot := range []common.Hash{Slot1, Slot2, Slot3} {
+		if got := statedb.GetState(Contract, slot); got != common.BytesToHash([]byte{1}) {
+			t.Fatalf("slot %x = %x after the block, want 1", slot, got)
+		}
+	}
+}
+
+// 测试模拟执行生成AccessList：区分读写、不修改状态，按生成的AccessList声明时执行汽油一致且不被降级
+func TestCreateAccessList(t *testing.T) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	Contract := common.HexToAddress("0xc0de")
+	statedb, blockchain, _ := newProcessEnv(nil)
+	// PUSH1 0 SLOAD PUSH1 1 SSTORE STOP：读slot 0，写slot 1
+	statedb.SetCode(Contract, common.FromHex("0x60005460015500"))
+	root := statedb.IntermediateRoot(true)
+
+	msg := &core.TxMessage{From: AAddr, To: &Contract, GasLimit: testTxGas}
+	res, err := core.CreateAccessList(blockchain.Config(), blockchain, blockchain.CurrentBlock(), statedb, msg, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create access list: %v", err)
+	}
+	if statedb.IntermediateRoot(true) != root {
+		t.Fatal("simulation modified the state")
+	}
+	al := res.AccessList
+	slot0, slot1 := common.Hash{}, common.BigToHash(big.NewInt(1))
+	if !al.ContainsAddress(AAddr) || al.IsReadOnly(AAddr) {
+		t.Fatal("sender should be written")
+	}
+	if !al.IsReadOnly(Contract) || !al.IsReadOnlySlot(Contract, slot0) || al.IsReadOnlySlot(Contract, slot1) {
+		t.Fatal("wrong read/write marks on the contract")
+	}
+	if _, ok := al.Contains(Contract, slot1); !ok || res.Rounds != 2 {
+		t.Fatalf("slot 1 missing or unexpected rounds %d", res.Rounds)
+	}
+
+	tx, _ := types.SignNewTx(&types.PanguTransaction{
+		To:         &Contract,
+		Value:      big.NewInt(0),
+		GasLimit:   testTxGas,
+		TipCap:     big.NewInt(1),
+		FeeCap:     big.NewInt(100),
+		ChainID:    big.NewInt(1337),
+		AccessList: al,
+	}, types.LatestSignerForChainID(big.NewInt(1337)), AKeyBytes, types.SIG_ECDSA)
+	block := types.InitBlock(blockchain.CurrentBlock(), []types.Transactions{{tx}})
+	ret, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+	if err != nil || len(ret.Receipt) != 1 || len(ret.AlTx) != 0 {
+		t.Fatalf("expected 1 receipt and no demoted tx, got %d and %d (err %v)", len(ret.Receipt), len(ret.AlTx), err)
+	}
+	if ret.Receipt[0].GasUsed != res.GasUsed {
+		t.Fatalf("gas used %d, simulated %d", ret.Receipt[0].GasUsed, res.GasUsed)
+	}
+}
+
+// 测试交易池预执行：按预测的访问集合分组，预测会冲突的交易连同同一发送方的交易放入串行通道
+func TestPredictTx(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	Contract := common.HexToAddress("0xc0de")
+	statedb, blockchain, _ := newProcessEnv(nil)
+	// PUSH1 0 SLOAD STOP：只读slot 0
+	statedb.SetCode(Contract, common.FromHex("0x60005400"))
+	call := func(key []byte, nonce uint64, declare bool) *types.Transaction {
+		al := accesslist.NewAccessList()
+		if declare {
+			al.AddSlot(Contract, common.Hash{})
+		}
+		tx, _ := types.SignNewTx(&types.PanguTransaction{
+			Nonce:      nonce,
+			To:         &Contract,
+			Value:      big.NewInt(0),
+			GasLimit:   testTxGas,
+			TipCap:     big.NewInt(1),
+			FeeCap:     big.NewInt(100),
+			ChainID:    big.NewInt(1337),
+			AccessList: al,
+		}, signer, key, types.SIG_ECDSA)
+		return tx
+	}
+	// 声明的AccessList没有只读标记，A和C按声明会被合并到同一组
+	txA, txC := call(AKeyBytes, 0, true), call(CKeyBytes, 0, true)
+	if groups := core.ClassifyTx(types.Transactions{txA, txC}, signer); len(groups) != 1 {
+		t.Fatalf("declared writes should merge, got %d groups", len(groups))
+	}
+	preds := make(core.Predictions)
+	for _, tx := range []*types.Transaction{txA, txC} {
+		pred, err := core.PredictTx(blockchain.Config(), blockchain, blockchain.CurrentBlock(), statedb, tx, evm.Config{})
+		if err != nil || pred.Conflict {
+			t.Fatalf("unexpected prediction %+v, err %v", pred, err)
+		}
+		preds[tx.Hash()] = pred
+	}
+	if groups, serial := core.ClassifyTxPredicted(types.Transactions{txA, txC}, signer, preds); len(groups) != 2 || len(serial) != 0 {
+		t.Fatalf("predicted reads should not merge, got %d groups and %d serial", len(groups), len(serial))
+	}
+
+	// C的第二笔交易没有声明slot 0，预测会冲突，C的两笔交易都进入串行通道
+	txC2 := call(CKeyBytes, 1, false)
+	pred, err := core.PredictTx(blockchain.Config(), blockchain, blockchain.CurrentBlock(), statedb, txC2, evm.Config{})
+	if err != nil || !pred.Conflict {
+		t.Fatalf("expected a conflict prediction, got %+v, err %v", pred, err)
+	}
+	preds[txC2.Hash()] = pred
+	groups, serial := core.ClassifyTxPredicted(types.Transactions{txA, txC, txC2}, signer, preds)
+	if len(groups) != 1 || len(groups[0]) != 1 || groups[0][0] != txA {
+		t.Fatalf("expected only txA to be grouped, got %d groups", len(groups))
+	}
+	if len(serial) != 2 || serial[0] != txC || serial[1] != txC2 {
+		t.Fatalf("expected both C txs in nonce order as likely serial, got %d", len(serial))
+	}
+}
+
+// 测试预执行结果随交易离开交易池而删除：上链的交易以及被交易池丢弃的交易都不再保留预测结果
+func TestSpeculatorPrune(t *testing.T) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+	genesis := &core.Genesis{Config: &params.ChainConfig{ChainID: big.NewInt(1337)}, BaseFee: big.NewInt(0), Alloc: core.GenesisAlloc{
+		AAddr: {Balance: big.NewInt(99999999999999999)},
+	}}
+	blockchain, err := core.NewBlockchain(rawdb.NewMemoryDatabase(), genesis, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	defer blockchain.Stop()
+	pool := legacypool.New(testTxPoolConfig, blockchain)
+	txPool, err := txpool.New(new(big.Int).SetUint64(testTxPoolConfig.PriceLimit), blockchain, []txpool.SubPool{pool})
+	if err != nil {
+		t.Fatalf("failed to create txpool: %v", err)
+	}
+	defer txPool.Close()
+
+	pending := panguTx(0, BAddr, big.NewInt(1), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+	dropped := panguTx(1, BAddr, big.NewInt(1), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+	if errs := txPool.Add([]*txpool.Transaction{{Tx: pending}}, false, true); errs[0] != nil {
+		t.Fatalf("failed to add tx to pool: %v", errs[0])
+	}
+	s := &Speculator{chain: blockchain, pool: txPool, predictions: core.Predictions{
+		pending.Hash(): &core.TxPrediction{},
+		dropped.Hash(): &core.TxPrediction{},
+	}}
+	// 新链头到达时清理交易池中已经没有的交易
+	s.forget(nil)
+	if s.Prediction(pending.Hash()) == nil || s.Prediction(dropped.Hash()) != nil {
+		t.Fatalf("prediction of the dropped tx not evicted")
+	}
+	s.forget(types.Transactions{pending})
+	if s.Prediction(pending.Hash()) != nil {
+		t.Fatalf("prediction of the included tx not evicted")
+	}
+}
+
+// 测试并行组由有界的worker池执行：worker数不超过配置，所有组都被执行一次，状态根与串行执行一致
+func TestGroupWorkerPool(t *testing.T) {
+	const groupNum, workers = 20, 3
+	var (
+		keys   []*ecdsa.PrivateKey
+		groups []types.Transactions
+		serial types.Transactions
+	)
+	for i := 0; i < groupNum; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		// 各组转给不同的接收方，互不冲突
+		to := common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+		tx := panguTx(0, to, big.NewInt(1), testTxGas, nil, big.NewInt(100), big.NewInt(1), crypto.FromECDSA(key), crypto.PubkeyToAddress(key.PublicKey))
+		groups = append(groups, types.Transactions{tx})
+		serial = append(serial, tx)
+	}
+	process := func(txs []types.Transactions, workers int) *core.ProcessReturnMsg {
+		statedb, blockchain, _ := newProcessEnv(nil)
+		for _, key := range keys {
+			statedb.SetBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(99999999999999999))
+		}
+		processor := core.NewStateProcessor(blockchain.Config(), blockchain)
+		processor.SetStrategy(core.StrategyGroup, workers)
+		res, err := processor.Process(types.InitBlock(blockchain.CurrentBlock(), txs), statedb, evm.Config{})
+		if err != nil {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		return res
+	}
+	pooled := process(groups, workers)
+	serialRes := process([]types.Transactions{serial}, workers)
+
+	if len(pooled.WorkerStats) != workers {
+		t.Fatalf("expected %d workers, got %d", workers, len(pooled.WorkerStats))
+	}
+	var executedGroups, executedTxs int
+	for _, stats := range pooled.WorkerStats {
+		executedGroups += stats.Groups
+		executedTxs += stats.Txs
+	}
+	if executedGroups != groupNum || executedTxs != groupNum || len(pooled.Receipt) != groupNum {
+		t.Fatalf("executed %d groups and %d txs, %d receipts, want %d", executedGroups, executedTxs, len(pooled.Receipt), groupNum)
+	}
+	if len(serialRes.WorkerStats) != 1 {
+		t.Fatalf("a single group should use one worker, got %d", len(serialRes.WorkerStats))
+	}
+	if pooled.RootHash != serialRes.RootHash {
+		t.Fatalf("state root mismatch: pooled %x serial %x", pooled.RootHash, serialRes.RootHash)
+	}
+}
+
+// 测试汽油费以可交换增量记录：coinbase不进入各组的写集合，区块结束时统一写入并给出汇总，两种执行策略结果一致
+func TestFeeSummary(t *testing.T) {
+	for _, strategy := range []core.ExecStrategy{core.StrategyGroup, core.StrategySTM} {
+		txs := NewIndependentTX() // A -> B 小费1，C -> D 小费2
+		statedb, blockchain, block := newProcessEnv(txs)
+		block.Header().BaseFee = big.NewInt(10)
+		processor := core.NewStateProcessor(blockchain.Config(), blockchain)
+		processor.SetStrategy(strategy, 0)
+		res, err := processor.Process(block, statedb, evm.Config{})
+		if err != nil || len(res.Receipt) != 2 {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		for _, merge := range res.MergeResult {
+			for _, addr := range merge.WriteSet {
+				if addr == block.Coinbase() {
+					t.Fatalf("coinbase in the write set of group %d", merge.GroupID)
+				}
+			}
+		}
+		var tips, burnt int64
+		for i, receipt := range res.Receipt {
+			tips += int64(receipt.GasUsed) * int64(i+1)
+			burnt += int64(receipt.GasUsed) * 10
+		}
+		fees := res.FeeSummary
+		if fees == nil || fees.Tips.Int64() != tips || fees.Burnt.Int64() != burnt || fees.Collected.Sign() != 0 {
+			t.Fatalf("strategy %d: unexpected fee summary %+v, want tips %d burnt %d", strategy, fees, tips, burnt)
+		}
+		if got := statedb.GetBalance(block.Coinbase()); got.Int64() != tips {
+			t.Fatalf("strategy %d: coinbase balance %v, want %d", strategy, got, tips)
+		}
+	}
+}
+
+// 测试降级交易按实际访问集合在下一轮重新并行执行，只有剩余的交易串行执行，状态根与直接串行执行一致
+func TestReexecRounds(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	Contract := common.HexToAddress("0xc0de")
+	call := func(key []byte, declare bool) *types.Transaction {
+		al := accesslist.NewAccessList()
+		if declare {
+			al.AddSlot(Contract, common.Hash{})
+		}
+		tx, _ := types.SignNewTx(&types.PanguTransaction{
+			To:         &Contract,
+			Value:      big.NewInt(0),
+			GasLimit:   testTxGas,
+			TipCap:     big.NewInt(1),
+			FeeCap:     big.NewInt(100),
+			ChainID:    big.NewInt(1337),
+			AccessList: al,
+		}, signer, key, types.SIG_ECDSA)
+		return tx
+	}
+	// C没有声明读取的slot 0，第0轮被降级
+	txA, txC := call(AKeyBytes, true), call(CKeyBytes, false)
+	process := func(rounds uint64) *core.ProcessReturnMsg {
+		statedb, blockchain, block := newProcessEnv([]types.Transactions{{txA}, {txC}})
+		// PUSH1 0 SLOAD STOP：只读slot 0
+		statedb.SetCode(Contract, common.FromHex("0x60005400"))
+		res, err := core.NewStateProcessor(withReexecRounds(blockchain.Config(), rounds), blockchain).Process(block, statedb, evm.Config{})
+		if err != nil || len(res.Receipt) != 2 {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		return res
+	}
+
+	reexec := process(core.DefaultReexecRounds)
+	if len(reexec.Rounds) != 2 || len(reexec.SerialLane) != 0 {
+		t.Fatalf("expected one re-execution round and an empty serial lane, got %d rounds and %d serial", len(reexec.Rounds), len(reexec.SerialLane))
+	}
+	round := reexec.Rounds[1]
+	if len(round.Groups) != 1 || round.Groups[0][0] != txC.Hash() || !round.MergeResult[0].Merged {
+		t.Fatalf("expected txC to be re-executed in round 1, got %v", round.Groups)
+	}
+
+	serial := process(0)
+	if len(serial.Rounds) != 1 || len(serial.SerialLane) != 1 || serial.SerialLane[0] != txC.Hash() {
+		t.Fatalf("expected txC in the serial lane without re-execution")
+	}
+	if reexec.RootHash != serial.RootHash {
+		t.Fatalf("state root mismatch: reexec %x serial %x", reexec.RootHash, serial.RootHash)
+	}
+	if reexec.Receipt[1].AccessListPenalty == 0 || reexec.Receipt[1].AccessListPenalty != serial.Receipt[1].AccessListPenalty {
+		t.Fatalf("penalty mismatch: reexec %d serial %d", reexec.Receipt[1].AccessListPenalty, serial.Receipt[1].AccessListPenalty)
+	}
+}
+
+// 测试区块头的GroupRoot承诺执行布局：区块体编码携带布局，验证者的执行布局与承诺不一致时拒绝区块
+func TestGroupRoot(t *testing.T) {
+	txs := NewTripleTX()
+	// A -> B 与 C -> B 都写B，第二组被降级
+	grouped := []types.Transactions{{txs[0][0], txs[0][1]}, {txs[0][2]}}
+	newProcessor := func(blockchain *core.Blockchain, rounds uint64) *core.Processor {
+		return core.NewStateProcessor(withReexecRounds(blockchain.Config(), rounds), blockchain)
+	}
+
+	// 提议者不重新执行降级交易，降级的交易进入串行队列
+	statedb, blockchain, block := newProcessEnv(grouped)
+	res, err := newProcessor(blockchain, 0).Process(block, statedb, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	layout := res.Layout()
+	if len(layout.Rounds) != 1 || len(layout.Serial) != 1 || layout.Serial[0] != txs[0][2].Hash() {
+		t.Fatalf("unexpected layout %+v", layout)
+	}
+	header := types.CopyHeader(block.Header())
+	header.GasUsed = *res.UsedGas
+	sealed := types.NewBlock(header, grouped, layout, res.Receipt, res.RootHash, trie.NewStackTrie(nil))
+	if sealed.GroupRoot() != layout.Hash() || sealed.GroupRoot() == types.EmptyGroupRoot {
+		t.Fatalf("group root %x does not commit to the layout", sealed.GroupRoot())
+	}
+
+	// 布局随区块体编码，GroupRoot参与区块哈希
+	enc, err := rlp.EncodeToBytes(sealed)
+	if err != nil {
+		t.Fatalf("failed to encode block: %v", err)
+	}
+	decoded := new(types.Block)
+	if err := rlp.DecodeBytes(enc, decoded); err != nil {
+		t.Fatalf("failed to decode block: %v", err)
+	}
+	if decoded.Hash() != sealed.Hash() || decoded.Layout().Hash() != sealed.GroupRoot() {
+		t.Fatalf("layout lost in the block encoding")
+	}
+	forgedHeader := types.CopyHeader(sealed.Header())
+	forgedHeader.GroupRoot = types.EmptyGroupRoot
+	if forgedHeader.Hash() == sealed.Hash() {
+		t.Fatalf("group root is not part of the header hash")
+	}
+
+	// 按相同布局执行的验证者接受区块
+	statedb, blockchain, _ = newProcessEnv(nil)
+	if report, err := newProcessor(blockchain, 0).VerifyBlock(decoded, statedb, evm.Config{}); err != nil || !report.Valid() {
+		t.Fatalf("valid block rejected: %v %v", err, report.Mismatches)
+	}
+	// 链配置规定重新并行执行降级交易的验证者得到相同的状态，但执行布局不同
+	statedb, blockchain, _ = newProcessEnv(nil)
+	report, err := newProcessor(blockchain, core.DefaultReexecRounds).VerifyBlock(decoded, statedb, evm.Config{})
+	if !errors.Is(err, core.ErrBlockMismatch) || len(report.Mismatches) != 1 || report.Mismatches[0].Field != "GroupRoot" {
+		t.Fatalf("expected only a GroupRoot mismatch, got %v %v", err, report.Mismatches)
+	}
+}
+
+// 测试构造的revert数据中偏移或长度接近2^64时解析返回错误而不是越界
+func TestUnpackRevertReasonBounds(t *testing.T) {
+	word := func(v uint64) string {
+		return fmt.Sprintf("%064x", v)
+	}
+	selector := "08c379a0"
+	valid := selector + word(0x20) + word(4) + "6e6f706500000000000000000000000000000000000000000000000000000000"
+	if reason, err := core.UnpackRevertReason(common.FromHex(valid)); err != nil || reason != "nope" {
+		t.Fatalf("valid revert data: %q %v", reason, err)
+	}
+	for name, data := range map[string]string{
+		"huge offset": selector + word(math.MaxUint64) + word(4),
+		"huge length": selector + word(0x20) + word(math.MaxUint64) + word(0),
+		"long length": selector + word(0x20) + word(33) + word(0),
+		"past end":    selector + word(0x20),
+	} {
+		if _, err := core.UnpackRevertReason(common.FromHex(data)); err == nil {
+			t.Fatalf("%s: malformed revert data accepted", name)
+		}
+	}
+}
+
+// 测试执行中出错的交易生成失败收据并记录revert原因，执行前被拒绝的交易不上链也不修改状态
+func TestFailedReceipts(t *testing.T) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	CKey, _ := crypto.ToECDSA(CKeyBytes)
+	CAddr := crypto.PubkeyToAddress(CKey.PublicKey)
+	Reverter := common.HexToAddress("0xdead01")
+	Panicker := common.HexToAddress("0xdead02")
+	// PUSH1 len PUSH1 12 PUSH1 0 CODECOPY PUSH1 len PUSH1 0 REVERT，revert数据是代码中第12字节之后的内容
+	revertCode := func(data string) []byte {
+		payload := common.FromHex(data)
+		code := []byte{0x60, byte(len(payload)), 0x60, 0x0c, 0x60, 0x00, 0x39, 0x60, byte(len(payload)), 0x60, 0x00, 0xfd}
+		return append(code, payload...)
+	}
+	// Error("nope")
+	errorData := "08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"6e6f706500000000000000000000000000000000000000000000000000000000"
+	// Panic(0x11)
+	panicData := "4e487b71" + "0000000000000000000000000000000000000000000000000000000000000011"
+
+	reverted := panguTx(0, Reverter, big.NewInt(0), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+	tooHigh := panguTx(5, Reverter, big.NewInt(0), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+	panicked := panguTx(0, Panicker, big.NewInt(0), testTxGas, nil, big.NewInt(100), big.NewInt(1), CKeyBytes, CAddr)
+
+	for _, strategy := range []core.ExecStrategy{core.StrategyGroup, core.StrategySTM} {
+		statedb, blockchain, block := newProcessEnv([]types.Transactions{{reverted, tooHigh}, {panicked}})
+		statedb.SetCode(Reverter, revertCode(errorData))
+		statedb.SetCode(Panicker, revertCode(panicData))
+		before := statedb.GetBalance(AAddr)
+		// REVERT属于Byzantium指令集
+		config := *blockchain.Config()
+		config.ByzantiumBlock = big.NewInt(0)
+		processor := core.NewStateProcessor(&config, blockchain)
+		processor.SetStrategy(strategy, 0)
+		res, err := processor.Process(block, statedb, evm.Config{})
+		if err != nil {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		if len(res.Receipt) != 2 {
+			t.Fatalf("strategy %d: expected 2 receipts, got %d", strategy, len(res.Receipt))
+		}
+		reasons := map[common.Hash]string{
+			reverted.Hash(): "nope",
+			panicked.Hash(): "panic: arithmetic underflow or overflow (0x11)",
+		}
+		for _, receipt := range res.Receipt {
+			if receipt.Status != types.ReceiptStatusFailed || receipt.GasUsed != testTxGas || receipt.RevertReason != reasons[receipt.TxHash] {
+				t.Fatalf("strategy %d: unexpected receipt status %d gas %d reason %q", strategy, receipt.Status, receipt.GasUsed, receipt.RevertReason)
+			}
+		}
+		// 失败的交易收取了全部汽油费，被拒绝的交易没有修改状态
+		if spent := new(big.Int).Sub(before, statedb.GetBalance(AAddr)); spent.Uint64() != testTxGas {
+			t.Fatalf("strategy %d: sender paid %v, want %d", strategy, spent, testTxGas)
+		}
+		if nonce := statedb.GetNonce(AAddr); nonce != 1 {
+			t.Fatalf("strategy %d: sender nonce %d, want 1", strategy, nonce)
+		}
+		if len(res.ErrTx) != 1 || res.ErrTx[0].Tx.Hash() != tooHigh.Hash() || !core.IsTxRejected(res.ErrTx[0].ErrorMsg) {
+			t.Fatalf("strategy %d: expected only the nonce-too-high tx to be rejected, got %d", strategy, len(res.ErrTx))
+		}
+	}
+
+	// 没有启用Byzantium的链上REVERT是无效指令，交易失败但没有revert原因
+	statedb, blockchain, block := newProcessEnv([]types.Transactions{{reverted}})
+	statedb.SetCode(Reverter, revertCode(errorData))
+	res, err := core.NewStateProcessor(blockchain.Config(), blockchain).Process(block, statedb, evm.Config{})
+	if err != nil || len(res.Receipt) != 1 {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	if receipt := res.Receipt[0]; receipt.Status != types.ReceiptStatusFailed || receipt.RevertReason != "" {
+		t.Fatalf("REVERT executed before Byzantium: status %d reason %q", receipt.Status, receipt.RevertReason)
+	}
+}
+
+// 测试区块、收据与状态写入磁盘数据库，重新打开数据库后从链头恢复
+func TestBlockchainRestart(t *testing.T) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+	chainCfg := &params.ChainConfig{ChainID: big.NewInt(1337)}
+	dir := t.TempDir()
+	openDB := func() ethdb.Database {
+		diskdb, err := rawdb.Open(rawdb.OpenOptions{Type: "leveldb", Directory: dir, Cache: 16, Handles: 16})
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		return diskdb
+	}
+
+	diskdb := openDB()
+	genesis := &core.Genesis{Config: chainCfg, BaseFee: big.NewInt(0), Alloc: core.GenesisAlloc{AAddr: {Balance: big.NewInt(99999999999999999)}}}
+	blockchain, err := core.NewBlockchain(diskdb, genesis, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	parent := blockchain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Time:       parent.Time + 1,
+		Number:     big.NewInt(1),
+		GasLimit:   parent.GasLimit,
+		BaseFee:    big.NewInt(0),
+	}
+	txs := NewSingleTX()
+	statedb, _ := blockchain.StateAt(parent.StateRoot)
+	res, err := core.NewStateProcessor(chainCfg, blockchain).Process(types.InitBlock(header, txs), statedb, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	header.GasUsed = *res.UsedGas
+	block := types.NewBlock(header, txs, res.Layout(), res.Receipt, res.RootHash, trie.NewStackTrie(nil))
+	if _, err := blockchain.WriteBlockAndSetHead(block, res.Receipt, res.Logs, statedb, false); err != nil {
+		t.Fatalf("failed to write block: %v", err)
+	}
+	genesisHash := parent.Hash()
+	blockchain.Stop()
+	diskdb.Close()
+
+	// 重新打开数据库，不指定genesis时使用数据库中的链配置
+	diskdb = openDB()
+	defer diskdb.Close()
+	blockchain, err = core.NewBlockchain(diskdb, nil, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to reopen blockchain: %v", err)
+	}
+	defer blockchain.Stop()
+	if head := blockchain.CurrentBlock(); head.Hash() != block.Hash() || head.Number.Uint64() != 1 {
+		t.Fatalf("head not restored: have %d [%x], want 1 [%x]", head.Number, head.Hash(), block.Hash())
+	}
+	if got := blockchain.GetBlockByNumber(0); got == nil || got.Hash() != genesisHash {
+		t.Fatalf("genesis block not restored")
+	}
+	restored := blockchain.GetBlockByNumber(1)
+	if restored == nil || len(restored.Transactions()) != 1 || restored.Layout().Hash() != block.GroupRoot() {
+		t.Fatalf("block body not restored")
+	}
+	if receipts := rawdb.ReadRawReceipts(diskdb, block.Hash(), 1); len(receipts) != 1 || receipts[0].Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("receipts not restored")
+	}
+	if number := rawdb.ReadTxLookupEntry(diskdb, txs[0][0].Hash()); number == nil || *number != 1 {
+		t.Fatalf("tx lookup entry not written")
+	}
+	headState, err := blockchain.StateAt(block.StateRoot())
+	if err != nil {
+		t.Fatalf("failed to open head state: %v", err)
+	}
+	if balance := headState.GetBalance(BAddr); balance.Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("state not restored: balance of B is %v, want 100", balance)
+	}
+	if nonce := headState.GetNonce(AAddr); nonce != 1 {
+		t.Fatalf("state not restored: nonce of A is %d, want 1", nonce)
+	}
+	if blockchain.Config().ChainID.Cmp(chainCfg.ChainID) != 0 {
+		t.Fatalf("chain config not restored")
+	}
+}
+
+// countingWriteDB 记录写入数据库的次数
+type countingWriteDB struct {
+	ethdb.Database
+	writes int
+}
+
+func (db *countingWriteDB) Put(key []byte, value []byte) error {
+	db.writes++
+	return db.Database.Put(key, value)
+}
+
+// 测试从JSON加载的Genesis得到确定的创世区块，数据库中的创世区块与指定的不一致时拒绝打开
+func TestGenesisSpec(t *testing.T) {
+	spec := `{
+		"config": {"chainId": 1337},
+		"timestamp": "0x5f5e100",
+		"gasLimit": "12345678",
+		"baseFeePerGas": "0x3b9aca00",
+		"extraData": "0x70616e6775",
+		"alloc": {
+			"c562a85c8e370159A455e2f5267477DcFff40059": {"balance": "9000000000000000000"},
+			"0x055504FE4d542fE266C7215a9cc2aa22E6a78445": {
+				"balance": "0x1",
+				"nonce": "3",
+				"code": "0x600160005260206000f3",
+				"storage": {"0x0000000000000000000000000000000000000000000000000000000000000001": "0x00000000000000000000000000000000000000000000000000000000000000ff"}
+			}
+		}
+	}`
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	genesis, err := core.LoadGenesis(path)
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+	if genesis.Timestamp != 100000000 || genesis.GasLimit != 12345678 || genesis.BaseFee.Uint64() != params.InitialBaseFee || string(genesis.ExtraData) != "pangu" {
+		t.Fatalf("unexpected genesis header fields %+v", genesis)
+	}
+	if account := genesis.Alloc[BAddr]; account.Nonce != 3 || account.Balance.Uint64() != 1 || len(account.Code) != 10 || len(account.Storage) != 1 {
+		t.Fatalf("unexpected genesis account %+v", account)
+	}
+
+	// 相同的Genesis总是得到相同的创世区块，经过JSON编码后不变
+	block, err := genesis.ToBlock()
+	if err != nil {
+		t.Fatalf("failed to build genesis block: %v", err)
+	}
+	enc, err := json.Marshal(genesis)
+	if err != nil {
+		t.Fatalf("failed to encode genesis: %v", err)
+	}
+	decoded := new(core.Genesis)
+	if err := json.Unmarshal(enc, decoded); err != nil {
+		t.Fatalf("failed to decode genesis: %v", err)
+	}
+	if again, _ := decoded.ToBlock(); again.Hash() != block.Hash() || block.StateRoot() == types.EmptyRootHash {
+		t.Fatalf("genesis block is not deterministic")
+	}
+
+	// 写入数据库的创世区块与内存中计算的一致，状态包含全部账户内容
+	diskdb := rawdb.NewMemoryDatabase()
+	blockchain, err := core.NewBlockchain(diskdb, genesis, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	if head := blockchain.CurrentBlock(); head.Hash() != block.Hash() || head.Time != genesis.Timestamp {
+		t.Fatalf("committed genesis %x differs from %x", head.Hash(), block.Hash())
+	}
+	statedb, _ := blockchain.StateAt(block.StateRoot())
+	if statedb.GetNonce(BAddr) != 3 || statedb.GetState(BAddr, common.BigToHash(big.NewInt(1))) != common.BigToHash(big.NewInt(0xff)) || len(statedb.GetCode(BAddr)) != 10 {
+		t.Fatalf("genesis alloc not committed")
+	}
+	blockchain.Stop()
+
+	// 重新打开时指定相同的Genesis可以通过，不同的Genesis被拒绝
+	if _, err := core.NewBlockchain(diskdb, decoded, evm.Config{}); err != nil {
+		t.Fatalf("failed to reopen blockchain with the same genesis: %v", err)
+	}
+	// 创世区块相同但链配置不同时拒绝，明确要求覆盖时才以指定的genesis为准
+	collector := common.HexToAddress("0xfee")
+	changed := *decoded
+	changed.Config = &params.ChainConfig{ChainID: big.NewInt(1337), FeeCollector: &collector}
+	_, err = core.NewBlockchain(diskdb, &changed, evm.Config{})
+	var configMismatch *core.ConfigMismatchError
+	if !errors.As(err, &configMismatch) || configMismatch.Stored.FeeCollector != nil {
+		t.Fatalf("expected chain config mismatch error, got %v", err)
+	}
+	if config, _, err := core.SetupGenesisBlock(diskdb, nil); err != nil || config.FeeCollector != nil {
+		t.Fatalf("stored chain config overwritten without override: %v", err)
+	}
+	if _, err := core.NewBlockchainWithOverride(diskdb, &changed, true, evm.Config{}); err != nil {
+		t.Fatalf("failed to override chain config: %v", err)
+	}
+	if config, _, err := core.SetupGenesisBlock(diskdb, nil); err != nil || config.FeeCollector == nil || *config.FeeCollector != collector {
+		t.Fatalf("chain config not overridden: %v", err)
+	}
+	// 链配置一致时即使要求覆盖也不重写
+	counting := &countingWriteDB{Database: diskdb}
+	if _, _, err := core.SetupGenesisBlockWithOverride(counting, &changed, true); err != nil || counting.writes != 0 {
+		t.Fatalf("identical chain config rewritten %d times: %v", counting.writes, err)
+	}
+	// 没有链配置的genesis被拒绝，不能覆盖已有的链配置
+	noConfig := changed
+	noConfig.Config = nil
+	if _, _, err := core.SetupGenesisBlockWithOverride(diskdb, &noConfig, true); err == nil {
+		t.Fatalf("genesis without chain config accepted")
+	}
+	if config, _, err := core.SetupGenesisBlock(diskdb, nil); err != nil || config.FeeCollector == nil || *config.FeeCollector != collector {
+		t.Fatalf("stored chain config overwritten by a nil config: %v", err)
+	}
+	decoded.Timestamp++
+	_, err = core.NewBlockchain(diskdb, decoded, evm.Config{})
+	var mismatch *core.GenesisMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Stored != block.Hash() {
+		t.Fatalf("expected genesis mismatch error, got %v", err)
+	}
+}
+
+// 测试区块写入前的区块头、区块体与收据校验，不合法的区块返回对应的错误且不改变链头
+func TestBlockValidation(t *testing.T) {
+	genesis := &core.Genesis{Config: &params.ChainConfig{ChainID: big.NewInt(1337)}, Timestamp: 100, BaseFee: big.NewInt(0)}
+	blockchain, err := core.NewBlockchain(rawdb.NewMemoryDatabase(), genesis, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	parent := blockchain.CurrentBlock()
+	newHeader := func() *types.Header {
+		return &types.Header{
+			ParentHash: parent.Hash(),
+			Time:       parent.Time + 1,
+			Number:     big.NewInt(1),
+			GasLimit:   parent.GasLimit,
+			BaseFee:    core.CalcBaseFee(genesis.Config, parent),
+		}
+	}
+	seal := func(header *types.Header) *types.Block {
+		return types.NewBlock(header, nil, nil, nil, parent.StateRoot, trie.NewStackTrie(nil))
+	}
+	headers := []struct {
+		mutate func(*types.Header)
+		err    error
+	}{
+		{func(h *types.Header) { h.ParentHash = common.Hash{1} }, core.ErrUnknownAncestor},
+		{func(h *types.Header) { h.Number = big.NewInt(2) }, core.ErrInvalidNumber},
+		{func(h *types.Header) { h.Time = parent.Time - 1 }, core.ErrOlderBlockTime},
+		{func(h *types.Header) { h.Time = uint64(time.Now().Unix()) + 60 }, core.ErrFutureBlock},
+		{func(h *types.Header) { h.GasLimit = parent.GasLimit * 2 }, core.ErrInvalidGasLimit},
+		{func(h *types.Header) { h.GasUsed = h.GasLimit + 1 }, core.ErrInvalidGasUsed},
+		{func(h *types.Header) { h.Extra = make([]byte, params.MaximumExtraDataSize+1) }, core.ErrExtraDataTooLong},
+		{func(h *types.Header) { h.BaseFee = big.NewInt(1) }, core.ErrInvalidBaseFee},
+	}
+	for i, tt := range headers {
+		header := newHeader()
+		tt.mutate(header)
+		if err := core.ValidateHeader(genesis.Config, parent, header); !errors.Is(err, tt.err) {
+			t.Fatalf("case %d: expected %v, got %v", i, tt.err, err)
+		}
+		if _, err := blockchain.WriteBlockAndSetHead(seal(header), nil, nil, nil, false); !errors.Is(err, tt.err) {
+			t.Fatalf("case %d: insert expected %v, got %v", i, tt.err, err)
+		}
+	}
+	// 创世区块没有父区块，不能通过ImportBlock导入
+	service := &ExecutorService{BlockChain: blockchain, Processer: core.NewStateProcessor(genesis.Config, blockchain)}
+	if _, err := service.ImportBlock(blockchain.GetBlock(parent.Hash(), 0)); !errors.Is(err, core.ErrInvalidNumber) {
+		t.Fatalf("expected ErrInvalidNumber for the genesis block, got %v", err)
+	}
+
+	// 区块体中的交易与TxRoot不一致
+	forged := types.InitBlock(seal(newHeader()).Header(), NewSingleTX())
+	if _, err := blockchain.WriteBlockAndSetHead(forged, nil, nil, nil, false); !errors.Is(err, core.ErrInvalidTxRoot) {
+		t.Fatalf("expected invalid tx root, got %v", err)
+	}
+	// 收据与区块头不一致
+	receipts := types.Receipts{{Status: types.ReceiptStatusSuccessful}}
+	if _, err := blockchain.WriteBlockAndSetHead(seal(newHeader()), receipts, nil, nil, false); !errors.Is(err, core.ErrInvalidReceiptRoot) {
+		t.Fatalf("expected invalid receipt root, got %v", err)
+	}
+	receipts[0].GasUsed = 1
+	if _, err := blockchain.WriteBlockAndSetHead(seal(newHeader()), receipts, nil, nil, false); !errors.Is(err, core.ErrInvalidGasUsed) {
+		t.Fatalf("expected invalid gas used, got %v", err)
+	}
+	if head := blockchain.CurrentBlock(); head.Hash() != parent.Hash() {
+		t.Fatalf("invalid blocks changed the head to %d", head.Number)
+	}
+
+	// 合法的区块可以写入，重复写入被拒绝
+	block := seal(newHeader())
+	if _, err := blockchain.WriteBlockAndSetHead(block, nil, nil, nil, false); err != nil {
+		t.Fatalf("failed to write valid block: %v", err)
+	}
+	if _, err := blockchain.WriteBlockAndSetHead(block, nil, nil, nil, false); !errors.Is(err, core.ErrKnownBlock) {
+		t.Fatalf("expected known block, got %v", err)
+	}
+
+	// GasLimit每个区块最多调整允许的幅度
+	next := core.CalcGasLimit(block.GasLimit(), block.GasLimit()*2)
+	if next <= block.GasLimit() || core.VerifyGaslimit(block.GasLimit(), next) != nil {
+		t.Fatalf("gas limit %d is not a valid step from %d", next, block.GasLimit())
+	}
+}
+
+// 测试分叉区块按哈希保存，共识最终确认分叉上的区块后切换规范链：状态回到新链，旧链的日志被移除，被丢弃的交易重新进入交易池
+func TestReorg(t *testing.T) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	CKey, _ := crypto.ToECDSA(CKeyBytes)
+	CAddr := crypto.PubkeyToAddress(CKey.PublicKey)
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+	LAddr := common.BytesToAddress(common.FromHex(DAddress))
+	chainCfg := &params.ChainConfig{ChainID: big.NewInt(1337)}
+	genesis := &core.Genesis{Config: chainCfg, BaseFee: big.NewInt(0), Alloc: core.GenesisAlloc{
+		AAddr: {Balance: big.NewInt(99999999999999999)},
+		CAddr: {Balance: big.NewInt(99999999999999999)},
+		LAddr: {Balance: big.NewInt(0), Code: common.FromHex("0x60006000a000")}, // LOG0(0, 0)
+	}}
+	blockchain, err := core.NewBlockchain(rawdb.NewMemoryDatabase(), genesis, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	defer blockchain.Stop()
+	gen := blockchain.GetBlockByNumber(0)
+	base, _ := blockchain.StateAt(gen.StateRoot())
+
+	// 在parent及其状态上执行txs并封装区块
+	makeBlock := func(parent *types.Block, statedb *state.StateDB, txs types.Transactions) (*types.Block, *core.ProcessReturnMsg) {
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Time:       parent.Time() + 1,
+			Number:     new(big.Int).Add(parent.Number(), big.NewInt(1)),
+			GasLimit:   parent.GasLimit(),
+			BaseFee:    core.CalcBaseFee(chainCfg, parent.Header()),
+		}
+		grouped := []types.Transactions{txs}
+		res, err := core.NewStateProcessor(chainCfg, blockchain).Process(types.InitBlock(header, grouped), statedb, evm.Config{})
+		if err != nil {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		header.GasUsed = *res.UsedGas
+		return types.NewBlock(header, grouped, res.Layout(), res.Receipt, res.RootHash, trie.NewStackTrie(nil)), res
+	}
+	write := func(block *types.Block, res *core.ProcessReturnMsg, want core.WriteStatus) {
+		status, err := blockchain.WriteBlockAndSetHead(block, res.Receipt, res.Logs, nil, true)
+		if err != nil || status != want {
+			t.Fatalf("block %d: status %d err %v, want status %d", block.NumberU64(), status, err, want)
+		}
+	}
+
+	// 规范链：C调用合约产生一条日志
+	logTx := panguTx(0, LAddr, big.NewInt(0), testTxGas, nil, big.NewInt(100), big.NewInt(1), CKeyBytes, CAddr)
+	a1, a1Res := makeBlock(gen, base.Copy(), types.Transactions{logTx})
+	if len(a1Res.Logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(a1Res.Logs))
+	}
+	// 分叉：同一父区块上的另一个区块，以及它的子区块
+	b1State := base.Copy()
+	b1, b1Res := makeBlock(gen, b1State, types.Transactions{panguTx(0, CAddr, big.NewInt(100), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)})
+	b2State, _ := state.New(b1.StateRoot(), b1State.Database(), nil)
+	b2, b2Res := makeBlock(b1, b2State, types.Transactions{panguTx(1, BAddr, big.NewInt(100), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)})
+
+	pool := legacypool.New(testTxPoolConfig, blockchain)
+	txPool, err := txpool.New(new(big.Int).SetUint64(testTxPoolConfig.PriceLimit), blockchain, []txpool.SubPool{pool})
+	if err != nil {
+		t.Fatalf("failed to create txpool: %v", err)
+	}
+	defer txPool.Close()
+	// 等待交易池满足cond，交易池在收到新链头后异步重置
+	waitPool := func(cond func() bool, msg string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal(msg)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if errs := txPool.Add([]*txpool.Transaction{{Tx: logTx}}, false, true); errs[0] != nil {
+		t.Fatalf("failed to add tx to pool: %v", errs[0])
+	}
+
+	sideCh := make(chan types.ChainSideEvent, 8)
+	rmLogsCh := make(chan types.RemovedLogsEvent, 8)
+	sideSub := blockchain.SubscribeChainSideEvent(sideCh)
+	defer sideSub.Unsubscribe()
+	rmLogsSub := blockchain.SubscribeRemovedLogsEvent(rmLogsCh)
+	defer rmLogsSub.Unsubscribe()
+
+	write(a1, a1Res, core.CanonStatTy)
+	waitPool(func() bool { return txPool.Get(logTx.Hash()) == nil }, "included transaction not removed from the pool")
+	write(b1, b1Res, core.SideStatTy)
+	write(b2, b2Res, core.SideStatTy)
+	if head := blockchain.CurrentBlock(); head.Hash() != a1.Hash() {
+		t.Fatalf("side blocks changed the head to %d", head.Number)
+	}
+	if children := blockchain.Children(gen.Hash()); len(children) != 2 {
+		t.Fatalf("expected 2 children of genesis, got %d", len(children))
+	}
+	if blockchain.GetBlockByHash(b2.Hash()) == nil || blockchain.GetBlockByNumber(2) != nil {
+		t.Fatalf("side blocks must be stored by hash but not be canonical")
+	}
+	for i := 0; i < 2; i++ {
+		if ev := <-sideCh; ev.Block.ParentHash() != gen.Hash() && ev.Block.ParentHash() != b1.Hash() {
+			t.Fatalf("unexpected side event for block %d", ev.Block.NumberU64())
+		}
+	}
+
+	// 共识最终确认分叉上的b2，规范链切换到 genesis -> b1 -> b2
+	if err := blockchain.Finalize(b2.Hash()); err != nil {
+		t.Fatalf("failed to finalize side block: %v", err)
+	}
+	if head := blockchain.CurrentBlock(); head.Hash() != b2.Hash() || blockchain.CurrentFinalBlock().Hash() != b2.Hash() {
+		t.Fatalf("head %d not switched to the finalized block", head.Number)
+	}
+	if blockchain.GetBlockByNumber(1).Hash() != b1.Hash() {
+		t.Fatalf("canonical hash of block 1 not rewritten")
+	}
+	if rawdb.ReadTxLookupEntry(blockchain.DB(), logTx.Hash()) != nil {
+		t.Fatalf("lookup of the dropped transaction not removed")
+	}
+	if ev := <-sideCh; ev.Block.Hash() != a1.Hash() {
+		t.Fatalf("expected side event for the old head")
+	}
+	if ev := <-rmLogsCh; len(ev.Logs) != 1 || !ev.Logs[0].Removed || ev.Logs[0].Address != LAddr || ev.Logs[0].BlockHash != a1.Hash() {
+		t.Fatalf("unexpected removed logs %+v", ev.Logs)
+	}
+	headState, _ := blockchain.StateAt(b2.StateRoot())
+	if headState.GetNonce(AAddr) != 2 || headState.GetNonce(CAddr) != 0 || headState.GetBalance(BAddr).Uint64() != 100 {
+		t.Fatalf("state not rolled back to the new chain")
+	}
+	// 只在旧链上的交易重新进入交易池
+	waitPool(func() bool { return txPool.Get(logTx.Hash()) != nil }, "dropped transaction not reinjected into the pool")
+
+	// 不能回滚到最终确认的区块之前
+	if err := blockchain.Finalize(a1.Hash()); !errors.Is(err, core.ErrReorgFinalized) {
+		t.Fatalf("expected reorg below finalized block to fail, got %v", err)
+	}
+}
+
+// 测试切换到状态缺失的分叉时返回ErrMissingState，数据库中的规范链、交易索引与内存中的链头都保持在旧链上
+func TestReorgMissingState(t *testing.T) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	chainCfg := &params.ChainConfig{ChainID: big.NewInt(1337)}
+	genesis := &core.Genesis{Config: chainCfg, BaseFee: big.NewInt(0), Alloc: core.GenesisAlloc{
+		AAddr: {Balance: big.NewInt(99999999999999999)},
+	}}
+	blockchain, err := core.NewBlockchain(rawdb.NewMemoryDatabase(), genesis, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	defer blockchain.Stop()
+	gen := blockchain.GetBlockByNumber(0)
+	base, _ := blockchain.StateAt(gen.StateRoot())
+	header := func() *types.Header {
+		return &types.Header{
+			ParentHash: gen.Hash(),
+			Time:       gen.Time() + 1,
+			Number:     big.NewInt(1),
+			GasLimit:   gen.GasLimit(),
+			BaseFee:    core.CalcBaseFee(chainCfg, gen.Header()),
+		}
+	}
+
+	// 规范链上的a1
+	tx := panguTx(0, common.BytesToAddress(common.FromHex(BAddress)), big.NewInt(100), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+	grouped := []types.Transactions{{tx}}
+	a1Header := header()
+	res, err := core.NewStateProcessor(chainCfg, blockchain).Process(types.InitBlock(a1Header, grouped), base, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	a1Header.GasUsed = *res.UsedGas
+	a1 := types.NewBlock(a1Header, grouped, res.Layout(), res.Receipt, res.RootHash, trie.NewStackTrie(nil))
+	if status, err := blockchain.WriteBlockAndSetHead(a1, res.Receipt, res.Logs, nil, true); err != nil || status != core.CanonStatTy {
+		t.Fatalf("failed to write block: status %d err %v", status, err)
+	}
+
+	// 分叉上的空区块b1，状态根在状态数据库中不存在
+	b1Header := header()
+	b1Header.Time++
+	b1 := types.NewBlock(b1Header, nil, nil, nil, common.HexToHash("0xdead"), trie.NewStackTrie(nil))
+	rawdb.WriteBlock(blockchain.DB(), b1)
+
+	if err := blockchain.Finalize(b1.Hash()); !errors.Is(err, core.ErrMissingState) {
+		t.Fatalf("expected reorg to a head without state to fail with missing state, got %v", err)
+	}
+	if head := blockchain.CurrentBlock(); head.Hash() != a1.Hash() {
+		t.Fatalf("head switched to %x", head.Hash())
+	}
+	if rawdb.ReadHeadBlockHash(blockchain.DB()) != a1.Hash() || rawdb.ReadHeadHeaderHash(blockchain.DB()) != a1.Hash() {
+		t.Fatalf("head hashes in the database switched")
+	}
+	if rawdb.ReadCanonicalHash(blockchain.DB(), 1) != a1.Hash() {
+		t.Fatalf("canonical hash of block 1 rewritten")
+	}
+	if rawdb.ReadTxLookupEntry(blockchain.DB(), tx.Hash()) == nil {
+		t.Fatalf("lookup of the canonical transaction removed")
+	}
+	if blockchain.CurrentFinalBlock() != nil {
+		t.Fatalf("block without state recorded as finalized")
+	}
+}
+
+// 测试StateAt打开的历史状态相互独立，离开内存窗口的规范链状态写入磁盘后仍然可以打开，异常退出后链头回退到状态完整的区块
+func TestStateAt(t *testing.T) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+	chainCfg := &params.ChainConfig{ChainID: big.NewInt(1337)}
+	dir := t.TempDir()
+	openDB := func() ethdb.Database {
+		diskdb, err := rawdb.Open(rawdb.OpenOptions{Type: "leveldb", Directory: dir, Cache: 16, Handles: 16})
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		return diskdb
+	}
+
+	diskdb := openDB()
+	genesis := &core.Genesis{Config: chainCfg, BaseFee: big.NewInt(0), Alloc: core.GenesisAlloc{AAddr: {Balance: big.NewInt(99999999999999999)}}}
+	blockchain, err := core.NewBlockchain(diskdb, genesis, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	blockchain.SetTriesInMemory(2)
+
+	// 在链头上执行一笔A向B转账100的交易并写入
+	makeBlock := func(nonce uint64) (*types.Block, *core.ProcessReturnMsg) {
+		parent := blockchain.GetBlockByNumber(blockchain.CurrentBlock().Number.Uint64())
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Time:       parent.Time() + 1,
+			Number:     new(big.Int).Add(parent.Number(), big.NewInt(1)),
+			GasLimit:   parent.GasLimit(),
+			BaseFee:    core.CalcBaseFee(chainCfg, parent.Header()),
+		}
+		txs := []types.Transactions{{panguTx(nonce, BAddr, big.NewInt(100), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)}}
+		res, err := core.NewStateProcessor(chainCfg, blockchain).Process(types.InitBlock(header, txs), mustStateAt(t, blockchain, parent.StateRoot()), evm.Config{})
+		if err != nil {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		header.GasUsed = *res.UsedGas
+		return types.NewBlock(header, txs, res.Layout(), res.Receipt, res.RootHash, trie.NewStackTrie(nil)), res
+	}
+	var blocks []*types.Block
+	for i := uint64(0); i < 5; i++ {
+		block, res := makeBlock(i)
+		if _, err := blockchain.WriteBlockAndSetHead(block, res.Receipt, res.Logs, nil, false); err != nil {
+			t.Fatalf("failed to write block %d: %v", block.NumberU64(), err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	// 窗口内的状态在内存中，更早的已经写入磁盘，都可以打开
+	for number := uint64(0); number <= 5; number++ {
+		statedb, err := blockchain.StateAtBlock(number)
+		if err != nil {
+			t.Fatalf("failed to open state of block %d: %v", number, err)
+		}
+		if balance := statedb.GetBalance(BAddr).Uint64(); balance != 100*number {
+			t.Fatalf("block %d: balance of B is %d, want %d", number, balance, 100*number)
+		}
+	}
+	// 对打开的状态的修改不影响其他调用者与链头
+	modified, _ := blockchain.StateAtBlockHash(blocks[2].Hash())
+	modified.SetBalance(BAddr, big.NewInt(1))
+	if again, _ := blockchain.StateAtBlock(3); again.GetBalance(BAddr).Uint64() != 300 {
+		t.Fatalf("modification leaked into another state")
+	}
+	if head, _ := blockchain.StateAt(blockchain.CurrentBlock().StateRoot); head.GetBalance(BAddr).Uint64() != 500 {
+		t.Fatalf("modification leaked into the head state")
+	}
+	if _, err := blockchain.StateAtBlock(6); !errors.Is(err, core.ErrUnknownBlock) {
+		t.Fatalf("expected unknown block, got %v", err)
+	}
+	if _, err := blockchain.StateAt(common.HexToHash("0x01")); !errors.Is(err, core.ErrMissingState) {
+		t.Fatalf("expected missing state, got %v", err)
+	}
+
+	// 不调用Stop直接关闭数据库，内存中区块4、5的状态丢失，链头回退到区块3
+	diskdb.Close()
+	diskdb = openDB()
+	defer diskdb.Close()
+	blockchain, err = core.NewBlockchain(diskdb, nil, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to reopen blockchain: %v", err)
+	}
+	defer blockchain.Stop()
+	if head := blockchain.CurrentBlock(); head.Hash() != blocks[2].Hash() {
+		t.Fatalf("head not repaired: have %d, want 3", head.Number)
+	}
+	if blockchain.GetBlockByNumber(4) != nil {
+		t.Fatalf("canonical hash above the repaired head not removed")
+	}
+	if rawdb.ReadTxLookupEntry(diskdb, blocks[4].Transactions()[0].Hash()) != nil {
+		t.Fatalf("lookup of the dropped block not removed")
+	}
+	// 删除的区块可以重新写入
+	res, err := core.NewStateProcessor(chainCfg, blockchain).Process(types.InitBlock(blocks[3].Header(), []types.Transactions{blocks[3].Transactions()}), mustStateAt(t, blockchain, blocks[2].StateRoot()), evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	if status, err := blockchain.WriteBlockAndSetHead(blocks[3], res.Receipt, res.Logs, nil, false); err != nil || status != core.CanonStatTy {
+		t.Fatalf("failed to rewrite block 4: status %d err %v", status, err)
+	}
+}
+
+func mustStateAt(t *testing.T, blockchain *core.Blockchain, root common.Hash) *state.StateDB {
+	statedb, err := blockchain.StateAt(root)
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	return statedb
+}
+
+// 测试规范链上的交易与收据可以按哈希查询到所在区块与序号，超出TxLookupLimit的旧区块的交易索引被删除
+func TestTxIndexes(t *testing.T) {
+	AKey, _ := crypto.ToECDSA(AKeyBytes)
+	AAddr := crypto.PubkeyToAddress(AKey.PublicKey)
+	CKey, _ := crypto.ToECDSA(CKeyBytes)
+	CAddr := crypto.PubkeyToAddress(CKey.PublicKey)
+	BAddr := common.BytesToAddress(common.FromHex(BAddress))
+	LAddr := common.BytesToAddress(common.FromHex(DAddress))
+	EKeyBytes := common.Hex2Bytes("c3914129fade8d775d22202702690a8a0dcb178040bcb232a950c65b84308831")
+	EKey, _ := crypto.ToECDSA(EKeyBytes)
+	chainCfg := &params.ChainConfig{ChainID: big.NewInt(1337)}
+	genesis := &core.Genesis{Config: chainCfg, BaseFee: big.NewInt(0), Alloc: core.GenesisAlloc{
+		AAddr:                                  {Balance: big.NewInt(99999999999999999)},
+		CAddr:                                  {Balance: big.NewInt(99999999999999999)},
+		crypto.PubkeyToAddress(EKey.PublicKey): {Balance: big.NewInt(99999999999999999)},
+		LAddr:                                  {Balance: big.NewInt(0), Code: common.FromHex("0x6000545060006000a000")}, // SLOAD(0) LOG0(0, 0)
+	}}
+	blockchain, err := core.NewBlockchain(rawdb.NewMemoryDatabase(), genesis, evm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	defer blockchain.Stop()
+	blockchain.SetTxLookupLimit(2)
+
+	// 在链头上执行txs并写入
+	writeBlock := func(txs types.Transactions) *types.Block {
+		parent := blockchain.GetBlockByNumber(blockchain.CurrentBlock().Number.Uint64())
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Time:       parent.Time() + 1,
+			Number:     new(big.Int).Add(parent.Number(), big.NewInt(1)),
+			GasLimit:   parent.GasLimit(),
+			BaseFee:    core.CalcBaseFee(chainCfg, parent.Header()),
+		}
+		grouped := []types.Transactions{txs}
+		res, err := core.NewStateProcessor(chainCfg, blockchain).Process(types.InitBlock(header, grouped), mustStateAt(t, blockchain, parent.StateRoot()), evm.Config{})
+		if err != nil {
+			t.Fatalf("failed to process block: %v", err)
+		}
+		header.GasUsed = *res.UsedGas
+		block := types.NewBlock(header, grouped, res.Layout(), res.Receipt, res.RootHash, trie.NewStackTrie(nil))
+		if _, err := blockchain.WriteBlockAndSetHead(block, res.Receipt, res.Logs, nil, false); err != nil {
+			t.Fatalf("failed to write block %d: %v", block.NumberU64(), err)
+		}
+		return block
+	}
+	transferTx := panguTx(0, BAddr, big.NewInt(100), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+	// logTx读取了没有声明的slot，从并行组降级，执行顺序排在区块中位于它之后的交易之后
+	logTx := panguTx(0, LAddr, big.NewInt(0), testTxGas, nil, big.NewInt(100), big.NewInt(1), CKeyBytes, CAddr)
+	inner := types.Transactions{
+		panguTx(1, BAddr, big.NewInt(100), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr),
+		panguTx(2, BAddr, big.NewInt(100), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr),
+	}
+	agg, err := types.NewAggregateTx(0, big.NewInt(1337), inner)
+	if err != nil {
+		t.Fatalf("failed to build aggregate: %v", err)
+	}
+	agg, _ = types.SignTx(agg, types.LatestSignerForChainID(big.NewInt(1337)), EKeyBytes, types.SIG_ECDSA)
+	block1 := writeBlock(types.Transactions{logTx, transferTx, agg})
+
+	// 交易与收据的序号都是执行顺序，聚合交易的内部交易可以按哈希查找
+	want := map[common.Hash]uint64{transferTx.Hash(): 0, inner[0].Hash(): 1, inner[1].Hash(): 2, logTx.Hash(): 3}
+	for hash, wantIndex := range want {
+		got, blockHash, number, index := blockchain.GetTransaction(hash)
+		if got == nil || got.Hash() != hash || blockHash != block1.Hash() || number != 1 || index != wantIndex {
+			t.Fatalf("tx %x: unexpected lookup %x %d %d, want index %d", hash, blockHash, number, index, wantIndex)
+		}
+		receipt, blockHash, number, index := blockchain.GetReceipt(hash)
+		if receipt == nil || receipt.TxHash != hash || blockHash != block1.Hash() || number != 1 || index != wantIndex {
+			t.Fatalf("tx %x: receipt not found at index %d", hash, wantIndex)
+		}
+		if receipt.TransactionIndex != uint(index) || receipt.BlockHash != block1.Hash() || receipt.BlockNumber.Uint64() != 1 {
+			t.Fatalf("tx %x: receipt location not derived", hash)
+		}
+		if receipt.GasUsed == 0 || receipt.EffectiveGasPrice == nil || receipt.Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("tx %x: stored receipt fields lost", hash)
+		}
+	}
+	// 聚合交易本身位于第一笔内部交易的位置，没有自己的收据
+	if got, _, _, index := blockchain.GetTransaction(agg.Hash()); got == nil || got.Hash() != agg.Hash() || index != 1 {
+		t.Fatalf("aggregate lookup failed, index %d", index)
+	}
+	if receipt, _, _, _ := blockchain.GetReceipt(agg.Hash()); receipt != nil {
+		t.Fatalf("unexpected receipt for the aggregate tx")
+	}
+	receipt, _, _, _ := blockchain.GetReceipt(inner[0].Hash())
+	if receipt.AggregateHash != agg.Hash() {
+		t.Fatalf("inner receipt not linked to the aggregate")
+	}
+	receipt, _, _, _ = blockchain.GetReceipt(logTx.Hash())
+	if len(receipt.Logs) != 1 || receipt.Logs[0].TxHash != logTx.Hash() || receipt.Logs[0].BlockHash != block1.Hash() || receipt.Logs[0].Address != LAddr || receipt.Logs[0].TxIndex != 3 {
+		t.Fatalf("log fields not derived: %+v", receipt.Logs)
+	}
+	if tx, _, _, _ := blockchain.GetTransaction(common.HexToHash("0x01")); tx != nil {
+		t.Fatalf("unknown transaction found")
+	}
+
+	// 只保留最近两个区块的交易索引
+	var txs []*types.Transaction
+	for nonce := uint64(3); nonce <= 5; nonce++ {
+		tx := panguTx(nonce, BAddr, big.NewInt(100), testTxGas, nil, big.NewInt(100), big.NewInt(1), AKeyBytes, AAddr)
+		writeBlock(types.Transactions{tx})
+		txs = append(txs, tx)
+	}
+	if tail := blockchain.TxIndexTail(); tail == nil || *tail != 3 {
+		t.Fatalf("unexpected tx index tail %v, want 3", tail)
+	}
+	for _, tx := range []*types.Transaction{transferTx, logTx, agg, inner[0], inner[1], txs[0]} {
+		if got, _, _, _ := blockchain.GetTransaction(tx.Hash()); got != nil {
+			t.Fatalf("lookup of tx %x below the tail not removed", tx.Hash())
+		}
+	}
+	for _, tx := range txs[1:] {
+		if got, _, _, _ := blockchain.GetTransaction(tx.Hash()); got == nil {
+			t.Fatalf("lookup of recent tx %x removed", tx.Hash())
+		}
+		if receipt, _, _, _ := blockchain.GetReceipt(tx.Hash()); receipt == nil {
+			t.Fatalf("receipt of recent tx %x not found", tx.Hash())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package executor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core"
+	"github.com/SipengXie/pangu/core/txpool"
+	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/event"
+)
+
+// maxPredictions 最多保存的预执行结果数，超过时先清理已经离开交易池的交易，仍然超过则不再预执行新交易
+const maxPredictions = 65536
+
+// Speculator 挂在待处理交易池上的后台预执行器
+// 新交易到达时在最新链头状态上预执行，记录预测的访问集合与冲突风险
+// 交易上链后删除对应的结果，每个新链头到达时清理已经被交易池丢弃（替换、过期、驱逐）的交易的结果
+type Speculator struct {
+	chain *core.Blockchain
+	pool  *txpool.TxPool
+	// initHeader 生成下一个区块的区块头，预执行按下一个区块的环境进行
+	initHeader func() *types.Header
+
+	txsCh   chan types.NewTxsEvent
+	txsSub  event.Subscription
+	headCh  chan types.ChainHeadEvent
+	headSub event.Subscription
+
+	mu          sync.RWMutex
+	predictions core.Predictions
+}
+
+// NewSpeculator 订阅交易池的新交易与链头事件并启动预执行循环
+func NewSpeculator(pool *txpool.TxPool, chain *core.Blockchain, initHeader func() *types.Header) *Speculator {
+	s := &Speculator{
+		chain:       chain,
+		pool:        pool,
+		initHeader:  initHeader,
+		txsCh:       make(chan types.NewTxsEvent, txChanSize),
+		headCh:      make(chan types.ChainHeadEvent, 16),
+		predictions: make(core.Predictions),
+	}
+	s.txsSub = pool.SubscribeNewTxsEvent(s.txsCh)
+	s.headSub = chain.SubscribeChainHeadEvent(s.headCh)
+	go s.loop()
+	return s
+}
+
+func (s *Speculator) loop() {
+	defer s.txsSub.Unsubscribe()
+	defer s.headSub.Unsubscribe()
+	for {
+		select {
+		case ev := <-s.txsCh:
+			s.predict(ev.Txs)
+		case ev := <-s.headCh:
+			s.forget(ev.Block.Transactions())
+		case <-s.txsSub.Err():
+			return
+		case <-s.headSub.Err():
+			return
+		}
+	}
+}
+
+// predict 在最新链头状态上预执行一批交易，聚合交易与无法预执行的交易不记录结果
+func (s *Speculator) predict(txs types.Transactions) {
+	statedb, err := s.chain.StateAt(s.chain.CurrentBlock().StateRoot)
+	if err != nil {
+		return
+	}
+	header := s.initHeader()
+	for _, tx := range txs {
+		if tx.IsAggregate() {
+			continue
+		}
+		if s.full() {
+			return
+		}
+		pred, err := core.PredictTx(s.chain.Config(), s.chain, header, statedb, tx, s.chain.VmConfig())
+		if err != nil {
+			continue
+		}
+		if pred.Conflict {
+			fmt.Printf("%sPROMPT MSG%s   预执行发现交易 %s 的AccessList与实际访问冲突，执行时很可能进入串行队列\n", types.FGREEN, types.FRESET, tx.Hash().Hex())
+		}
+		s.mu.Lock()
+		s.predictions[tx.Hash()] = pred
+		s.mu.Unlock()
+	}
+}
+
+// full 预执行结果数是否已达上限，达到时先清理已经离开交易池的交易
+func (s *Speculator) full() bool {
+	s.mu.RLock()
+	full := len(s.predictions) >= maxPredictions
+	s.mu.RUnlock()
+	if !full {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	return len(s.predictions) >= maxPredictions
+}
+
+// forget 删除已经上链的交易以及已经离开交易池的交易的预执行结果
+func (s *Speculator) forget(txs types.Transactions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tx := range txs {
+		delete(s.predictions, tx.Hash())
+	}
+	s.prune()
+}
+
+// prune 删除交易池中已经没有的交易的预执行结果，调用者需要持有写锁
+func (s *Speculator) prune() {
+	for hash := range s.predictions {
+		if !s.pool.Has(hash) {
+			delete(s.predictions, hash)
+		}
+	}
+}
+
+// Prediction 返回交易的预执行结果，没有预执行过时返回nil
+func (s *Speculator) Prediction(hash common.Hash) *core.TxPrediction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.predictions[hash]
+}
+
+// Predictions 返回一批交易中已经预执行过的交易的结果
+func (s *Speculator) Predictions(txs types.Transactions) core.Predictions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	preds := make(core.Predictions, len(txs))
+	for _, tx := range txs {
+		if pred, ok := s.predictions[tx.Hash()]; ok {
+			preds[tx.Hash()] = pred
+		}
+	}
+	return preds
+}
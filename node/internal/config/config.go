@@ -4,4 +4,12 @@ import "github.com/zeromicro/go-zero/rest"
 
 type Config struct {
 	rest.RestConf
+	DataDir  string `json:",default=data"` // 区块链数据库所在的目录，重启后从中恢复链
+	DBEngine string `json:",optional"`     // leveldb或pebble，为空时沿用已有数据库的类型，新建时默认pebble
+	Genesis  string `json:",optional"`     // 创世文件路径，为空时只能打开已有的链
+
+	OverrideChainConfig bool `json:",optional"` // 已有链的链配置与创世文件不一致时以创世文件为准，默认拒绝启动
+
+	TriesInMemory uint64 `json:",default=128"` // 状态保留在内存中的最近区块数，0表示每个区块的状态都直接写入磁盘
+	TxLookupLimit uint64 `json:",optional"`    // 保留交易索引的最近区块数，0表示保留所有区块的交易索引
 }
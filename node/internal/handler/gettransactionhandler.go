@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/SipengXie/pangu/node/internal/logic"
+	"github.com/SipengXie/pangu/node/internal/svc"
+	"github.com/SipengXie/pangu/node/internal/types"
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+func getTransactionHandler(svcCtx *svc.ServiceContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.TxHashReq
+		if err := httpx.Parse(r, &req); err != nil {
+			httpx.ErrorCtx(r.Context(), w, err)
+			return
+		}
+
+		l := logic.NewGetTransactionLogic(r.Context(), svcCtx)
+		resp, err := l.GetTransaction(&req)
+		if err != nil {
+			httpx.ErrorCtx(r.Context(), w, err)
+		} else {
+			httpx.OkJsonCtx(r.Context(), w, resp)
+		}
+	}
+}
@@ -17,6 +17,21 @@ func RegisterHandlers(server *rest.Server, serverCtx *svc.ServiceContext) {
 				Path:    "/pangu/sendTransaction",
 				Handler: sendTransactionHandler(serverCtx),
 			},
+			{
+				Method:  http.MethodPost,
+				Path:    "/pangu/createAccessList",
+				Handler: createAccessListHandler(serverCtx),
+			},
+			{
+				Method:  http.MethodPost,
+				Path:    "/pangu/getTransaction",
+				Handler: getTransactionHandler(serverCtx),
+			},
+			{
+				Method:  http.MethodPost,
+				Path:    "/pangu/getReceipt",
+				Handler: getReceiptHandler(serverCtx),
+			},
 		},
 	)
 }
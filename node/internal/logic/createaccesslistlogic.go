@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/SipengXie/pangu/accesslist"
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/core"
+	"github.com/SipengXie/pangu/node/internal/svc"
+	"github.com/SipengXie/pangu/node/internal/types"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type CreateAccessListLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+func NewCreateAccessListLogic(ctx context.Context, svcCtx *svc.ServiceContext) *CreateAccessListLogic {
+	return &CreateAccessListLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+// ToMessage 将 TxArgs 转换成用于模拟执行的 TxMessage，不需要签名，To为空时表示创建合约
+func ToMessage(args *types.TransactionArgs) (*core.TxMessage, error) {
+	al := accesslist.NewAccessList()
+	if len(args.AccessList) != 0 {
+		// 与sendTransaction相同，AccessList以Json字节数据的hexString传入
+		if err := al.Deserialize(common.Hex2Bytes(args.AccessList)); err != nil {
+			return nil, err
+		}
+	}
+
+	var to *common.Address
+	if len(args.To) != 0 {
+		to = new(common.Address)
+		to.SetBytes(common.FromHex(args.To))
+	}
+
+	feecap := new(big.Int)
+	feecap.SetString(args.MaxFeePerGas, 10)
+
+	tipcap := new(big.Int)
+	tipcap.SetString(args.MaxPriorityFeePerGas, 10)
+
+	value := new(big.Int)
+	value.SetString(args.Value, 10)
+
+	var txdata []byte
+	if len(args.Input) != 0 {
+		txdata = common.Hex2Bytes(args.Input)
+	}
+	if len(args.Data) != 0 {
+		txdata = common.Hex2Bytes(args.Data)
+	}
+
+	return &core.TxMessage{
+		To:         to,
+		From:       common.HexToAddress(args.From),
+		Value:      value,
+		GasLimit:   args.Gas,
+		GasFeeCap:  feecap,
+		GasTipCap:  tipcap,
+		Data:       txdata,
+		AccessList: al,
+	}, nil
+}
+
+// CreateAccessList 模拟执行交易，返回交易应当声明的AccessList（Json字节数据的hexString，可以直接填入sendTransaction）与使用的汽油
+func (l *CreateAccessListLogic) CreateAccessList(req *types.TransactionArgs) (resp *types.AccessListRes, err error) {
+	msg, err := ToMessage(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := l.svcCtx.ExecutorService.CreateAccessList(msg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := res.AccessList.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return &types.AccessListRes{AccessList: common.Bytes2Hex(data), GasUsed: res.GasUsed}, nil
+}
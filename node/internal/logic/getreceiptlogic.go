@@ -0,0 +1,62 @@
+package logic
+
+import (
+	"context"
+
+	"github.com/SipengXie/pangu/common"
+	"github.com/SipengXie/pangu/node/internal/svc"
+	"github.com/SipengXie/pangu/node/internal/types"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type GetReceiptLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+func NewGetReceiptLogic(ctx context.Context, svcCtx *svc.ServiceContext) *GetReceiptLogic {
+	return &GetReceiptLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+// GetReceipt 按交易哈希查询规范链上的收据，序号为收据在区块中的执行顺序
+func (l *GetReceiptLogic) GetReceipt(req *types.TxHashReq) (resp *types.ReceiptRes, err error) {
+	receipt, blockHash, blockNumber, index := l.svcCtx.ExecutorService.BlockChain.GetReceipt(common.HexToHash(req.Hash))
+	if receipt == nil {
+		return nil, errTxNotFound
+	}
+	resp = &types.ReceiptRes{
+		TxHash:            receipt.TxHash.Hex(),
+		BlockHash:         blockHash.Hex(),
+		BlockNumber:       blockNumber,
+		Index:             index,
+		Status:            receipt.Status,
+		GasUsed:           receipt.GasUsed,
+		CumulativeGasUsed: receipt.CumulativeGasUsed,
+		RevertReason:      receipt.RevertReason,
+		Logs:              make([]types.LogRes, 0, len(receipt.Logs)),
+	}
+	if receipt.EffectiveGasPrice != nil {
+		resp.EffectiveGasPrice = receipt.EffectiveGasPrice.String()
+	}
+	if receipt.ContractAddress != (common.Address{}) {
+		resp.ContractAddress = receipt.ContractAddress.Hex()
+	}
+	for _, log := range receipt.Logs {
+		topics := make([]string, len(log.Topics))
+		for i, topic := range log.Topics {
+			topics[i] = topic.Hex()
+		}
+		resp.Logs = append(resp.Logs, types.LogRes{
+			Address: log.Address.Hex(),
+			Topics:  topics,
+			Data:    common.Bytes2Hex(log.Data),
+			Index:   log.Index,
+		})
+	}
+	return resp, nil
+}
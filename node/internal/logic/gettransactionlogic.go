@@ -0,0 +1,55 @@
+package logic
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SipengXie/pangu/common"
+	tp "github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/node/internal/svc"
+	"github.com/SipengXie/pangu/node/internal/types"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// errTxNotFound 交易不在规范链上，或者所在区块的交易索引已经删除
+var errTxNotFound = errors.New("transaction not found")
+
+type GetTransactionLogic struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+func NewGetTransactionLogic(ctx context.Context, svcCtx *svc.ServiceContext) *GetTransactionLogic {
+	return &GetTransactionLogic{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+// GetTransaction 按哈希查询规范链上的交易及其所在区块的哈希、高度与交易在区块中的序号
+func (l *GetTransactionLogic) GetTransaction(req *types.TxHashReq) (resp *types.TransactionRes, err error) {
+	chain := l.svcCtx.ExecutorService.BlockChain
+	tx, blockHash, blockNumber, index := chain.GetTransaction(common.HexToHash(req.Hash))
+	if tx == nil {
+		return nil, errTxNotFound
+	}
+	resp = &types.TransactionRes{
+		Hash:        tx.Hash().Hex(),
+		BlockHash:   blockHash.Hex(),
+		BlockNumber: blockNumber,
+		Index:       index,
+		Nonce:       tx.Nonce(),
+		Gas:         tx.GasLimit(),
+		Value:       tx.Value().String(),
+		Data:        common.Bytes2Hex(tx.Data()),
+	}
+	if from, err := tp.Sender(tp.LatestSignerForChainID(chain.Config().ChainID), tx); err == nil {
+		resp.From = from.Hex()
+	}
+	if to := tx.To(); to != nil {
+		resp.To = to.Hex()
+	}
+	return resp, nil
+}
@@ -5,19 +5,14 @@ import (
 	"math/big"
 	"net"
 
-	"github.com/SipengXie/pangu/common"
-	"github.com/SipengXie/pangu/crypto"
-
 	"github.com/SipengXie/pangu/core"
 	"github.com/SipengXie/pangu/core/evm"
 	"github.com/SipengXie/pangu/core/rawdb"
-	"github.com/SipengXie/pangu/core/state"
 	"github.com/SipengXie/pangu/core/txpool"
 	"github.com/SipengXie/pangu/core/txpool/legacypool"
-	"github.com/SipengXie/pangu/core/types"
+	"github.com/SipengXie/pangu/ethdb"
 	"github.com/SipengXie/pangu/executor"
 	"github.com/SipengXie/pangu/node/internal/config"
-	"github.com/SipengXie/pangu/params"
 	"github.com/SipengXie/pangu/pb"
 
 	"google.golang.org/grpc"
@@ -25,30 +20,39 @@ import (
 	"google.golang.org/grpc/grpclog"
 )
 
-var (
-	db         = rawdb.NewMemoryDatabase()
-	BankKeyHex = "c3914129fade8d775d22202702690a8a0dcb178040bcb232a950c65b84308828"
-)
-
 type ServiceContext struct {
 	Config          config.Config
+	DB              ethdb.Database // 区块链数据库，节点退出时关闭
 	ExecutorService *executor.ExecutorService
 }
 
 func NewServiceContext(c config.Config) *ServiceContext {
-	// TODO : 工程上需要进一步构筑blockchain的逻辑
-	// 默认起好了一条链
-	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(db), nil)
-	// 初始化一个账户
-	BankAKey, _ := crypto.ToECDSA(common.Hex2Bytes(BankKeyHex))
-	BankAddress := crypto.PubkeyToAddress(BankAKey.PublicKey)
-	statedb.SetBalance(BankAddress, big.NewInt(9000000000000000000))
-
-	// 模拟一个区块链
-	chainCfg := &params.ChainConfig{
-		ChainID: big.NewInt(1337),
+	// 打开数据目录下的数据库，已有链时从链头恢复
+	db, err := rawdb.Open(rawdb.OpenOptions{
+		Type:      c.DBEngine,
+		Directory: c.DataDir,
+		Namespace: "pangu/db/chaindata/",
+		Cache:     512,
+		Handles:   256,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("failed to open database %s: %v", c.DataDir, err))
+	}
+	// 数据库中还没有链时写入创世区块，已有链时检查创世区块与链配置一致
+	var genesis *core.Genesis
+	if c.Genesis != "" {
+		if genesis, err = core.LoadGenesis(c.Genesis); err != nil {
+			db.Close()
+			panic(err)
+		}
+	}
+	blockchain, err := core.NewBlockchainWithOverride(db, genesis, c.OverrideChainConfig, evm.Config{})
+	if err != nil {
+		db.Close()
+		panic(fmt.Sprintf("failed to open blockchain: %v", err))
 	}
-	blockchain := core.NewBlokchain(chainCfg, statedb, evm.Config{})
+	blockchain.SetTriesInMemory(c.TriesInMemory)
+	blockchain.SetTxLookupLimit(c.TxLookupLimit)
 
 	// 实例化两个txpool
 	var txpoolCfg legacypool.Config
@@ -82,6 +86,7 @@ func NewServiceContext(c config.Config) *ServiceContext {
 
 	return &ServiceContext{
 		Config:          c,
+		DB:              db,
 		ExecutorService: executorService,
 	}
 }
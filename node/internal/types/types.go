@@ -21,3 +21,46 @@ type TransactionArgs struct {
 type BoolRes struct {
 	Flag bool `json:"flag"`
 }
+
+type AccessListRes struct {
+	AccessList string `json:"accessList"`
+	GasUsed    uint64 `json:"gasUsed"`
+}
+
+type TxHashReq struct {
+	Hash string `json:"hash"`
+}
+
+type TransactionRes struct {
+	Hash        string `json:"hash"`
+	BlockHash   string `json:"blockHash"`
+	BlockNumber uint64 `json:"blockNumber"`
+	Index       uint64 `json:"transactionIndex"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Nonce       uint64 `json:"nonce"`
+	Gas         uint64 `json:"gas"`
+	Value       string `json:"value"`
+	Data        string `json:"data"`
+}
+
+type LogRes struct {
+	Address string   `json:"address"`
+	Topics  []string `json:"topics"`
+	Data    string   `json:"data"`
+	Index   uint     `json:"logIndex"`
+}
+
+type ReceiptRes struct {
+	TxHash            string   `json:"transactionHash"`
+	BlockHash         string   `json:"blockHash"`
+	BlockNumber       uint64   `json:"blockNumber"`
+	Index             uint64   `json:"transactionIndex"`
+	Status            uint64   `json:"status"`
+	GasUsed           uint64   `json:"gasUsed"`
+	CumulativeGasUsed uint64   `json:"cumulativeGasUsed"`
+	EffectiveGasPrice string   `json:"effectiveGasPrice"`
+	ContractAddress   string   `json:"contractAddress,omitempty"`
+	RevertReason      string   `json:"revertReason,omitempty"`
+	Logs              []LogRes `json:"logs"`
+}
@@ -25,6 +25,7 @@ func main() {
 	defer server.Stop()
 
 	ctx := svc.NewServiceContext(c)
+	defer ctx.DB.Close()
 	defer ctx.ExecutorService.Stop()
 	handler.RegisterHandlers(server, ctx)
 
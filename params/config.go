@@ -1,23 +1,66 @@
 package params
 
-import "math/big"
+import (
+	"math/big"
+
+	"github.com/SipengXie/pangu/common"
+)
 
 type ChainConfig struct {
 	ChainID *big.Int `json:"chainId"` // chainId identifies the current chain and is used for replay protection
+
+	AccessListPenalty *AccessListPenaltyConfig `json:"accessListPenalty,omitempty"` // nil表示不惩罚AccessList不一致的交易
+	FeeCollector      *common.Address          `json:"feeCollector,omitempty"`      // 基础费的接收地址，nil表示销毁基础费（EIP-1559）
+	ByzantiumBlock    *big.Int                 `json:"byzantiumBlock,omitempty"`    // 从该高度起使用Byzantium指令集（REVERT、RETURNDATA*、STATICCALL等），nil表示一直使用Frontier指令集
+
+	// 执行布局相关的规则，所有节点必须一致，否则验证者得到的执行布局与区块头的GroupRoot不一致
+	ReexecRounds *uint64 `json:"reexecRounds,omitempty"` // 降级交易最多重新并行执行的轮数，nil表示使用默认的轮数，0表示降级交易直接进入串行队列
+	MergePolicy  uint8   `json:"mergePolicy,omitempty"`  // 并行组写集合冲突时的处理策略：0表示冲突组降级，1表示区块执行失败
+}
+
+// AccessListPenaltyConfig 交易从并行组降级到串行队列后，声明的AccessList与实际执行不一致时收取的惩罚汽油
+// 惩罚汽油 = BaseGas + AddressGas * 不一致的地址数 + SlotGas * 不一致的slot数
+type AccessListPenaltyConfig struct {
+	BaseGas    uint64 `json:"baseGas"`
+	AddressGas uint64 `json:"addressGas"`
+	SlotGas    uint64 `json:"slotGas"`
+}
+
+// DefaultAccessListPenalty 默认的AccessList惩罚规则
+var DefaultAccessListPenalty = &AccessListPenaltyConfig{
+	BaseGas:    AccessListPenaltyBaseGas,
+	AddressGas: AccessListPenaltyAddressGas,
+	SlotGas:    AccessListPenaltySlotGas,
 }
+
 type Rules struct {
 }
 
+// IsByzantium 高度num的区块是否使用Byzantium指令集
+func (c *ChainConfig) IsByzantium(num *big.Int) bool {
+	return isBlockForked(c.ByzantiumBlock, num)
+}
+
+// isBlockForked 在高度s分叉时，高度head的区块是否已经分叉；s为nil表示没有分叉
+func isBlockForked(s, head *big.Int) bool {
+	if s == nil || head == nil {
+		return false
+	}
+	return s.Cmp(head) <= 0
+}
+
 func (c *ChainConfig) Rules(num *big.Int, isMerge bool, timestamp uint64) Rules {
 	return Rules{}
 }
 
 var (
 	AllEthashProtocolChanges = &ChainConfig{
-		ChainID: big.NewInt(1337), // TODO: 很多都舍弃了
+		ChainID:           big.NewInt(1337), // TODO: 很多都舍弃了
+		AccessListPenalty: DefaultAccessListPenalty,
 	}
 
 	TestChainConfig = &ChainConfig{
-		ChainID: big.NewInt(1337),
+		ChainID:           big.NewInt(1337),
+		AccessListPenalty: DefaultAccessListPenalty,
 	}
 )
@@ -111,6 +111,17 @@ const (
 	MaxCodeSize     = 24576           // Maximum bytecode to permit for a contract
 	MaxInitCodeSize = 2 * MaxCodeSize // Maximum initcode to permit in a creation transaction and create instructions
 
+	// 担保交易的汽油费规则（见整体架构.md 担保人一节），所有费用由担保人支付
+	GuarGasDiscountNumerator   uint64 = 9 // 担保交易正常执行时按 9/10 的实际汽油收费，GasGuarYes < GasFreeYes
+	GuarGasDiscountDenominator uint64 = 10
+	GuarErrGasNumerator        uint64 = 3 // 担保交易出错时按 3/2 * GasLimit 收费，GasGuarNo = 1.5 * GasFreeNo
+	GuarErrGasDenominator      uint64 = 2
+
+	// 串行队列中AccessList与实际执行不一致的交易的默认惩罚汽油（见 ChainConfig.AccessListPenalty）
+	AccessListPenaltyBaseGas    uint64 = 5000 // 每笔不一致的交易
+	AccessListPenaltyAddressGas uint64 = 4800 // 每个未声明或未使用的地址，2 * TxAccessListAddressGas
+	AccessListPenaltySlotGas    uint64 = 3800 // 每个未声明或未使用的slot，2 * TxAccessListStorageKeyGas
+
 	// Precompiled contract gas prices
 
 	EcrecoverGas        uint64 = 3000 // Elliptic curve sender recovery gas price